@@ -22,6 +22,7 @@ import (
 	"fmt"
 	"net/http"
 	"os"
+	"strings"
 	"time"
 
 	configv1 "github.com/openshift/api/config/v1"
@@ -31,6 +32,7 @@ import (
 	"github.com/openshift/cluster-api-provider-ovirt/pkg/controller"
 	"github.com/openshift/cluster-api-provider-ovirt/pkg/ovirt"
 	"github.com/openshift/cluster-api-provider-ovirt/pkg/utils"
+	"github.com/openshift/cluster-api-provider-ovirt/pkg/webhooks"
 	capimachine "github.com/openshift/machine-api-operator/pkg/controller/machine"
 	"k8s.io/client-go/rest"
 	"k8s.io/klog"
@@ -49,6 +51,18 @@ var (
 	syncPeriod    = 10 * time.Minute
 )
 
+// The default time the guest OS is given to shut down when a machine is deleted.
+var defaultShutdownGracePeriod = 2 * time.Minute
+
+// The default interval the connection to the oVirt engine is tested at.
+var defaultOVirtHealthProbeInterval = 30 * time.Second
+
+// The default rate limit of the calls to each oVirt engine.
+var (
+	defaultOVirtAPIQPS   = 10.0
+	defaultOVirtAPIBurst = 20
+)
+
 func main() {
 	flags := parseFlags()
 
@@ -60,28 +74,54 @@ func main() {
 	// create oVirt client service to create cached clients syncing with secrets
 	ctx, cancel := context.WithCancel(context.Background())
 	oVirtClientService := ovirt.NewClientService(cfg, ovirt.SecretsToWatch{
-		Namespace:  utils.NAMESPACE,
-		SecretName: utils.OvirtCloudCredsSecretName,
+		Namespace:          utils.NAMESPACE,
+		SecretName:         utils.OvirtCloudCredsSecretName,
+		LabelSelector:      flags.CredentialsSecretSelector,
+		Namespaces:         flags.CredentialsSecretNamespaces,
+		TrustedCAConfigMap: flags.TrustedCAConfigMap,
 	})
 
 	log := logz.New().WithName("ovirt-controller-manager")
 	entryLog := log.WithName("entrypoint")
 
-	mgr, err := setupManager(cfg, flags.ToManagerOptions(), oVirtClientService)
+	shutdownTracing, err := setupTracing(ctx, flags.TracingOTLPEndpoint, flags.TracingOTLPInsecure)
+	if err != nil {
+		entryLog.Error(err, "Unable to set up tracing")
+		os.Exit(1)
+	}
+
+	// all controllers share one client, its connection is tested in the background
+	throttle := ovirt.ThrottleConfig{QPS: flags.OVirtAPIQPS, Burst: flags.OVirtAPIBurst}
+	sharedOVirtClient := oVirtClientService.NewCachedClient("shared")
+	sharedOVirtClient.WithThrottle(throttle)
+	sharedOVirtClient.StartHealthProbe(ctx, flags.OVirtHealthProbeInterval)
+
+	mgr, err := setupManager(cfg, flags.ToManagerOptions(), oVirtClientService, sharedOVirtClient)
 	if err != nil {
 		entryLog.Error(err, "Unable to set up controller manager")
 		os.Exit(1)
 	}
 
+	// clients for the engines of the credentials secrets referenced by provider specs, the secrets
+	// are watched by the client service
+	oVirtClientPool := ovirt.NewClientPool(oVirtClientService).
+		WithHealthProbe(ctx, flags.OVirtHealthProbeInterval).
+		WithThrottle(throttle)
+
 	capimachine.AddWithActuator(mgr, machine.NewActuator(machine.ActuatorParams{
-		Namespace:         flags.Namespace,
-		Client:            mgr.GetClient(),
-		Scheme:            mgr.GetScheme(),
-		EventRecorder:     mgr.GetEventRecorderFor("ovirtprovider"),
-		CachedOVirtClient: oVirtClientService.NewCachedClient("actuator"),
+		Namespace:           flags.Namespace,
+		Client:              mgr.GetClient(),
+		Scheme:              mgr.GetScheme(),
+		EventRecorder:       mgr.GetEventRecorderFor("ovirtprovider"),
+		CachedOVirtClient:   sharedOVirtClient,
+		ClientPool:          oVirtClientPool,
+		ShutdownGracePeriod: flags.ShutdownGracePeriod,
 	}))
-	controller.NewProviderIDController(mgr.GetClient(), oVirtClientService.NewCachedClient("providerID")).AddToManager(mgr)
-	controller.NewNodeController(mgr.GetClient(), oVirtClientService.NewCachedClient("node")).AddToManager(mgr)
+	controller.NewProviderIDController(mgr.GetClient(), sharedOVirtClient, oVirtClientPool).AddToManager(mgr)
+	controller.NewNodeController(mgr.GetClient(), sharedOVirtClient, oVirtClientPool).AddToManager(mgr)
+	if flags.WebhookEnabled {
+		webhooks.Register(mgr.GetWebhookServer())
+	}
 
 	// start the service to receive secret updates and immediately return
 	oVirtClientService.Run(ctx)
@@ -91,6 +131,11 @@ func main() {
 	// shutdown oVirt client service
 	cancel()
 	oVirtClientService.Shutdown(3 * time.Second)
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), 3*time.Second)
+	if err := shutdownTracing(shutdownCtx); err != nil {
+		entryLog.Error(err, "Unable to flush traces")
+	}
+	cancelShutdown()
 
 	if err != nil {
 		entryLog.Error(err, "unable to run manager")
@@ -98,20 +143,35 @@ func main() {
 	}
 }
 
+// healthCheck fails if no oVirt client can be used. Rejected credentials don't fail the check
+// while the last known good client is still used, restarting the manager would drop that client.
 func healthCheck(cachedOVirtClient ovirt.CachedOVirtClient) func(*http.Request) error {
 	return func(req *http.Request) error {
 		logger := ovirt.NewKLogr("HealthzCheck")
 
 		_, err := cachedOVirtClient.Get()
 		if err != nil {
-			logger.Errorf("failed to get ovirt client: %v", err)
-			return err
+			state, _ := cachedOVirtClient.State()
+			logger.Errorf("failed to get ovirt client in state %s: %v", state, err)
+			return fmt.Errorf("oVirt client is %s: %w", state, err)
 		}
 
 		return nil
 	}
 }
 
+// credentialsCheck fails unless the oVirt client is Ready, so problems with the credentials are
+// reported without restarting the manager.
+func credentialsCheck(cachedOVirtClient ovirt.CachedOVirtClient) func(*http.Request) error {
+	return func(req *http.Request) error {
+		state, err := cachedOVirtClient.State()
+		if state != ovirt.ClientStateReady {
+			return fmt.Errorf("oVirt client is %s: %v", state, err)
+		}
+		return nil
+	}
+}
+
 type Flags struct {
 	Namespace string
 
@@ -121,6 +181,24 @@ type Flags struct {
 	LeaderElectResourceNamespace string
 	LeaderElect                  bool
 	LeaderElectLeaseDuration     time.Duration
+
+	ShutdownGracePeriod time.Duration
+
+	WebhookEnabled bool
+	WebhookPort    int
+	WebhookCertDir string
+
+	TrustedCAConfigMap string
+
+	CredentialsSecretSelector   string
+	CredentialsSecretNamespaces []string
+
+	OVirtHealthProbeInterval time.Duration
+	OVirtAPIQPS              float64
+	OVirtAPIBurst            int
+
+	TracingOTLPEndpoint string
+	TracingOTLPInsecure bool
 }
 
 func (f Flags) ToManagerOptions() manager.Options {
@@ -137,6 +215,10 @@ func (f Flags) ToManagerOptions() manager.Options {
 		RetryPeriod:   &retryPeriod,
 		RenewDeadline: &renewDeadline,
 	}
+	if f.WebhookEnabled {
+		opts.Port = f.WebhookPort
+		opts.CertDir = f.WebhookCertDir
+	}
 	if f.Namespace != "" {
 		opts.Namespace = f.Namespace
 		klog.Infof("Watching machine-api objects only in namespace %q for reconciliation.", opts.Namespace)
@@ -184,6 +266,78 @@ func parseFlags() Flags {
 		"The duration that non-leader candidates will wait after observing a leadership renewal until attempting to acquire leadership of a led but unrenewed leader slot. This is effectively the maximum duration that a leader can be stopped before it is replaced by another candidate. This is only applicable if leader election is enabled.",
 	)
 
+	shutdownGracePeriod := flag.Duration(
+		"shutdown-grace-period",
+		defaultShutdownGracePeriod,
+		"The time the guest OS of a VM is given to shut down gracefully when its machine is deleted, before the VM is powered off. Can be overridden per machine in the provider spec. 0 powers VMs off immediately.",
+	)
+
+	webhookEnabled := flag.Bool(
+		"webhook-enabled",
+		false,
+		"Serve the admission webhooks validating and defaulting the oVirt provider spec of Machines and MachineSets.",
+	)
+
+	webhookPort := flag.Int(
+		"webhook-port",
+		9443,
+		"The port the admission webhooks are served at.",
+	)
+
+	webhookCertDir := flag.String(
+		"webhook-cert-dir",
+		"/tmp/k8s-webhook-server/serving-certs",
+		"The directory containing the serving certificate tls.crt and key tls.key of the admission webhooks.",
+	)
+
+	trustedCAConfigMap := flag.String(
+		"trusted-ca-configmap",
+		"",
+		"The ConfigMap in the openshift-machine-api namespace containing the CA certificates trusted by the cluster, which are trusted by the oVirt clients in addition to the CA bundle of the credentials secret. If unspecified, only the CA bundle of the secret and the system CAs are trusted.",
+	)
+
+	credentialsSecretSelector := flag.String(
+		"credentials-secret-selector",
+		"",
+		"The label selector of the additional credentials secrets which provider specs may reference to place machines on other oVirt engines. If unspecified, only the default credentials secret is used.",
+	)
+
+	credentialsSecretNamespaces := flag.String(
+		"credentials-secret-namespaces",
+		"",
+		"Comma separated list of the namespaces the credentials secret selector is applied in. If unspecified, the secrets are selected in the openshift-machine-api namespace.",
+	)
+
+	oVirtHealthProbeInterval := flag.Duration(
+		"ovirt-health-probe-interval",
+		defaultOVirtHealthProbeInterval,
+		"The interval the connection to the oVirt engine is tested at in the background. A failed test rebuilds the client.",
+	)
+
+	oVirtAPIQPS := flag.Float64(
+		"ovirt-api-qps",
+		defaultOVirtAPIQPS,
+		"The sustained number of calls per second made to each oVirt engine. Calls exceeding the limit are requeued. 0 disables the rate limit.",
+	)
+
+	oVirtAPIBurst := flag.Int(
+		"ovirt-api-burst",
+		defaultOVirtAPIBurst,
+		"The number of calls which may be made to each oVirt engine at once, exceeding the QPS.",
+	)
+
+	tracingOTLPEndpoint := flag.String(
+		"tracing-otlp-endpoint",
+		"",
+		"The host and port of the OTLP HTTP endpoint the traces of the machine operations are exported to. If unspecified, tracing is disabled.",
+	)
+
+	tracingOTLPInsecure := flag.Bool(
+		"tracing-otlp-insecure",
+		false,
+		"Export the traces to the OTLP endpoint over HTTP instead of HTTPS.",
+	)
+
 	flag.Parse()
 
 	return Flags{
@@ -193,10 +347,37 @@ func parseFlags() Flags {
 		LeaderElectResourceNamespace: *leaderElectResourceNamespace,
 		LeaderElect:                  *leaderElect,
 		LeaderElectLeaseDuration:     *leaderElectLeaseDuration,
+		ShutdownGracePeriod:          *shutdownGracePeriod,
+		WebhookEnabled:               *webhookEnabled,
+		WebhookPort:                  *webhookPort,
+		WebhookCertDir:               *webhookCertDir,
+		TrustedCAConfigMap:           *trustedCAConfigMap,
+		CredentialsSecretSelector:    *credentialsSecretSelector,
+		CredentialsSecretNamespaces:  splitList(*credentialsSecretNamespaces),
+		OVirtHealthProbeInterval:     *oVirtHealthProbeInterval,
+		OVirtAPIQPS:                  *oVirtAPIQPS,
+		OVirtAPIBurst:                *oVirtAPIBurst,
+		TracingOTLPEndpoint:          *tracingOTLPEndpoint,
+		TracingOTLPInsecure:          *tracingOTLPInsecure,
 	}
 }
 
-func setupManager(cfg *rest.Config, options manager.Options, oVirtClientService ovirt.ClientService) (manager.Manager, error) {
+// splitList splits a comma separated flag value, omitting empty elements.
+func splitList(value string) []string {
+	var elements []string
+	for _, element := range strings.Split(value, ",") {
+		if element = strings.TrimSpace(element); element != "" {
+			elements = append(elements, element)
+		}
+	}
+	return elements
+}
+
+func setupManager(
+	cfg *rest.Config,
+	options manager.Options,
+	oVirtClientService ovirt.ClientService,
+	oVirtClient ovirt.CachedOVirtClient) (manager.Manager, error) {
 	mgr, err := manager.New(cfg, options)
 	if err != nil {
 		return nil, err
@@ -218,9 +399,15 @@ func setupManager(cfg *rest.Config, options manager.Options, oVirtClientService
 		return nil, fmt.Errorf("failed to add ready check to controller manager: %v", err)
 	}
 
-	if err := mgr.AddHealthzCheck("ping", healthCheck(oVirtClientService.NewCachedClient("healthz"))); err != nil {
+	if err := mgr.AddHealthzCheck("ping", healthCheck(oVirtClient)); err != nil {
 		return nil, fmt.Errorf("failed to add health check to controller manager: %v", err)
 	}
 
+	if err := mgr.AddReadyzCheck("ovirt-credentials", credentialsCheck(oVirtClient)); err != nil {
+		return nil, fmt.Errorf("failed to add ready check to controller manager: %v", err)
+	}
+
+	oVirtClientService.WithEventRecorder(mgr.GetEventRecorderFor("ovirt-client-service"))
+
 	return mgr, nil
 }
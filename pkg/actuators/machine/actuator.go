@@ -7,15 +7,20 @@ package machine
 
 import (
 	"context"
+	"fmt"
+	"strings"
+	"time"
 
 	machinev1 "github.com/openshift/api/machine/v1beta1"
 	"github.com/openshift/client-go/machine/clientset/versioned/typed/machine/v1beta1"
 	ovirtconfigv1 "github.com/openshift/cluster-api-provider-ovirt/pkg/apis/ovirtprovider/v1beta1"
 	"github.com/openshift/cluster-api-provider-ovirt/pkg/ovirt"
 	apierrors "github.com/openshift/machine-api-operator/pkg/controller/machine"
+	ovirtC "github.com/ovirt/go-ovirt-client/v2"
 	"github.com/pkg/errors"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/tools/record"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
@@ -28,6 +33,12 @@ type ActuatorParams struct {
 	MachinesClient    v1beta1.MachineV1beta1Interface
 	EventRecorder     record.EventRecorder
 	CachedOVirtClient ovirt.CachedOVirtClient
+	// ClientPool provides the clients of machines with a CredentialsSecret in their provider spec,
+	// machines without one use the CachedOVirtClient.
+	ClientPool ovirt.ClientPool
+	// ShutdownGracePeriod is the default time the guest OS is given to shut down when a machine is deleted.
+	// It is overridden by the ShutdownGracePeriodSeconds of the provider spec.
+	ShutdownGracePeriod time.Duration
 }
 
 // OvirtActuator is responsible for performing machine reconciliation on oVirt platform.
@@ -38,6 +49,7 @@ type OvirtActuator struct {
 	client            client.Client
 	eventRecorder     record.EventRecorder
 	cachedOVirtClient ovirt.CachedOVirtClient
+	clientPool        ovirt.ClientPool
 }
 
 // NewActuator returns an Ovirt Actuator.
@@ -49,37 +61,61 @@ func NewActuator(params ActuatorParams) *OvirtActuator {
 		scheme:            params.Scheme,
 		eventRecorder:     params.EventRecorder,
 		cachedOVirtClient: params.CachedOVirtClient,
+		clientPool:        params.ClientPool,
 	}
 }
 
 // Create creates a VM on oVirt platform from the machine object and is invoked by the machine controller.
 // Machine should be a valid machine object, in case a validation error occurs an InvalidMachineConfiguration
 // error is returned and the Machine object will move to Failed state
-func (actuator *OvirtActuator) Create(ctx context.Context, machine *machinev1.Machine) error {
+func (actuator *OvirtActuator) Create(ctx context.Context, machine *machinev1.Machine) (err error) {
+	defer func() { recordMachineOperation("create", err) }()
+	ctx, span := startMachineSpan(ctx, "Create", machine)
+	defer func() { endSpan(span, err) }()
+
 	providerSpec, err := ovirtconfigv1.ProviderSpecFromRawExtension(machine.Spec.ProviderSpec.Value)
 	if err != nil {
 		return actuator.handleMachineError(machine, "Create", apierrors.InvalidMachineConfiguration(
 			"cannot unmarshal machineProviderSpec field: %v", err))
 	}
 
-	ovirtClient, err := actuator.cachedOVirtClient.Get()
+	ovirtClient, err := actuator.getOVirtClient(ctx, machine, providerSpec)
 	if err != nil {
-		return actuator.handleMachineError(machine, "Create", apierrors.InvalidMachineConfiguration(
+		// the credentials secret may not be synced yet, or the engine may be unreachable
+		return actuator.handleMachineError(machine, "Create", apierrors.CreateMachine(
 			"failed to create connection to oVirt API: %v", err))
 	}
 
-	if err := validateMachine(ovirtClient, providerSpec); err != nil {
-		return actuator.handleMachineError(machine, "Create", apierrors.InvalidMachineConfiguration(
+	if err := resolveReferences(ovirtClient, providerSpec, ovirtC.ContextStrategy(ctx)); err != nil {
+		if isInvalidReference(err) {
+			return actuator.handleMachineError(machine, "Create", apierrors.InvalidMachineConfiguration(
+				"error resolving machine references: %v", err))
+		}
+		return actuator.handleEngineError(machine, "Create", err, apierrors.CreateMachine(
+			"error resolving machine references: %v", err))
+	}
+
+	if err := validateMachine(ovirtClient, providerSpec, MachineProviderSpecPath, ovirtC.ContextStrategy(ctx)); err != nil {
+		return actuator.handleEngineError(machine, "Create", err, apierrors.InvalidMachineConfiguration(
 			"error validating machine fields: %v", err))
 	}
 
 	mScope := newMachineScope(ctx, ovirtClient, actuator.client, machine, providerSpec)
 	if err := mScope.create(); err != nil {
+		actuator.patchConditions(ctx, mScope)
+		if requeueErr := actuator.requeueIfThrottled(machine, err); requeueErr != nil {
+			return requeueErr
+		}
+		if isPreflightError(err) {
+			return actuator.handleMachineError(machine, "Create", apierrors.InvalidMachineConfiguration(
+				"error validating machine against oVirt: %v", err))
+		}
 		return actuator.handleMachineError(machine, "Create", apierrors.CreateMachine(
 			"error creating Machine %v", err))
 	}
 	if err := mScope.reconcileMachine(ctx); err != nil {
-		return actuator.handleMachineError(machine, "Create", apierrors.CreateMachine(
+		actuator.patchConditions(ctx, mScope)
+		return actuator.handleEngineError(machine, "Create", err, apierrors.CreateMachine(
 			"error reconciling Machine %v", err))
 	}
 	if err := mScope.patchMachine(ctx); err != nil {
@@ -91,8 +127,13 @@ func (actuator *OvirtActuator) Create(ctx context.Context, machine *machinev1.Ma
 }
 
 // Update attempts to sync machine state with an existing instance.
-// Updating provider fields is not supported, a new machine should be created instead
-func (actuator *OvirtActuator) Update(ctx context.Context, machine *machinev1.Machine) error {
+// Changes of the CPU, memory and OS disk size are applied to the existing instance, changes which
+// require a reboot are recorded in the provider status. Updating other provider fields is not supported,
+// a new machine should be created instead
+func (actuator *OvirtActuator) Update(ctx context.Context, machine *machinev1.Machine) (err error) {
+	ctx, span := startMachineSpan(ctx, "Update", machine)
+	defer func() { endSpan(span, err) }()
+
 	// eager update
 	providerSpec, err := ovirtconfigv1.ProviderSpecFromRawExtension(machine.Spec.ProviderSpec.Value)
 	if err != nil {
@@ -100,16 +141,32 @@ func (actuator *OvirtActuator) Update(ctx context.Context, machine *machinev1.Ma
 			"cannot unmarshal machineProviderSpec field: %v", err))
 	}
 
-	ovirtClient, err := actuator.cachedOVirtClient.Get()
+	ovirtClient, err := actuator.getOVirtClient(ctx, machine, providerSpec)
 	if err != nil {
 		return actuator.handleMachineError(machine, "Update", apierrors.UpdateMachine(
 			"failed to create connection to oVirt API %v", err))
 	}
 
+	if err := resolveReferences(ovirtClient, providerSpec, ovirtC.ContextStrategy(ctx)); err != nil {
+		if isInvalidReference(err) {
+			return actuator.handleMachineError(machine, "Update", apierrors.InvalidMachineConfiguration(
+				"error resolving machine references: %v", err))
+		}
+		return actuator.handleEngineError(machine, "Update", err, apierrors.UpdateMachine(
+			"error resolving machine references: %v", err))
+	}
+
 	mScope := newMachineScope(ctx, ovirtClient, actuator.client, machine, providerSpec)
 
+	if err := mScope.traceStep("reconcileVerticalResize", mScope.reconcileVerticalResize); err != nil {
+		actuator.patchConditions(ctx, mScope)
+		return actuator.handleEngineError(machine, "Update", err, apierrors.UpdateMachine(
+			"error resizing Machine %v", err))
+	}
+
 	if err := mScope.reconcileMachine(ctx); err != nil {
-		return actuator.handleMachineError(machine, "Update", apierrors.UpdateMachine(
+		actuator.patchConditions(ctx, mScope)
+		return actuator.handleEngineError(machine, "Update", err, apierrors.UpdateMachine(
 			"error reconciling Machine %v", err))
 	}
 
@@ -124,10 +181,18 @@ func (actuator *OvirtActuator) Update(ctx context.Context, machine *machinev1.Ma
 
 // Exists determines if the given machine currently exists.
 // A machine which is not terminated is considered as existing.
-func (actuator *OvirtActuator) Exists(ctx context.Context, machine *machinev1.Machine) (bool, error) {
+func (actuator *OvirtActuator) Exists(ctx context.Context, machine *machinev1.Machine) (exists bool, err error) {
+	ctx, span := startMachineSpan(ctx, "Exists", machine)
+	defer func() { endSpan(span, err) }()
+
 	actuator.logger.Infof("Checking machine %v exists.", machine.Name)
 
-	ovirtClient, err := actuator.cachedOVirtClient.Get()
+	// the provider spec is only needed to find the engine of the machine
+	providerSpec, err := ovirtconfigv1.ProviderSpecFromRawExtension(machine.Spec.ProviderSpec.Value)
+	if err != nil {
+		providerSpec = nil
+	}
+	ovirtClient, err := actuator.getOVirtClient(ctx, machine, providerSpec)
 	if err != nil {
 		return false, actuator.handleMachineError(machine, "Exists", apierrors.InvalidMachineConfiguration(
 			"failed to create connection to oVirt API: %v", err))
@@ -137,25 +202,152 @@ func (actuator *OvirtActuator) Exists(ctx context.Context, machine *machinev1.Ma
 	return mScope.exists()
 }
 
-// Delete deletes the VM from the RHV environment
-func (actuator *OvirtActuator) Delete(ctx context.Context, machine *machinev1.Machine) error {
+// Delete deletes the VM from the RHV environment.
+// The VM is only deleted if it belongs to the cluster, otherwise it is left untouched and a Warning event is emitted.
+func (actuator *OvirtActuator) Delete(ctx context.Context, machine *machinev1.Machine) (err error) {
+	defer func() { recordMachineOperation("delete", err) }()
+	ctx, span := startMachineSpan(ctx, "Delete", machine)
+	defer func() { endSpan(span, err) }()
+
 	actuator.logger.Infof("Deleting machine %v.", machine.Name)
 
-	ovirtClient, err := actuator.cachedOVirtClient.Get()
+	// an invalid provider spec doesn't block the deletion, the defaults are used instead
+	providerSpec, err := ovirtconfigv1.ProviderSpecFromRawExtension(machine.Spec.ProviderSpec.Value)
+	if err != nil {
+		actuator.logger.Errorf("failed to read provider spec of machine %s, using the defaults: %v", machine.Name, err)
+		providerSpec = nil
+	}
+
+	ovirtClient, err := actuator.getOVirtClient(ctx, machine, providerSpec)
 	if err != nil {
 		return actuator.handleMachineError(machine, "Delete", apierrors.InvalidMachineConfiguration(
 			"failed to create connection to oVirt API: %v", err))
 	}
 
-	mScope := newMachineScope(ctx, ovirtClient, actuator.client, machine, nil)
+	mScope := newMachineScope(ctx, ovirtClient, actuator.client, machine, providerSpec)
+	mScope.shutdownGracePeriod = actuator.shutdownGracePeriod(providerSpec)
 	if err := mScope.delete(); err != nil {
-		return actuator.handleMachineError(machine, "Deleted", apierrors.UpdateMachine(
-			"error deleting oVirt instance %v", err))
+		actuator.patchConditions(ctx, mScope)
+		switch {
+		case isEngineThrottled(err):
+			return actuator.requeueIfThrottled(machine, err)
+		case isVMNameCollision(err):
+			// the VM with the name of the machine was never created for it, there is nothing to delete
+			actuator.eventRecorder.Eventf(machine, corev1.EventTypeWarning, "DeleteSkipped",
+				"Not deleting VM of another cluster: %v", err)
+		case isVMOwnershipError(err):
+			return actuator.handleMachineError(machine, "DeleteRefused", apierrors.DeleteMachine(
+				"VM ownership verification failed: %v", err))
+		default:
+			return actuator.handleMachineError(machine, "Deleted", apierrors.UpdateMachine(
+				"error deleting oVirt instance %v", err))
+		}
+	}
+	if retained := mScope.retainedDisks(); len(retained) > 0 {
+		actuator.eventRecorder.Eventf(machine, corev1.EventTypeNormal, "DisksRetained", "Retained disks %s of Machine %v",
+			strings.Join(retained, ", "), machine.Name)
 	}
+	vmStatuses.remove(types.NamespacedName{Namespace: machine.Namespace, Name: machine.Name})
 	actuator.eventRecorder.Eventf(machine, corev1.EventTypeNormal, "Deleted", "Deleted Machine %v", machine.Name)
 	return nil
 }
 
+// getOVirtClient returns the client of the engine the machine is placed on. Machines with a CredentialsSecret
+// in their provider spec use the engine of the secret, which is read from the namespace of the machine,
+// all other machines use the engine of the default credentials.
+func (actuator *OvirtActuator) getOVirtClient(
+	ctx context.Context,
+	machine *machinev1.Machine,
+	providerSpec *ovirtconfigv1.OvirtMachineProviderSpec) (ovirtC.Client, error) {
+	if providerSpec == nil || providerSpec.CredentialsSecret == nil || providerSpec.CredentialsSecret.Name == "" {
+		return actuator.cachedOVirtClient.Get()
+	}
+	if actuator.clientPool == nil {
+		return nil, fmt.Errorf("credentials secret %s is set, but no client pool is configured",
+			providerSpec.CredentialsSecret.Name)
+	}
+	return actuator.clientPool.Get(ctx, types.NamespacedName{
+		Namespace: machine.Namespace,
+		Name:      providerSpec.CredentialsSecret.Name,
+	})
+}
+
+// shutdownGracePeriod returns the grace period of the provider spec, or the default grace period of the
+// actuator if the provider spec doesn't set one.
+func (actuator *OvirtActuator) shutdownGracePeriod(providerSpec *ovirtconfigv1.OvirtMachineProviderSpec) time.Duration {
+	if providerSpec == nil || providerSpec.ShutdownGracePeriodSeconds == nil {
+		return actuator.params.ShutdownGracePeriod
+	}
+	return time.Duration(*providerSpec.ShutdownGracePeriodSeconds) * time.Second
+}
+
+// patchConditions persists the provider status conditions recorded by the machine scope before
+// a failed step, so that the failing step can be identified from the Machine object.
+func (actuator *OvirtActuator) patchConditions(ctx context.Context, mScope *machineScope) {
+	if actuator.client == nil {
+		return
+	}
+	if err := mScope.patchMachine(ctx); err != nil {
+		actuator.logger.Errorf("failed to patch conditions of machine %s: %v", mScope.machine.Name, err)
+	}
+}
+
+// isEngineThrottled returns true if the error was caused by a call the client didn't make to the engine
+// because of the rate limit or circuit breaker.
+func isEngineThrottled(err error) bool {
+	_, ok := ovirt.IsEngineThrottled(err)
+	return ok
+}
+
+// requeueIfThrottled returns a RequeueAfterError if the error was caused by a throttled call to the engine,
+// so the machine is reconciled again once the engine accepts calls instead of being failed.
+// It returns nil for all other errors.
+func (actuator *OvirtActuator) requeueIfThrottled(machine *machinev1.Machine, err error) error {
+	throttledErr, ok := ovirt.IsEngineThrottled(err)
+	if !ok {
+		return nil
+	}
+	actuator.logger.Infof("requeuing machine %s after %s: %v", machine.Name, throttledErr.RetryAfter, err)
+	return &requeueError{
+		requeue: &apierrors.RequeueAfterError{RequeueAfter: throttledErr.RetryAfter},
+		cause:   err,
+	}
+}
+
+// requeueError is a RequeueAfterError which keeps the error that caused the requeue, so the cause can
+// be told from the error returned to the machine controller.
+type requeueError struct {
+	requeue *apierrors.RequeueAfterError
+	cause   error
+}
+
+func (e *requeueError) Error() string {
+	return fmt.Sprintf("%s: %v", e.requeue.Error(), e.cause)
+}
+
+func (e *requeueError) Unwrap() error {
+	return e.cause
+}
+
+// As makes the error a RequeueAfterError for the machine controller.
+func (e *requeueError) As(target interface{}) bool {
+	if requeueErr, ok := target.(**apierrors.RequeueAfterError); ok {
+		*requeueErr = e.requeue
+		return true
+	}
+	return false
+}
+
+// handleEngineError requeues the machine if the error was caused by a throttled call to the engine,
+// otherwise it is handled by handleMachineError.
+func (actuator *OvirtActuator) handleEngineError(
+	machine *machinev1.Machine, reason string, cause error, err *apierrors.MachineError) error {
+	if requeueErr := actuator.requeueIfThrottled(machine, cause); requeueErr != nil {
+		return requeueErr
+	}
+	return actuator.handleMachineError(machine, reason, err)
+}
+
 // If the OvirtActuator has a client for updating Machine objects, this will set
 // the appropriate reason/message on the Machine.Status. If not, such as during
 // cluster installation, it will operate as a no-op. It also returns the
@@ -0,0 +1,560 @@
+package machine
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	ovirtconfigv1 "github.com/openshift/cluster-api-provider-ovirt/pkg/apis/ovirtprovider/v1beta1"
+	"github.com/openshift/cluster-api-provider-ovirt/pkg/ovirt"
+	ovirtsdk "github.com/ovirt/go-ovirt"
+	ovirtC "github.com/ovirt/go-ovirt-client/v2"
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+)
+
+// createStep is a single step of the VM creation. The completion of a step is recorded in its condition
+// of the provider status. Steps have to be idempotent: they verify the live VM and only repair what is
+// missing, so that a creation which was interrupted at any point can be resumed.
+type createStep struct {
+	condition string
+	run       func(instance ovirtC.VM) error
+}
+
+// createSteps returns the steps executed after the VM has been created from the template, in order.
+func (ms *machineScope) createSteps() []createStep {
+	return []createStep{
+		{condition: ovirtconfigv1.VMCreatedCondition, run: ms.configureVMType},
+		{condition: ovirtconfigv1.DiskResizedCondition, run: ms.reconcileOSDisk},
+		{condition: ovirtconfigv1.AdditionalDisksAttachedCondition, run: ms.reconcileAdditionalDisks},
+		{condition: ovirtconfigv1.NICsAttachedCondition, run: ms.reconcileNICs},
+		{condition: ovirtconfigv1.NetworkConfiguredCondition, run: ms.reconcileStaticIPs},
+		{condition: ovirtconfigv1.TagAssignedCondition, run: ms.reconcileTag},
+		{condition: ovirtconfigv1.AffinityAppliedCondition, run: ms.reconcileAffinity},
+		{condition: ovirtconfigv1.VMStartedCondition, run: ms.reconcileVMStarted},
+	}
+}
+
+// create creates an oVirt VM from the machine object if it does not exists.
+// If the VM already exists, the creation resumes from the first step whose condition isn't true yet.
+// Each completed step is persisted as a checkpoint in the provider status.
+func (ms *machineScope) create() error {
+	var instance ovirtC.VM
+	err := ms.traceStep("ensureVM", func() (err error) {
+		instance, err = ms.ensureVM()
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, step := range ms.createSteps() {
+		if ms.isConditionTrue(step.condition) {
+			ms.logger.Debugf("Skipping completed step %s of VM %s", step.condition, instance.ID())
+			continue
+		}
+		if err := ms.traceStep(step.condition, func() error { return step.run(instance) }); err != nil {
+			return ms.markConditionFailed(step.condition, err)
+		}
+		ms.checkpoint()
+	}
+	return nil
+}
+
+// ensureVM returns the VM of the machine and creates it from the template if it doesn't exist yet.
+// Checkpoints of a previous creation attempt are discarded when the VM has to be created again.
+func (ms *machineScope) ensureVM() (ovirtC.VM, error) {
+	instance, err := ms.getVM()
+	if err == nil {
+		ms.logger.Infof("VM %s already exists, resuming creation.", instance.ID())
+		// wait for the disks of the VM to be copied from the template
+		if instance.Status() == ovirtC.VMStatusImageLocked {
+			if instance, err = ms.ovirtClient.WaitForVMStatus(instance.ID(), ovirtC.VMStatusDown, ovirtC.ContextStrategy(ms.Context)); err != nil {
+				return nil, ms.markConditionFailed(ovirtconfigv1.VMCreatedCondition,
+					errors.Wrap(err, "error creating oVirt VM"))
+			}
+		}
+		return instance, nil
+	}
+	if !isVMNotFound(err) {
+		return nil, err
+	}
+	ms.resetConditions()
+
+	// the preflight resolves the template, which is reused for creating the VM
+	var template ovirtC.Template
+	err = ms.traceStep("preflight", func() (err error) {
+		template, err = ms.preflight()
+		return err
+	})
+	if err != nil {
+		if isPreflightError(err) {
+			return nil, ms.markConditionFalse(ovirtconfigv1.PreflightPassedCondition,
+				ovirtconfigv1.ConditionReasonInvalidConfiguration, err)
+		}
+		return nil, ms.markConditionFailed(ovirtconfigv1.PreflightPassedCondition,
+			errors.Wrap(err, "error running preflight checks"))
+	}
+	ms.markConditionTrue(ovirtconfigv1.PreflightPassedCondition, ovirtconfigv1.ConditionReasonSucceeded,
+		"provider spec matches the engine")
+	ms.markConditionTrue(ovirtconfigv1.TemplateResolvedCondition, ovirtconfigv1.ConditionReasonSucceeded,
+		"template %s resolved to %s", template.Name(), template.ID())
+
+	// Add ignition to the VM params
+	ignition, err := ms.getIgnition()
+	if err != nil {
+		return nil, errors.Wrap(err, "error getting VM ignition")
+	}
+
+	optionalVMParams, err := ms.buildOptionalVMParameters(string(ignition), template.ID())
+	if err != nil {
+		return nil, ms.markConditionFailed(ovirtconfigv1.VMCreatedCondition,
+			errors.Wrapf(err, "error building parameters for VM creation"))
+	}
+
+	instance, err = ms.ovirtClient.CreateVM(ovirtC.ClusterID(ms.machineProviderSpec.ClusterId),
+		template.ID(),
+		ms.machine.Name,
+		optionalVMParams, ovirtC.ContextStrategy(ms.Context))
+	if err != nil {
+		return nil, ms.markConditionFailed(ovirtconfigv1.VMCreatedCondition,
+			errors.Wrap(err, "error creating Ovirt instance"))
+	}
+	if err := ms.reconcileMachineProviderStatus(instance); err != nil {
+		return nil, errors.Wrap(err, "error reconciling machine provider status")
+	}
+	ms.checkpoint()
+
+	// Wait till ready
+	err = ms.traceStep("waitForDisksCopied", func() (err error) {
+		instance, err = ms.ovirtClient.WaitForVMStatus(instance.ID(), ovirtC.VMStatusDown, ovirtC.ContextStrategy(ms.Context))
+		return err
+	})
+	if err != nil {
+		return nil, ms.markConditionFailed(ovirtconfigv1.VMCreatedCondition,
+			errors.Wrap(err, "error creating oVirt VM"))
+	}
+	return instance, nil
+}
+
+// configureVMType applies the settings of the VM type which can't be passed on VM creation.
+func (ms *machineScope) configureVMType(instance ovirtC.VM) error {
+	// apply high_performance rules
+	// see: https://access.redhat.com/documentation/en-us/red_hat_virtualization/4.4/html-single/virtual_machine_management_guide/index?extIdCarryOver=true&sc_cid=701f2000001Css5AAC#Automatic_High_Performance_Configuration_Settings
+	if ms.machineProviderSpec.VMType == string(ovirtC.VMTypeHighPerformance) {
+		graphicsConsoles, err := ms.ovirtClient.ListVMGraphicsConsoles(instance.ID(), ovirtC.ContextStrategy(ms.Context))
+		if err != nil {
+			return errors.Wrapf(err, "failed to list graphics consoles")
+		}
+		for _, graphicsConsole := range graphicsConsoles {
+			err := ms.ovirtClient.RemoveVMGraphicsConsole(instance.ID(), graphicsConsole.ID(),
+				ovirtC.ContextStrategy(ms.Context))
+			if err != nil && !ovirtC.HasErrorCode(err, ovirtC.ENotFound) {
+				return errors.Wrapf(err, "failed to remove graphics console '%s' from VM '%s'",
+					graphicsConsole.ID(), graphicsConsole.VMID())
+			}
+		}
+	}
+	ms.markConditionTrue(ovirtconfigv1.VMCreatedCondition, ovirtconfigv1.ConditionReasonSucceeded,
+		"VM %s created", instance.ID())
+	return nil
+}
+
+// reconcileOSDisk extends the OS disk and records the storage domain it is located on.
+func (ms *machineScope) reconcileOSDisk(instance ovirtC.VM) error {
+	osDisk, err := ms.extendOSDisk(instance)
+	if err != nil {
+		return err
+	}
+	if osDisk == nil {
+		ms.markConditionTrue(ovirtconfigv1.DiskResizedCondition, ovirtconfigv1.ConditionReasonNotRequested,
+			"no OS disk size requested")
+		return nil
+	}
+	if storageDomainIDs := osDisk.StorageDomainIDs(); len(storageDomainIDs) > 0 {
+		storageDomainID := string(storageDomainIDs[0])
+		ms.updateProviderStatusOrLog(func(status *ovirtconfigv1.OvirtMachineProviderStatus) {
+			status.StorageDomainID = &storageDomainID
+		})
+	}
+	ms.markConditionTrue(ovirtconfigv1.DiskResizedCondition, ovirtconfigv1.ConditionReasonSucceeded,
+		"OS disk %s has %d bytes", osDisk.ID(), osDisk.ProvisionedSize())
+	return nil
+}
+
+// reconcileAdditionalDisks creates the additional disks of the provider spec and attaches them to the VM.
+// Disks are identified by their alias, disks which are already attached to the VM are kept.
+func (ms *machineScope) reconcileAdditionalDisks(instance ovirtC.VM) error {
+	if len(ms.machineProviderSpec.AdditionalDisks) == 0 {
+		ms.markConditionTrue(ovirtconfigv1.AdditionalDisksAttachedCondition, ovirtconfigv1.ConditionReasonNotRequested,
+			"no additional disks requested")
+		return nil
+	}
+
+	diskAttachments, err := ms.ovirtClient.ListDiskAttachments(instance.ID(), ovirtC.ContextStrategy(ms.Context))
+	if err != nil {
+		return errors.Wrapf(err, "failed to list disk attachments for VM %s", instance.ID())
+	}
+	attachedAliases := make(map[string]bool, len(diskAttachments))
+	for _, diskAttachment := range diskAttachments {
+		disk, err := ms.ovirtClient.GetDisk(diskAttachment.DiskID(), ovirtC.ContextStrategy(ms.Context))
+		if err != nil {
+			return errors.Wrapf(err, "failed to get disk %s of VM %s", diskAttachment.DiskID(), instance.ID())
+		}
+		attachedAliases[disk.Alias()] = true
+	}
+
+	for i, additionalDisk := range ms.machineProviderSpec.AdditionalDisks {
+		alias := ms.additionalDiskAlias(i)
+		if attachedAliases[alias] {
+			continue
+		}
+		if err := ms.createAdditionalDisk(instance, alias, additionalDisk); err != nil {
+			return err
+		}
+	}
+	ms.markConditionTrue(ovirtconfigv1.AdditionalDisksAttachedCondition, ovirtconfigv1.ConditionReasonSucceeded,
+		"%d additional disks attached", len(ms.machineProviderSpec.AdditionalDisks))
+	return nil
+}
+
+// additionalDiskAlias returns the alias of the additional disk at the given index of the provider spec.
+func (ms *machineScope) additionalDiskAlias(index int) string {
+	if alias := ms.machineProviderSpec.AdditionalDisks[index].Alias; alias != "" {
+		return alias
+	}
+	return fmt.Sprintf("%s-disk%d", ms.machine.Name, index+1)
+}
+
+// createAdditionalDisk creates a disk from the additional disk of the provider spec and attaches it to the VM
+// as a non-bootable disk.
+func (ms *machineScope) createAdditionalDisk(instance ovirtC.VM, alias string, additionalDisk ovirtconfigv1.AdditionalDisk) error {
+	storageDomainID := additionalDisk.StorageDomainId
+	if storageDomainID == "" {
+		storageDomainID = ms.machineProviderSpec.StorageDomainId
+	}
+	format := ovirtC.ImageFormatCow
+	if additionalDisk.Format != "" {
+		format = ovirtC.ImageFormat(additionalDisk.Format)
+	}
+	sparse := true
+	if additionalDisk.Sparse != nil {
+		sparse = *additionalDisk.Sparse
+	}
+	diskInterface := ovirtC.DiskInterfaceVirtIOSCSI
+	if additionalDisk.Interface != "" {
+		diskInterface = ovirtC.DiskInterface(additionalDisk.Interface)
+	}
+
+	ms.logger.Infof("Creating additional disk %s for VM %s.", alias, instance.ID())
+	disk, err := ms.ovirtClient.CreateDisk(
+		ovirtC.StorageDomainID(storageDomainID),
+		format,
+		uint64(additionalDisk.SizeGB*int64(math.Pow(2, 30))),
+		ovirtC.CreateDiskParams().MustWithAlias(alias).MustWithSparse(sparse),
+		ovirtC.ContextStrategy(ms.Context))
+	if err != nil {
+		return errors.Wrapf(err, "failed to create additional disk %s", alias)
+	}
+	_, err = ms.ovirtClient.CreateDiskAttachment(
+		instance.ID(),
+		disk.ID(),
+		diskInterface,
+		ovirtC.CreateDiskAttachmentParams().MustWithBootable(false).MustWithActive(true),
+		ovirtC.ContextStrategy(ms.Context))
+	if err != nil {
+		return errors.Wrapf(err, "failed to attach additional disk %s to VM %s", alias, instance.ID())
+	}
+	return nil
+}
+
+// desiredNIC is a network interface of the provider spec together with its resolved vNic profile.
+type desiredNIC struct {
+	profileID ovirtC.VNICProfileID
+	spec      *ovirtconfigv1.NetworkInterface
+}
+
+// nicHardware is the MAC address and the interface model of a NIC of the VM.
+type nicHardware struct {
+	mac   string
+	model string
+}
+
+// reconcileNICs replaces the NICs of the template with the network interfaces of the provider spec.
+// NICs which already match the provider spec, including the requested MAC address and interface model,
+// are kept. NICs which differ are removed and recreated.
+func (ms *machineScope) reconcileNICs(instance ovirtC.VM) error {
+	if len(ms.machineProviderSpec.NetworkInterfaces) == 0 {
+		ms.markConditionTrue(ovirtconfigv1.NICsAttachedCondition, ovirtconfigv1.ConditionReasonNotRequested,
+			"NICs of the template are used")
+		return nil
+	}
+
+	datacenter, err := ms.clusterDatacenter()
+	if err != nil {
+		return err
+	}
+	desiredNICs := make(map[string]desiredNIC, len(ms.machineProviderSpec.NetworkInterfaces))
+	for i, nic := range ms.machineProviderSpec.NetworkInterfaces {
+		profileID, err := resolveVNICProfileID(ms.ovirtClient, datacenter, nic, ovirtC.ContextStrategy(ms.Context))
+		if err != nil {
+			return errors.Wrapf(err, "failed to resolve vNic profile of NIC %s", ms.nicName(i))
+		}
+		desiredNICs[ms.nicName(i)] = desiredNIC{profileID: profileID, spec: nic}
+	}
+
+	nics, err := ms.ovirtClient.ListNICs(instance.ID(), ovirtC.ContextStrategy(ms.Context))
+	if err != nil {
+		return errors.Wrapf(err, "failed to list NICs on VM %s", instance.ID())
+	}
+	hardware, err := ms.listNICHardware(instance)
+	if err != nil {
+		return err
+	}
+
+	// remove all the nics from the VM instance which don't match the machinespec
+	existingNICs := make(map[string]bool, len(nics))
+	for _, nic := range nics {
+		if desired, ok := desiredNICs[nic.Name()]; ok && desired.matches(nic, hardware) {
+			existingNICs[nic.Name()] = true
+			continue
+		}
+		err := ms.ovirtClient.RemoveNIC(instance.ID(), nic.ID(), ovirtC.ContextStrategy(ms.Context))
+		if err != nil && !ovirtC.HasErrorCode(err, ovirtC.ENotFound) {
+			return errors.Wrapf(err, "failed to remove NIC %s", nic.ID())
+		}
+	}
+
+	// create the missing NICs according to the machinespec
+	for i, nic := range ms.machineProviderSpec.NetworkInterfaces {
+		name := ms.nicName(i)
+		if existingNICs[name] {
+			continue
+		}
+		if err := ms.createNIC(instance, name, desiredNICs[name].profileID, nic); err != nil {
+			return errors.Wrapf(err, "failed to create NIC %s", name)
+		}
+	}
+	ms.markConditionTrue(ovirtconfigv1.NICsAttachedCondition, ovirtconfigv1.ConditionReasonSucceeded,
+		"%d NICs attached", len(ms.machineProviderSpec.NetworkInterfaces))
+	return nil
+}
+
+// matches returns true if the NIC of the VM has the vNic profile of the network interface and, if requested,
+// its MAC address and interface model. A NIC whose hardware is unknown doesn't match a network interface
+// requesting a MAC address or interface model.
+func (d desiredNIC) matches(nic ovirtC.NIC, hardware map[ovirtC.NICID]nicHardware) bool {
+	if nic.VNICProfileID() != d.profileID {
+		return false
+	}
+	if d.spec.MAC == "" && d.spec.Interface == "" {
+		return true
+	}
+	actual, ok := hardware[nic.ID()]
+	if !ok {
+		return false
+	}
+	if d.spec.MAC != "" && !strings.EqualFold(actual.mac, d.spec.MAC) {
+		return false
+	}
+	return d.spec.Interface == "" || actual.model == d.spec.Interface
+}
+
+// listNICHardware returns the MAC addresses and interface models of the NICs of the VM. The go-ovirt-client
+// doesn't return them, therefore the underlying oVirt SDK connection is used. They are only listed if
+// a network interface of the provider spec requests a MAC address or interface model.
+func (ms *machineScope) listNICHardware(instance ovirtC.VM) (map[ovirtC.NICID]nicHardware, error) {
+	requested := false
+	for _, nic := range ms.machineProviderSpec.NetworkInterfaces {
+		requested = requested || nic.MAC != "" || nic.Interface != ""
+	}
+	legacyClient, ok := ms.ovirtClient.(ovirtC.ClientWithLegacySupport)
+	if !requested || !ok {
+		return nil, nil
+	}
+
+	var response *ovirtsdk.VmNicsServiceListResponse
+	err := ovirt.CallSDK(ms.Context, legacyClient, "ListNICs", func(conn *ovirtsdk.Connection) (err error) {
+		response, err = conn.SystemService().VmsService().VmService(string(instance.ID())).
+			NicsService().
+			List().
+			Send()
+		return err
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to list NICs on VM %s", instance.ID())
+	}
+	hardware := map[ovirtC.NICID]nicHardware{}
+	for _, nic := range response.MustNics().Slice() {
+		id, ok := nic.Id()
+		if !ok {
+			continue
+		}
+		var actual nicHardware
+		if mac, ok := nic.Mac(); ok {
+			actual.mac, _ = mac.Address()
+		}
+		if model, ok := nic.Interface(); ok {
+			actual.model = string(model)
+		}
+		hardware[ovirtC.NICID(id)] = actual
+	}
+	return hardware, nil
+}
+
+// nicName returns the name of the network interface at the given index of the provider spec.
+func (ms *machineScope) nicName(index int) string {
+	if name := ms.machineProviderSpec.NetworkInterfaces[index].Name; name != "" {
+		return name
+	}
+	return fmt.Sprintf("nic%d", index+1)
+}
+
+// createNIC creates the network interface of the provider spec on the VM. The go-ovirt-client doesn't
+// support setting the MAC address and the interface model, therefore the underlying oVirt SDK connection
+// is used if one of them is requested.
+func (ms *machineScope) createNIC(instance ovirtC.VM, name string, profileID ovirtC.VNICProfileID, nic *ovirtconfigv1.NetworkInterface) error {
+	if nic.MAC == "" && nic.Interface == "" {
+		_, err := ms.ovirtClient.CreateNIC(instance.ID(), profileID, name, ovirtC.CreateNICParams(),
+			ovirtC.ContextStrategy(ms.Context))
+		return err
+	}
+
+	legacyClient, ok := ms.ovirtClient.(ovirtC.ClientWithLegacySupport)
+	if !ok {
+		return fmt.Errorf("setting the MAC address or interface of NIC %s is not supported by the oVirt client", name)
+	}
+	nicBuilder := ovirtsdk.NewNicBuilder().
+		Name(name).
+		VnicProfile(ovirtsdk.NewVnicProfileBuilder().Id(string(profileID)).MustBuild())
+	if nic.MAC != "" {
+		nicBuilder.Mac(ovirtsdk.NewMacBuilder().Address(nic.MAC).MustBuild())
+	}
+	if nic.Interface != "" {
+		nicBuilder.Interface(ovirtsdk.NicInterface(nic.Interface))
+	}
+	return ovirt.CallSDK(ms.Context, legacyClient, "CreateNIC", func(conn *ovirtsdk.Connection) error {
+		_, err := conn.SystemService().VmsService().VmService(string(instance.ID())).
+			NicsService().
+			Add().
+			Nic(nicBuilder.MustBuild()).
+			Send()
+		return err
+	})
+}
+
+// reconcileTag adds the cluster tag to the VM unless it is already assigned.
+func (ms *machineScope) reconcileTag(instance ovirtC.VM) error {
+	tagName := ms.clusterTag()
+	tags, err := ms.ovirtClient.ListVMTags(instance.ID(), ovirtC.ContextStrategy(ms.Context))
+	if err != nil {
+		return errors.Wrapf(err, "failed to list tags of VM %s", instance.ID())
+	}
+	for _, tag := range tags {
+		if tag.Name() == tagName {
+			ms.markConditionTrue(ovirtconfigv1.TagAssignedCondition, ovirtconfigv1.ConditionReasonSucceeded,
+				"tag %s added", tagName)
+			return nil
+		}
+	}
+
+	if err := ms.ovirtClient.AddTagToVMByName(instance.ID(), tagName, ovirtC.ContextStrategy(ms.Context)); err != nil {
+		return err
+	}
+	ms.markConditionTrue(ovirtconfigv1.TagAssignedCondition, ovirtconfigv1.ConditionReasonSucceeded,
+		"tag %s added", tagName)
+	return nil
+}
+
+// reconcileAffinity applies the CPU auto pinning policy and adds the VM to the affinity groups
+// it isn't a member of yet.
+func (ms *machineScope) reconcileAffinity(instance ovirtC.VM) error {
+	if ms.isAutoPinning() {
+		err := ms.ovirtClient.AutoOptimizeVMCPUPinningSettings(instance.ID(), true, ovirtC.ContextStrategy(ms.Context))
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, agName := range ms.machineProviderSpec.AffinityGroupsNames {
+		ag, err := ms.ovirtClient.GetAffinityGroupByName(ovirtC.ClusterID(ms.machineProviderSpec.ClusterId), agName, ovirtC.ContextStrategy(ms.Context))
+		if err != nil {
+			return err
+		}
+		if containsVMID(ag.VMIDs(), instance.ID()) {
+			continue
+		}
+		err = ms.ovirtClient.AddVMToAffinityGroup(ag.ClusterID(), instance.ID(), ag.ID(), ovirtC.ContextStrategy(ms.Context))
+		if err != nil {
+			return err
+		}
+	}
+
+	if !ms.isAutoPinning() && len(ms.machineProviderSpec.AffinityGroupsNames) == 0 {
+		ms.markConditionTrue(ovirtconfigv1.AffinityAppliedCondition, ovirtconfigv1.ConditionReasonNotRequested,
+			"no auto pinning or affinity groups requested")
+		return nil
+	}
+	ms.markConditionTrue(ovirtconfigv1.AffinityAppliedCondition, ovirtconfigv1.ConditionReasonSucceeded,
+		"auto pinning %t, affinity groups %v", ms.isAutoPinning(), ms.machineProviderSpec.AffinityGroupsNames)
+	return nil
+}
+
+// reconcileVMStarted starts the VM unless it is already starting or running and waits for it to be up.
+func (ms *machineScope) reconcileVMStarted(instance ovirtC.VM) error {
+	vm, err := ms.ovirtClient.GetVM(instance.ID(), ovirtC.ContextStrategy(ms.Context))
+	if err != nil {
+		return errors.Wrapf(err, "error fetching VM %s", instance.ID())
+	}
+
+	// Start the VM
+	if vm.Status() == ovirtC.VMStatusDown {
+		if err := ms.ovirtClient.StartVM(instance.ID(), ovirtC.ContextStrategy(ms.Context)); err != nil {
+			return errors.Wrap(err, "error running oVirt VM")
+		}
+	}
+
+	// Wait till running
+	if _, err := ms.ovirtClient.WaitForVMStatus(instance.ID(), ovirtC.VMStatusUp, ovirtC.ContextStrategy(ms.Context)); err != nil {
+		return errors.Wrap(err, "error waiting for oVirt VM to be UP")
+	}
+	ms.observeSinceCreation(timeToUp)
+	ms.markConditionTrue(ovirtconfigv1.VMStartedCondition, ovirtconfigv1.ConditionReasonSucceeded,
+		"VM %s is up", instance.ID())
+	return nil
+}
+
+// isConditionTrue returns true if the condition in the provider status is true.
+func (ms *machineScope) isConditionTrue(conditionType string) bool {
+	providerStatus, err := ovirtconfigv1.ProviderStatusFromRawExtension(ms.machine.Status.ProviderStatus)
+	if err != nil {
+		return false
+	}
+	return meta.IsStatusConditionTrue(providerStatus.Conditions, conditionType)
+}
+
+// resetConditions removes all conditions from the provider status.
+func (ms *machineScope) resetConditions() {
+	ms.updateProviderStatusOrLog(func(providerStatus *ovirtconfigv1.OvirtMachineProviderStatus) {
+		providerStatus.Conditions = nil
+	})
+}
+
+// checkpoint persists the provider status, so that an interrupted creation can be resumed.
+func (ms *machineScope) checkpoint() {
+	if ms.client == nil {
+		return
+	}
+	if err := ms.patchMachine(ms.Context); err != nil {
+		ms.logger.Errorf("failed to persist checkpoint of machine %s: %v", ms.machine.Name, err)
+	}
+}
+
+func containsVMID(ids []ovirtC.VMID, id ovirtC.VMID) bool {
+	for _, candidate := range ids {
+		if candidate == id {
+			return true
+		}
+	}
+	return false
+}
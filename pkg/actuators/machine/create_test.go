@@ -0,0 +1,168 @@
+//go:build unit
+
+package machine
+
+import (
+	"context"
+	"testing"
+
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	"github.com/openshift/cluster-api-provider-ovirt/pkg/apis/ovirtprovider/v1beta1"
+	"github.com/openshift/cluster-api-provider-ovirt/pkg/ovirt"
+	ovirtclient "github.com/ovirt/go-ovirt-client/v2"
+	"k8s.io/apimachinery/pkg/api/meta"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestMachineScope_CreateResumesInterruptedCreation(t *testing.T) {
+	helper, err := ovirtclient.NewMockTestHelper(ovirt.NewKLogr("go-ovirt-client"))
+	if err != nil {
+		t.Fatalf("Unexpected error occurred setting up test helper: %v", err)
+	}
+	client := helper.GetClient()
+	if _, err := client.CreateTag("test-cluster", nil); err != nil {
+		t.Fatalf("Unexpected error occurred creating tag: %v", err)
+	}
+
+	// simulate a creation which was interrupted right after the VM was created
+	vm, err := client.CreateVM(helper.GetClusterID(), helper.GetBlankTemplateID(), "test-machine", nil)
+	if err != nil {
+		t.Fatalf("Unexpected error occurred creating VM: %v", err)
+	}
+
+	spec := basicMachineProviderSpec("", string(helper.GetClusterID()))
+	spec.UserDataSecret = nil
+	spec.OSDisk = nil
+	spec.NetworkInterfaces = []*v1beta1.NetworkInterface{{VNICProfileID: string(helper.GetVNICProfileID())}}
+	spec.AdditionalDisks = []v1beta1.AdditionalDisk{{SizeGB: 1, StorageDomainId: string(helper.GetStorageDomainID())}}
+	ms := machineScope{
+		Context:             context.Background(),
+		logger:              ovirt.NewKLogr("machine-scope"),
+		ovirtClient:         client,
+		machineProviderSpec: spec,
+		machine: &machinev1.Machine{
+			ObjectMeta: v1.ObjectMeta{
+				Name:   "test-machine",
+				Labels: map[string]string{"machine.openshift.io/cluster-api-cluster": "test-cluster"},
+			},
+		},
+	}
+	ms.markConditionTrue(v1beta1.TemplateResolvedCondition, v1beta1.ConditionReasonSucceeded, "resolved")
+	if err := ms.reconcileMachineProviderStatus(vm); err != nil {
+		t.Fatalf("Unexpected error occurred recording the VM ID: %v", err)
+	}
+
+	// running create twice must not duplicate any of the changes
+	for i := 0; i < 2; i++ {
+		if err := ms.create(); err != nil {
+			t.Fatalf("Unexpected error occurred in create run %d: %v", i+1, err)
+		}
+	}
+
+	vm, err = client.GetVM(vm.ID())
+	if err != nil {
+		t.Fatalf("Unexpected error occurred fetching VM: %v", err)
+	}
+	if vm.Status() != ovirtclient.VMStatusUp {
+		t.Errorf("Expected VM to be %s, but got %s", ovirtclient.VMStatusUp, vm.Status())
+	}
+	if len(vm.TagIDs()) != 1 {
+		t.Errorf("Expected VM to have exactly 1 tag, but got %d", len(vm.TagIDs()))
+	}
+	nics, err := vm.ListNICs()
+	if err != nil {
+		t.Fatalf("Unexpected error occurred listing NICs: %v", err)
+	}
+	if len(nics) != 1 || nics[0].Name() != "nic1" {
+		t.Errorf("Expected VM to have exactly NIC nic1, but got %v", nics)
+	}
+
+	diskAttachments, err := vm.ListDiskAttachments()
+	if err != nil {
+		t.Fatalf("Unexpected error occurred listing disk attachments: %v", err)
+	}
+	if len(diskAttachments) != 1 || diskAttachments[0].Bootable() {
+		t.Errorf("Expected VM to have exactly 1 non-bootable disk, but got %v", diskAttachments)
+	}
+
+	providerStatus, err := v1beta1.ProviderStatusFromRawExtension(ms.machine.Status.ProviderStatus)
+	if err != nil {
+		t.Fatalf("Unexpected error occurred parsing provider status: %v", err)
+	}
+	for _, step := range ms.createSteps() {
+		if !meta.IsStatusConditionTrue(providerStatus.Conditions, step.condition) {
+			t.Errorf("Expected condition %s to be true", step.condition)
+		}
+	}
+}
+
+// testNIC is a NIC of the VM with the given ID and vNic profile.
+type testNIC struct {
+	ovirtclient.NIC
+	id        ovirtclient.NICID
+	profileID ovirtclient.VNICProfileID
+}
+
+func (n testNIC) ID() ovirtclient.NICID {
+	return n.id
+}
+
+func (n testNIC) VNICProfileID() ovirtclient.VNICProfileID {
+	return n.profileID
+}
+
+func TestDesiredNICMatches(t *testing.T) {
+	nic := testNIC{id: "nic-1", profileID: "profile-1"}
+	hardware := map[ovirtclient.NICID]nicHardware{"nic-1": {mac: "56:6f:1a:2b:00:01", model: "virtio"}}
+
+	testcases := []struct {
+		name     string
+		desired  desiredNIC
+		hardware map[ovirtclient.NICID]nicHardware
+		expected bool
+	}{
+		{
+			name:     "NIC with the vNic profile matches",
+			desired:  desiredNIC{profileID: "profile-1", spec: &v1beta1.NetworkInterface{}},
+			expected: true,
+		},
+		{
+			name:     "NIC with another vNic profile doesn't match",
+			desired:  desiredNIC{profileID: "profile-2", spec: &v1beta1.NetworkInterface{}},
+			hardware: hardware,
+			expected: false,
+		},
+		{
+			name:     "NIC with the MAC address and interface matches",
+			desired:  desiredNIC{profileID: "profile-1", spec: &v1beta1.NetworkInterface{MAC: "56:6F:1A:2B:00:01", Interface: "virtio"}},
+			hardware: hardware,
+			expected: true,
+		},
+		{
+			name:     "NIC with another MAC address doesn't match",
+			desired:  desiredNIC{profileID: "profile-1", spec: &v1beta1.NetworkInterface{MAC: "56:6f:1a:2b:00:02"}},
+			hardware: hardware,
+			expected: false,
+		},
+		{
+			name:     "NIC with another interface doesn't match",
+			desired:  desiredNIC{profileID: "profile-1", spec: &v1beta1.NetworkInterface{Interface: "e1000"}},
+			hardware: hardware,
+			expected: false,
+		},
+		{
+			name:     "NIC with unknown hardware doesn't match a requested MAC address",
+			desired:  desiredNIC{profileID: "profile-1", spec: &v1beta1.NetworkInterface{MAC: "56:6f:1a:2b:00:01"}},
+			hardware: nil,
+			expected: false,
+		},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.name, func(t *testing.T) {
+			if matches := testcase.desired.matches(nic, testcase.hardware); matches != testcase.expected {
+				t.Errorf("Expected NIC to match: %t, but got %t", testcase.expected, matches)
+			}
+		})
+	}
+}
@@ -0,0 +1,26 @@
+package machine
+
+import (
+	ovirtconfigv1 "github.com/openshift/cluster-api-provider-ovirt/pkg/apis/ovirtprovider/v1beta1"
+	ovirtC "github.com/ovirt/go-ovirt-client/v2"
+)
+
+const (
+	// defaultVMType is the VM type of machines which don't specify one.
+	defaultVMType = string(ovirtC.VMTypeServer)
+)
+
+// DefaultProviderSpec sets the defaults of the provider spec explicitly, so that the effective
+// configuration of a machine is visible in its provider spec. Fields which are set aren't changed.
+// The disk Format and Sparse fields aren't defaulted, because setting either of them overrides the
+// disks of the template when the VM is created. It is used by the defaulting admission webhook.
+func DefaultProviderSpec(spec *ovirtconfigv1.OvirtMachineProviderSpec) {
+	if spec.VMType == "" {
+		spec.VMType = defaultVMType
+	}
+	if spec.Clone == nil {
+		// desktop VMs use thin provisioned disks based on the template by default
+		clone := spec.VMType != string(ovirtC.VMTypeDesktop)
+		spec.Clone = &clone
+	}
+}
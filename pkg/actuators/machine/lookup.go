@@ -0,0 +1,82 @@
+package machine
+
+import (
+	"fmt"
+
+	ovirtconfigv1 "github.com/openshift/cluster-api-provider-ovirt/pkg/apis/ovirtprovider/v1beta1"
+	"github.com/openshift/cluster-api-provider-ovirt/pkg/utils"
+	ovirtC "github.com/ovirt/go-ovirt-client/v2"
+	"github.com/pkg/errors"
+)
+
+// vmNameCollisionError is returned if a VM with the name of the machine exists, but it doesn't carry
+// the tag of the cluster and therefore belongs to someone else.
+type vmNameCollisionError struct {
+	name string
+	id   ovirtC.VMID
+	tag  string
+}
+
+func (e *vmNameCollisionError) Error() string {
+	return fmt.Sprintf("VM %s (%s) has the name of the machine, but is not tagged with cluster tag %s", e.name, e.id, e.tag)
+}
+
+// isVMNameCollision returns true if the error is caused by a VM with the name of the machine which
+// doesn't belong to the cluster.
+func isVMNameCollision(err error) bool {
+	var collisionErr *vmNameCollisionError
+	return errors.As(err, &collisionErr)
+}
+
+// isVMNotFound returns true if the error returned by getVM is caused by a VM which doesn't exist.
+// Contrary to ovirtC.HasErrorCode it is safe to use with errors which don't originate from the engine.
+func isVMNotFound(err error) bool {
+	var engineErr ovirtC.EngineError
+	return errors.As(err, &engineErr) && engineErr.HasCode(ovirtC.ENotFound)
+}
+
+// knownVMID returns the ID of the VM recorded on the machine. The provider ID is preferred over the
+// instance ID of the provider status and the VmId annotation. An empty ID is returned if the VM
+// wasn't recorded yet.
+func (ms *machineScope) knownVMID() ovirtC.VMID {
+	if ms.machine.Spec.ProviderID != nil {
+		if id := utils.VMIDFromProviderID(*ms.machine.Spec.ProviderID); id != "" {
+			return ovirtC.VMID(id)
+		}
+	}
+	providerStatus, err := ovirtconfigv1.ProviderStatusFromRawExtension(ms.machine.Status.ProviderStatus)
+	if err == nil && providerStatus.InstanceID != nil && *providerStatus.InstanceID != "" {
+		return ovirtC.VMID(*providerStatus.InstanceID)
+	}
+	if id := ms.machine.Annotations[utils.OvirtIDAnnotationKey]; id != "" {
+		return ovirtC.VMID(id)
+	}
+	return ""
+}
+
+// getVM returns the VM backing the machine. The VM is fetched by its recorded ID, the machine name
+// is only used before the ID is known. A VM found by name has to carry the tag or the ownership
+// marker of the cluster, otherwise a vmNameCollisionError is returned.
+// If the VM doesn't exist, an error with the ovirtC.ENotFound code is returned, see isVMNotFound.
+func (ms *machineScope) getVM() (ovirtC.VM, error) {
+	if id := ms.knownVMID(); id != "" {
+		vm, err := ms.ovirtClient.GetVM(id, ovirtC.ContextStrategy(ms.Context))
+		if err != nil {
+			return nil, errors.Wrapf(err, "error finding VM by ID %s", id)
+		}
+		return vm, nil
+	}
+
+	vm, err := ms.ovirtClient.GetVMByName(ms.machine.Name, ovirtC.ContextStrategy(ms.Context))
+	if err != nil {
+		return nil, errors.Wrap(err, "error finding VM by name")
+	}
+	owned, err := ms.isOwned(vm)
+	if err != nil {
+		return nil, err
+	}
+	if !owned {
+		return nil, &vmNameCollisionError{name: vm.Name(), id: vm.ID(), tag: ms.clusterTag()}
+	}
+	return vm, nil
+}
@@ -0,0 +1,119 @@
+//go:build unit
+
+package machine
+
+import (
+	"context"
+	"testing"
+
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	"github.com/openshift/cluster-api-provider-ovirt/pkg/ovirt"
+	"github.com/openshift/cluster-api-provider-ovirt/pkg/utils"
+	ovirtclient "github.com/ovirt/go-ovirt-client/v2"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestMachineScope_GetVM(t *testing.T) {
+	testcases := []struct {
+		name          string
+		setup         func(t *testing.T, helper ovirtclient.TestHelper, machine *machinev1.Machine) ovirtclient.VMID
+		expectedError func(err error) bool
+	}{
+		{
+			name: "VM is found by provider ID after it was renamed",
+			setup: func(t *testing.T, helper ovirtclient.TestHelper, machine *machinev1.Machine) ovirtclient.VMID {
+				vm := createTestVM(t, helper, "renamed-vm", "")
+				providerID := utils.ProviderIDPrefix + string(vm.ID())
+				machine.Spec.ProviderID = &providerID
+				return vm.ID()
+			},
+		},
+		{
+			name: "VM is found by annotation",
+			setup: func(t *testing.T, helper ovirtclient.TestHelper, machine *machinev1.Machine) ovirtclient.VMID {
+				vm := createTestVM(t, helper, "renamed-vm", "")
+				machine.Annotations = map[string]string{utils.OvirtIDAnnotationKey: string(vm.ID())}
+				return vm.ID()
+			},
+		},
+		{
+			name: "VM with the machine name and the cluster tag is found by name",
+			setup: func(t *testing.T, helper ovirtclient.TestHelper, machine *machinev1.Machine) ovirtclient.VMID {
+				return createTestVM(t, helper, machine.Name, "test-cluster").ID()
+			},
+		},
+		{
+			name: "VM with the machine name of another cluster is a collision",
+			setup: func(t *testing.T, helper ovirtclient.TestHelper, machine *machinev1.Machine) ovirtclient.VMID {
+				return createTestVM(t, helper, machine.Name, "other-cluster").ID()
+			},
+			expectedError: isVMNameCollision,
+		},
+		{
+			name: "VM with the machine name is ignored once the ID is known",
+			setup: func(t *testing.T, helper ovirtclient.TestHelper, machine *machinev1.Machine) ovirtclient.VMID {
+				createTestVM(t, helper, machine.Name, "test-cluster")
+				providerID := utils.ProviderIDPrefix + "00000000-0000-0000-0000-000000000000"
+				machine.Spec.ProviderID = &providerID
+				return ""
+			},
+			expectedError: func(err error) bool {
+				return ovirtclient.HasErrorCode(err, ovirtclient.ENotFound)
+			},
+		},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.name, func(t *testing.T) {
+			helper, err := ovirtclient.NewMockTestHelper(ovirt.NewKLogr("go-ovirt-client"))
+			if err != nil {
+				t.Fatalf("Unexpected error occurred setting up test helper: %v", err)
+			}
+			ms := machineScope{
+				Context:     context.Background(),
+				logger:      ovirt.NewKLogr("machine-scope"),
+				ovirtClient: helper.GetClient(),
+				machine: &machinev1.Machine{
+					ObjectMeta: v1.ObjectMeta{
+						Name:   "test-machine",
+						Labels: map[string]string{machinev1.MachineClusterIDLabel: "test-cluster"},
+					},
+				},
+			}
+			expectedID := testcase.setup(t, helper, ms.machine)
+
+			vm, err := ms.getVM()
+			if testcase.expectedError != nil {
+				if err == nil || !testcase.expectedError(err) {
+					t.Fatalf("Expected a different error, but got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error occurred getting VM: %v", err)
+			}
+			if vm.ID() != expectedID {
+				t.Errorf("Expected VM %s, but got %s", expectedID, vm.ID())
+			}
+		})
+	}
+}
+
+// createTestVM creates a VM and tags it with the given tag unless tagName is empty.
+func createTestVM(t *testing.T, helper ovirtclient.TestHelper, name string, tagName string) ovirtclient.VM {
+	client := helper.GetClient()
+	vm, err := client.CreateVM(helper.GetClusterID(), helper.GetBlankTemplateID(), name, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error occurred creating VM: %v", err)
+	}
+	if tagName == "" {
+		return vm
+	}
+	if _, err := client.CreateTag(tagName, nil); err != nil {
+		t.Fatalf("Unexpected error occurred creating tag: %v", err)
+	}
+	if err := client.AddTagToVMByName(vm.ID(), tagName); err != nil {
+		t.Fatalf("Unexpected error occurred tagging VM: %v", err)
+	}
+	return vm
+}
@@ -6,6 +6,7 @@ import (
 	"math"
 	"net"
 	"regexp"
+	"time"
 
 	configv1 "github.com/openshift/api/config/v1"
 	machinev1 "github.com/openshift/api/machine/v1beta1"
@@ -15,6 +16,9 @@ import (
 	ovirtC "github.com/ovirt/go-ovirt-client/v2"
 	"github.com/pkg/errors"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
@@ -36,6 +40,10 @@ type machineScope struct {
 	// it is used by k8sclient to understand the diff and patch the machine object
 	originalMachineToBePatched client.Patch
 	machineProviderSpec        *ovirtconfigv1.OvirtMachineProviderSpec
+	// datacenter is the datacenter of the oVirt cluster, it is looked up once per reconcile by clusterDatacenter
+	datacenter ovirtC.Datacenter
+	// shutdownGracePeriod is the time the guest OS is given to shut down before the VM is powered off on delete
+	shutdownGracePeriod time.Duration
 }
 
 func newMachineScope(
@@ -56,198 +64,130 @@ func newMachineScope(
 	}
 }
 
-// create creates an oVirt VM from the machine object if it does not exists.
-func (ms *machineScope) create() error {
-
-	vms, err := ms.ovirtClient.GetVMByName(ms.machine.Name, ovirtC.ContextStrategy(ms.Context))
-	clusterId := ms.machineProviderSpec.ClusterId
-
-	if err != nil {
-		if !ovirtC.HasErrorCode(err, ovirtC.ENotFound) {
-			return errors.Wrap(err, "error finding VM by name")
-		}
-	}
-	if vms != nil {
-		ms.logger.Infof("Skipped creating a VM that already exists.")
-		return nil
-	}
-
-	// Add ignition to the VM params
-	ignition, err := ms.getIgnition()
-	if err != nil {
-		return errors.Wrap(err, "error getting VM ignition")
-	}
-	// CREATE VM from a template
-	templateName := ms.machineProviderSpec.TemplateName
-	template, err := ms.ovirtClient.GetTemplateByName(templateName, ovirtC.ContextStrategy(ms.Context))
-	if err != nil {
-		return errors.Wrapf(err, "error finding template name %s.", templateName)
-	}
-
-	optionalVMParams, err := ms.buildOptionalVMParameters(string(ignition), template.ID())
-	if err != nil {
-		return errors.Wrapf(err, "error building parameters for VM creation")
-	}
-
-	instance, err := ms.ovirtClient.CreateVM(ovirtC.ClusterID(clusterId),
-		template.ID(),
-		ms.machine.Name,
-		optionalVMParams, ovirtC.ContextStrategy(ms.Context))
-
-	if err != nil {
-		return errors.Wrap(err, "error creating Ovirt instance")
+// extendOSDisk grows the bootable disk of the VM to the size requested in the OSDisk of the provider spec.
+// Shrinking a disk is not supported by oVirt, a smaller requested size is therefore ignored.
+// The returned disk is nil if the provider spec doesn't contain an OSDisk.
+func (ms *machineScope) extendOSDisk(instance ovirtC.VM) (ovirtC.Disk, error) {
+	if ms.machineProviderSpec.OSDisk == nil {
+		return nil, nil
 	}
+	newDiskSize := uint64(ms.machineProviderSpec.OSDisk.SizeGB * int64(math.Pow(2, 30)))
 
-	// Wait till ready
-	_, err = ms.ovirtClient.WaitForVMStatus(instance.ID(), ovirtC.VMStatusDown, ovirtC.ContextStrategy(ms.Context))
+	diskAttachments, err := ms.ovirtClient.ListDiskAttachments(instance.ID(), ovirtC.ContextStrategy(ms.Context))
 	if err != nil {
-		return errors.Wrap(err, "error creating oVirt VM")
-	}
-
-	// apply high_performance rules
-	// see: https://access.redhat.com/documentation/en-us/red_hat_virtualization/4.4/html-single/virtual_machine_management_guide/index?extIdCarryOver=true&sc_cid=701f2000001Css5AAC#Automatic_High_Performance_Configuration_Settings
-	if ms.machineProviderSpec.VMType == string(ovirtC.VMTypeHighPerformance) {
-		graphicsConsoles, err := instance.ListGraphicsConsoles()
-		if err != nil {
-			return errors.Wrapf(err, "failed to list graphics consoles")
-		}
-		for _, graphicsConsole := range graphicsConsoles {
-			err := graphicsConsole.Remove()
-			if err != nil {
-				return errors.Wrapf(err, "failed to remove graphics console '%s' from VM '%s'",
-					graphicsConsole.ID(), graphicsConsole.VMID())
-			}
-		}
+		return nil, errors.Wrapf(err, "failed to list disk attachments for VM %s.", instance.ID())
 	}
-
 	var bootableDiskAttachment ovirtC.DiskAttachment
-	newDiskSize := uint64(ms.machineProviderSpec.OSDisk.SizeGB * int64(math.Pow(2, 30)))
-	// Handle OS disk extension
-	if ms.machineProviderSpec.OSDisk != nil {
-		diskAttachments, err := instance.ListDiskAttachments()
-		if err != nil {
-			return errors.Wrapf(err, "failed to list disk attachments for VM %s.", instance.ID())
-		}
-		for _, diskAttachment := range diskAttachments {
-			if diskAttachment.Bootable() {
-				bootableDiskAttachment = diskAttachment
-			}
-		}
-
-		if bootableDiskAttachment == nil {
-			return errors.Wrapf(err, "VM %s(%s) doesn't have a bootable disk", instance.Name(), instance.ID())
-		}
-
-		disk, err := ms.ovirtClient.GetDisk(bootableDiskAttachment.DiskID(), ovirtC.ContextStrategy(ms.Context))
-		if err != nil {
-			return err
-		}
-
-		if newDiskSize > disk.ProvisionedSize() {
-			updatedDisk, err := disk.Update(ovirtC.UpdateDiskParams().MustWithProvisionedSize(newDiskSize))
-			if err != nil {
-				return errors.Wrapf(err, "failed to extend disk %s", disk.ID())
-			}
-			ms.logger.Infof("waiting for disk to become OK...")
-			updatedDisk, err = updatedDisk.WaitForOK()
-			if err != nil {
-				return err
-			}
+	for _, diskAttachment := range diskAttachments {
+		if diskAttachment.Bootable() {
+			bootableDiskAttachment = diskAttachment
 		}
 	}
-
-	// handleNics reattachment
-	if ms.machineProviderSpec.NetworkInterfaces != nil && len(ms.machineProviderSpec.NetworkInterfaces) > 0 {
-		nics, err := instance.ListNICs()
-		if err != nil {
-			return errors.Wrapf(err, "failed to list NICs on VM %s", instance.ID())
-		}
-
-		//remove all the nics from the VM instance
-		for _, nic := range nics {
-			if err := nic.Remove(); err != nil {
-				return errors.Wrapf(err, "failed to remove NIC %s", nic.ID())
-			}
-		}
-
-		//re-create NICs According to the machinespec
-		for i, nic := range ms.machineProviderSpec.NetworkInterfaces {
-			_, err := instance.CreateNIC(fmt.Sprintf("nic%d", i+1), ovirtC.VNICProfileID(nic.VNICProfileID), ovirtC.CreateNICParams())
-
-			if err != nil {
-				return err
-			}
-		}
+	if bootableDiskAttachment == nil {
+		return nil, fmt.Errorf("VM %s(%s) doesn't have a bootable disk", instance.Name(), instance.ID())
 	}
 
-	if ms.isAutoPinning() {
-		err = ms.ovirtClient.AutoOptimizeVMCPUPinningSettings(instance.ID(), true, ovirtC.ContextStrategy(ms.Context))
-		if err != nil {
-			return err
-		}
-	}
-
-	err = ms.ovirtClient.AddTagToVMByName(instance.ID(), ms.machine.Labels["machine.openshift.io/cluster-api-cluster"], ovirtC.ContextStrategy(ms.Context))
+	disk, err := ms.ovirtClient.GetDisk(bootableDiskAttachment.DiskID(), ovirtC.ContextStrategy(ms.Context))
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	for _, agName := range ms.machineProviderSpec.AffinityGroupsNames {
-		ag, err := ms.ovirtClient.GetAffinityGroupByName(ovirtC.ClusterID(clusterId), agName, ovirtC.ContextStrategy(ms.Context))
+	if newDiskSize > disk.ProvisionedSize() {
+		_, err := ms.ovirtClient.UpdateDisk(disk.ID(), ovirtC.UpdateDiskParams().MustWithProvisionedSize(newDiskSize),
+			ovirtC.ContextStrategy(ms.Context))
 		if err != nil {
-			return err
+			return nil, errors.Wrapf(err, "failed to extend disk %s", disk.ID())
 		}
-		err = ag.AddVM(instance.ID())
-		if err != nil {
-			return err
+		ms.logger.Infof("waiting for disk to become OK...")
+		if disk, err = ms.ovirtClient.WaitForDiskOK(disk.ID(), ovirtC.ContextStrategy(ms.Context)); err != nil {
+			return nil, err
 		}
 	}
-
-	// Start the VM
-	err = ms.ovirtClient.StartVM(instance.ID(), ovirtC.ContextStrategy(ms.Context))
-	if err != nil {
-		return errors.Wrap(err, "error running oVirt VM")
-	}
-
-	// Wait till running
-	_, err = ms.ovirtClient.WaitForVMStatus(instance.ID(), ovirtC.VMStatusUp, ovirtC.ContextStrategy(ms.Context))
-	if err != nil {
-		return errors.Wrap(err, "error waiting for oVirt VM to be UP")
-	}
-	return nil
+	return disk, nil
 }
 
 // exists returns true if machine exists.
+// A VM which has the name of the machine but belongs to another cluster is not considered.
 func (ms *machineScope) exists() (bool, error) {
-	_, err := ms.ovirtClient.GetVMByName(ms.machine.Name, ovirtC.ContextStrategy(ms.Context))
+	_, err := ms.getVM()
 	if err != nil {
-		if ovirtC.HasErrorCode(err, ovirtC.ENotFound) {
+		if isVMNotFound(err) {
+			return false, nil
+		}
+		if isVMNameCollision(err) {
+			ms.logger.Warningf("Ignoring VM of another cluster: %v", err)
 			return false, nil
 		}
-		return false, errors.Wrap(err, "error finding VM by name")
+		return false, err
 	}
 	return true, nil
 }
 
-// delete deletes the VM which corresponds with the machine object from the oVirt engine
+// delete deletes the VM which corresponds with the machine object from the oVirt engine.
+// The VM is only stopped and removed after its ownership was verified, a VM which doesn't belong
+// to the cluster results in a vmNameCollisionError or a vmOwnershipError and is left untouched.
+// Disks are retained according to the retention policies of the provider spec before the VM is removed.
 func (ms *machineScope) delete() error {
-	vm, err := ms.ovirtClient.GetVMByName(ms.machine.Name, ovirtC.ContextStrategy(ms.Context))
+	vm, err := ms.getVM()
 	if err != nil {
-		if ovirtC.HasErrorCode(err, ovirtC.ENotFound) {
+		if isVMNotFound(err) {
 			return nil
 		}
-		return errors.Wrap(err, "error finding VM by name")
-	}
-	if err := vm.Stop(true, ovirtC.ContextStrategy(ms.Context)); err != nil {
+		if isVMNameCollision(err) {
+			return ms.markConditionFalse(ovirtconfigv1.OwnershipVerifiedCondition, ovirtconfigv1.ConditionReasonNotOwned, err)
+		}
 		return err
 	}
-	if _, err := vm.WaitForStatus(ovirtC.VMStatusDown, ovirtC.ContextStrategy(ms.Context)); err != nil {
+	if err := ms.verifyOwnership(vm); err != nil {
+		return ms.markConditionFalse(ovirtconfigv1.OwnershipVerifiedCondition, ovirtconfigv1.ConditionReasonNotOwned, err)
+	}
+	ms.markConditionTrue(ovirtconfigv1.OwnershipVerifiedCondition, ovirtconfigv1.ConditionReasonSucceeded,
+		"VM %s belongs to the cluster", vm.ID())
+
+	if err := ms.traceStep("stopVM", func() error { return ms.stopVM(vm) }); err != nil {
 		return err
 	}
-	if err := vm.Remove(ovirtC.ContextStrategy(ms.Context)); err != nil && !ovirtC.HasErrorCode(err, ovirtC.ENotFound) {
+	if err := ms.traceStep("retainDisks", func() error { return ms.retainDisks(vm) }); err != nil {
 		return err
 	}
+	return ms.traceStep("removeVM", func() error {
+		err := ms.ovirtClient.RemoveVM(vm.ID(), ovirtC.ContextStrategy(ms.Context))
+		if err != nil && !ovirtC.HasErrorCode(err, ovirtC.ENotFound) {
+			return err
+		}
+		return nil
+	})
+}
 
+// stopVM shuts down the guest OS of the VM and waits up to the shutdown grace period for the VM to
+// be down. If the guest doesn't shut down in time, or the grace period is 0, the VM is powered off.
+func (ms *machineScope) stopVM(vm ovirtC.VM) error {
+	if vm.Status() == ovirtC.VMStatusDown {
+		return nil
+	}
+	if ms.shutdownGracePeriod > 0 {
+		ms.logger.Infof("Shutting down VM %s with a grace period of %s.", vm.ID(), ms.shutdownGracePeriod)
+		if err := ms.ovirtClient.ShutdownVM(vm.ID(), false, ovirtC.ContextStrategy(ms.Context)); err != nil {
+			ms.logger.Warningf("Failed to shut down VM %s, powering it off: %v", vm.ID(), err)
+		} else {
+			ctx, cancel := context.WithTimeout(ms.Context, ms.shutdownGracePeriod)
+			_, err := ms.ovirtClient.WaitForVMStatus(vm.ID(), ovirtC.VMStatusDown, ovirtC.ContextStrategy(ctx))
+			cancel()
+			if err == nil {
+				return nil
+			}
+			if ms.Context.Err() != nil {
+				return err
+			}
+			ms.logger.Warningf("VM %s didn't shut down within %s, powering it off.", vm.ID(), ms.shutdownGracePeriod)
+		}
+	}
+	if err := ms.ovirtClient.StopVM(vm.ID(), true, ovirtC.ContextStrategy(ms.Context)); err != nil {
+		return err
+	}
+	if _, err := ms.ovirtClient.WaitForVMStatus(vm.ID(), ovirtC.VMStatusDown, ovirtC.ContextStrategy(ms.Context)); err != nil {
+		return err
+	}
 	return nil
 }
 
@@ -275,22 +215,26 @@ func (ms *machineScope) getIgnition() ([]byte, error) {
 }
 
 func (ms *machineScope) reconcileMachine(ctx context.Context) error {
-	instance, err := ms.ovirtClient.GetVMByName(ms.machine.Name, ovirtC.ContextStrategy(ms.Context))
-
+	instance, err := ms.getVM()
 	if err != nil {
-		return errors.Wrap(err, "error finding VM by name")
+		return err
 	}
 
 	id := instance.ID()
 	status := instance.Status()
 	name := instance.Name()
+	vmStatuses.set(types.NamespacedName{Namespace: ms.machine.Namespace, Name: ms.machine.Name},
+		string(instance.ClusterID()), string(status))
 	ms.reconcileMachineProviderID(string(id))
 	ms.reconcileMachineAnnotations(string(status), string(id))
-	err = ms.reconcileMachineNetwork(ctx, status, name, string(id))
+	err = ms.traceStep("reconcileMachineNetwork", func() error {
+		return ms.reconcileMachineNetwork(ms.Context, status, name, string(id))
+	})
 	if err != nil {
-		return errors.Wrap(err, "error reconciling machine network")
+		return ms.markConditionFailed(ovirtconfigv1.AddressAssignedCondition,
+			errors.Wrap(err, "error reconciling machine network"))
 	}
-	err = ms.reconcileMachineProviderStatus(string(status), (*string)(&id))
+	err = ms.reconcileMachineProviderStatus(instance)
 	if err != nil {
 		return errors.Wrap(err, "error reconciling machine provider status")
 	}
@@ -363,6 +307,11 @@ func (ms *machineScope) reconcileMachineNetwork(ctx context.Context, status ovir
 	ms.logger.Debugf("received IP address %v from engine", ip)
 	addresses = append(addresses, corev1.NodeAddress{Type: corev1.NodeInternalIP, Address: ip})
 	ms.machine.Status.Addresses = addresses
+	if !ms.isConditionTrue(ovirtconfigv1.AddressAssignedCondition) {
+		ms.observeSinceCreation(timeToAddress)
+	}
+	ms.markConditionTrue(ovirtconfigv1.AddressAssignedCondition, ovirtconfigv1.ConditionReasonSucceeded,
+		"address %s assigned", ip)
 	return nil
 }
 
@@ -404,13 +353,39 @@ func (ms *machineScope) findUsableInternalAddress(ctx context.Context, vmID stri
 	return "", errors.Wrapf(err, "failed to find usable address for VM %s ", vmID)
 }
 
-func (ms *machineScope) reconcileMachineProviderStatus(status string, id *string) error {
+func (ms *machineScope) reconcileMachineProviderStatus(instance ovirtC.VM) error {
+	status := string(instance.Status())
+	id := string(instance.ID())
+	clusterID := string(instance.ClusterID())
+	return ms.updateProviderStatus(func(providerStatus *ovirtconfigv1.OvirtMachineProviderStatus) {
+		providerStatus.InstanceState = &status
+		providerStatus.InstanceID = &id
+		providerStatus.ClusterID = &clusterID
+		providerStatus.HostID = nil
+		if hostID := instance.HostID(); hostID != nil {
+			host := string(*hostID)
+			providerStatus.HostID = &host
+		}
+		providerStatus.InstanceTypeID = nil
+		if instanceTypeID := instance.InstanceTypeID(); instanceTypeID != nil {
+			instanceType := string(*instanceTypeID)
+			providerStatus.InstanceTypeID = &instanceType
+		}
+		// the OS disk records the storage domain it was observed on, the resolved one is the fallback
+		if providerStatus.StorageDomainID == nil && ms.machineProviderSpec != nil && ms.machineProviderSpec.StorageDomainId != "" {
+			storageDomainID := ms.machineProviderSpec.StorageDomainId
+			providerStatus.StorageDomainID = &storageDomainID
+		}
+	})
+}
+
+// updateProviderStatus applies modify to the provider status of the machine.
+func (ms *machineScope) updateProviderStatus(modify func(*ovirtconfigv1.OvirtMachineProviderStatus)) error {
 	providerStatus, err := ovirtconfigv1.ProviderStatusFromRawExtension(ms.machine.Status.ProviderStatus)
 	if err != nil {
 		return errors.Wrap(err, "error unmarshaling machine ProviderStatus field")
 	}
-	providerStatus.InstanceState = &status
-	providerStatus.InstanceID = id
+	modify(providerStatus)
 	rawExtension, err := ovirtconfigv1.RawExtensionFromProviderStatus(providerStatus)
 	if err != nil {
 		return errors.Wrap(err, "error marshaling machine ProviderStatus field")
@@ -419,6 +394,51 @@ func (ms *machineScope) reconcileMachineProviderStatus(status string, id *string
 	return nil
 }
 
+// updateProviderStatusOrLog is identical to updateProviderStatus, but only logs an error. It is used for
+// recording observations which must not abort the current operation.
+func (ms *machineScope) updateProviderStatusOrLog(modify func(*ovirtconfigv1.OvirtMachineProviderStatus)) {
+	if err := ms.updateProviderStatus(modify); err != nil {
+		ms.logger.Errorf("failed to update provider status of machine %s: %v", ms.machine.Name, err)
+	}
+}
+
+// markConditionTrue records the successful outcome of a step in the provider status conditions.
+func (ms *machineScope) markConditionTrue(conditionType string, reason string, messageFormat string, args ...interface{}) {
+	ms.updateProviderStatusOrLog(func(providerStatus *ovirtconfigv1.OvirtMachineProviderStatus) {
+		meta.SetStatusCondition(&providerStatus.Conditions, metav1.Condition{
+			Type:               conditionType,
+			Status:             metav1.ConditionTrue,
+			Reason:             reason,
+			Message:            fmt.Sprintf(messageFormat, args...),
+			ObservedGeneration: ms.machine.Generation,
+		})
+	})
+}
+
+// markConditionFailed records the failed outcome of a step in the provider status conditions and
+// stores the error as the last engine error. It returns the passed error for convenience, so callers
+// can do "return ms.markConditionFailed(...)".
+func (ms *machineScope) markConditionFailed(conditionType string, err error) error {
+	return ms.markConditionFalse(conditionType, ovirtconfigv1.ConditionReasonFailed, err)
+}
+
+// markConditionFalse records a negative outcome with the given reason in the provider status conditions
+// and stores the error as the last engine error. It returns the passed error for convenience.
+func (ms *machineScope) markConditionFalse(conditionType string, reason string, err error) error {
+	ms.updateProviderStatusOrLog(func(providerStatus *ovirtconfigv1.OvirtMachineProviderStatus) {
+		message := err.Error()
+		meta.SetStatusCondition(&providerStatus.Conditions, metav1.Condition{
+			Type:               conditionType,
+			Status:             metav1.ConditionFalse,
+			Reason:             reason,
+			Message:            message,
+			ObservedGeneration: ms.machine.Generation,
+		})
+		providerStatus.LastEngineError = &message
+	})
+	return err
+}
+
 func (ms *machineScope) reconcileMachineProviderID(id string) {
 	providerID := utils.ProviderIDPrefix + id
 	ms.machine.Spec.ProviderID = &providerID
@@ -435,6 +455,9 @@ func (ms *machineScope) reconcileMachineAnnotations(status string, id string) {
 func (ms *machineScope) buildOptionalVMParameters(ignition string, templateID ovirtC.TemplateID) (ovirtC.BuildableVMParameters, error) {
 	optionalVMParams := ovirtC.CreateVMParams()
 	optionalVMParams = optionalVMParams.MustWithInitializationParameters(ignition, ms.machine.Name)
+	if marker := ms.ownershipMarker(); marker != "" {
+		optionalVMParams = optionalVMParams.MustWithComment(marker)
+	}
 
 	if ms.machineProviderSpec.VMType != "" {
 		optionalVMParams = optionalVMParams.MustWithVMType(ovirtC.VMType(ms.machineProviderSpec.VMType))
@@ -490,7 +513,7 @@ func (ms *machineScope) buildOptionalVMParameters(ignition string, templateID ov
 		tempDiskAttachment, err := ms.ovirtClient.ListTemplateDiskAttachments(templateID, ovirtC.ContextStrategy(ms.Context))
 		if err != nil {
 			return nil, errors.Wrapf(err, "failed to fetch template %s disk attachments from oVirt Engine",
-				ms.machineProviderSpec.TemplateName)
+				templateID)
 		}
 
 		diskParams := []ovirtC.OptionalVMDiskParameters{}
@@ -524,7 +547,7 @@ func (ms *machineScope) buildOptionalVMParameters(ignition string, templateID ov
 		tempDiskAttachment, err := ms.ovirtClient.ListTemplateDiskAttachments(templateID, ovirtC.ContextStrategy(ms.Context))
 		if err != nil {
 			return nil, errors.Wrapf(err, "failed to fetch template %s disk attachments from oVirt Engine",
-				ms.machineProviderSpec.TemplateName)
+				templateID)
 		}
 		optionalVMParams = optionalVMParams.MustWithDisks([]ovirtC.OptionalVMDiskParameters{
 			ovirtC.MustNewBuildableVMDiskParameters(tempDiskAttachment[0].DiskID()).MustWithStorageDomainID(ovirtC.StorageDomainID(ms.machineProviderSpec.StorageDomainId)),
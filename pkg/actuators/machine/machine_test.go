@@ -3,7 +3,10 @@
 package machine
 
 import (
+	"context"
+	"fmt"
 	"testing"
+	"time"
 
 	machinev1 "github.com/openshift/api/machine/v1beta1"
 	"github.com/openshift/cluster-api-provider-ovirt/pkg/apis/ovirtprovider/v1beta1"
@@ -11,6 +14,7 @@ import (
 	"github.com/openshift/cluster-api-provider-ovirt/pkg/ovirt"
 	ovirtclient "github.com/ovirt/go-ovirt-client/v2"
 	k8sCorev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
@@ -139,3 +143,84 @@ func basicMachineProviderSpec(templateName string, clusterID string) *v1beta1.Ov
 		GuaranteedMemoryMB: 10000,
 	}
 }
+
+func TestMachineScope_Conditions(t *testing.T) {
+	ms := machineScope{
+		logger: ovirt.NewKLogr("machine-scope"),
+		machine: &machinev1.Machine{
+			ObjectMeta: v1.ObjectMeta{
+				Name: "test-machine",
+			},
+		},
+	}
+
+	ms.markConditionTrue(v1beta1.TemplateResolvedCondition, v1beta1.ConditionReasonSucceeded, "template %s found", "rhcos")
+	err := ms.markConditionFailed(v1beta1.VMStartedCondition, fmt.Errorf("engine unavailable"))
+	if err == nil || err.Error() != "engine unavailable" {
+		t.Fatalf("Expected the passed error to be returned, but got %v", err)
+	}
+
+	providerStatus, err := v1beta1.ProviderStatusFromRawExtension(ms.machine.Status.ProviderStatus)
+	if err != nil {
+		t.Fatalf("Unexpected error occurred parsing provider status: %v", err)
+	}
+	templateResolved := meta.FindStatusCondition(providerStatus.Conditions, v1beta1.TemplateResolvedCondition)
+	if templateResolved == nil || templateResolved.Status != v1.ConditionTrue || templateResolved.Message != "template rhcos found" {
+		t.Errorf("Expected condition %s to be true, but got %v", v1beta1.TemplateResolvedCondition, templateResolved)
+	}
+	vmStarted := meta.FindStatusCondition(providerStatus.Conditions, v1beta1.VMStartedCondition)
+	if vmStarted == nil || vmStarted.Status != v1.ConditionFalse || vmStarted.Reason != v1beta1.ConditionReasonFailed {
+		t.Errorf("Expected condition %s to be failed, but got %v", v1beta1.VMStartedCondition, vmStarted)
+	}
+	if providerStatus.LastEngineError == nil || *providerStatus.LastEngineError != "engine unavailable" {
+		t.Errorf("Expected last engine error to be recorded, but got %v", providerStatus.LastEngineError)
+	}
+}
+
+func TestMachineScope_StopVM(t *testing.T) {
+	testcases := []struct {
+		name                string
+		shutdownGracePeriod time.Duration
+	}{
+		{
+			name:                "VM is shut down within the grace period",
+			shutdownGracePeriod: 30 * time.Second,
+		},
+		{
+			name:                "VM is powered off without grace period",
+			shutdownGracePeriod: 0,
+		},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.name, func(t *testing.T) {
+			helper, err := ovirtclient.NewMockTestHelper(ovirt.NewKLogr("go-ovirt-client"))
+			if err != nil {
+				t.Fatalf("Unexpected error occurred setting up test helper: %v", err)
+			}
+			vm := createTestVM(t, helper, "test-vm", "")
+			if err := vm.Start(); err != nil {
+				t.Fatalf("Unexpected error occurred starting VM: %v", err)
+			}
+			if vm, err = vm.WaitForStatus(ovirtclient.VMStatusUp); err != nil {
+				t.Fatalf("Unexpected error occurred waiting for VM to be up: %v", err)
+			}
+
+			ms := machineScope{
+				Context:             context.Background(),
+				logger:              ovirt.NewKLogr("machine-scope"),
+				ovirtClient:         helper.GetClient(),
+				shutdownGracePeriod: testcase.shutdownGracePeriod,
+			}
+			if err := ms.stopVM(vm); err != nil {
+				t.Fatalf("Unexpected error occurred stopping VM: %v", err)
+			}
+			if vm, err = helper.GetClient().GetVM(vm.ID()); err != nil {
+				t.Fatalf("Unexpected error occurred fetching VM: %v", err)
+			}
+			if vm.Status() != ovirtclient.VMStatusDown {
+				t.Errorf("Expected VM to be %s, but got %s", ovirtclient.VMStatusDown, vm.Status())
+			}
+		})
+	}
+}
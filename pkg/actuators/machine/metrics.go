@@ -0,0 +1,114 @@
+package machine
+
+import (
+	"sync"
+	"time"
+
+	apierrors "github.com/openshift/machine-api-operator/pkg/controller/machine"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+// machineOperations counts the creates and deletes of machines by result and error reason.
+var machineOperations = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "ovirt_machine_operations_total",
+	Help: "Number of machine creates and deletes, by operation, result and error reason.",
+}, []string{"operation", "result", "reason"})
+
+// vmStatusGauge counts the VMs of the machines by oVirt cluster and status.
+var vmStatusGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "ovirt_vms",
+	Help: "Number of VMs of the machines, by oVirt cluster and VM status.",
+}, []string{"cluster", "status"})
+
+// timeToUp and timeToAddress observe the time from the creation of a machine until its VM is up and
+// until its address is assigned.
+var (
+	timeToUp = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "ovirt_machine_time_to_up_seconds",
+		Help:    "Time from the creation of a machine until its VM is up.",
+		Buckets: prometheus.ExponentialBuckets(15, 2, 10),
+	})
+	timeToAddress = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "ovirt_machine_time_to_address_seconds",
+		Help:    "Time from the creation of a machine until the address of its VM is assigned.",
+		Buckets: prometheus.ExponentialBuckets(15, 2, 10),
+	})
+)
+
+func init() {
+	metrics.Registry.MustRegister(machineOperations, vmStatusGauge, timeToUp, timeToAddress)
+}
+
+// recordMachineOperation counts the outcome of a create or delete returned by the actuator.
+func recordMachineOperation(operation string, err error) {
+	var machineErr *apierrors.MachineError
+	var requeueErr *apierrors.RequeueAfterError
+	switch {
+	case err == nil:
+		machineOperations.WithLabelValues(operation, "success", "").Inc()
+	case errors.As(err, &requeueErr) && isEngineThrottled(err):
+		machineOperations.WithLabelValues(operation, "requeued", "EngineThrottled").Inc()
+	case errors.As(err, &requeueErr):
+		machineOperations.WithLabelValues(operation, "requeued", "Requeued").Inc()
+	case errors.As(err, &machineErr):
+		machineOperations.WithLabelValues(operation, "failure", string(machineErr.Reason)).Inc()
+	default:
+		machineOperations.WithLabelValues(operation, "failure", "Unknown").Inc()
+	}
+}
+
+// observeSinceCreation observes the time since the machine was created. Nothing is observed for
+// machines without creation timestamp.
+func (ms *machineScope) observeSinceCreation(histogram prometheus.Histogram) {
+	if ms.machine.CreationTimestamp.IsZero() {
+		return
+	}
+	histogram.Observe(time.Since(ms.machine.CreationTimestamp.Time).Seconds())
+}
+
+// vmStatuses tracks the VM of each machine for the VM status gauge.
+var vmStatuses = &vmStatusTracker{
+	lock: &sync.Mutex{},
+	vms:  map[types.NamespacedName]trackedVM{},
+}
+
+// trackedVM is the oVirt cluster and status of a VM.
+type trackedVM struct {
+	cluster string
+	status  string
+}
+
+type vmStatusTracker struct {
+	lock *sync.Mutex
+	vms  map[types.NamespacedName]trackedVM
+}
+
+// set records the cluster and status of the VM of the machine.
+func (tracker *vmStatusTracker) set(machine types.NamespacedName, cluster string, status string) {
+	tracker.lock.Lock()
+	defer tracker.lock.Unlock()
+
+	vm := trackedVM{cluster: cluster, status: status}
+	if old, ok := tracker.vms[machine]; ok {
+		if old == vm {
+			return
+		}
+		vmStatusGauge.WithLabelValues(old.cluster, old.status).Dec()
+	}
+	tracker.vms[machine] = vm
+	vmStatusGauge.WithLabelValues(vm.cluster, vm.status).Inc()
+}
+
+// remove forgets the VM of a deleted machine.
+func (tracker *vmStatusTracker) remove(machine types.NamespacedName) {
+	tracker.lock.Lock()
+	defer tracker.lock.Unlock()
+
+	if old, ok := tracker.vms[machine]; ok {
+		vmStatusGauge.WithLabelValues(old.cluster, old.status).Dec()
+		delete(tracker.vms, machine)
+	}
+}
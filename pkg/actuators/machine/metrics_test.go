@@ -0,0 +1,115 @@
+//go:build unit
+
+package machine
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	"github.com/openshift/cluster-api-provider-ovirt/pkg/ovirt"
+	apierrors "github.com/openshift/machine-api-operator/pkg/controller/machine"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestVMStatusTracker(t *testing.T) {
+	machineA := types.NamespacedName{Namespace: "openshift-machine-api", Name: "machine-a"}
+	machineB := types.NamespacedName{Namespace: "openshift-machine-api", Name: "machine-b"}
+
+	vmStatuses.set(machineA, "metrics-cluster", "down")
+	vmStatuses.set(machineB, "metrics-cluster", "down")
+	vmStatuses.set(machineA, "metrics-cluster", "up")
+	vmStatuses.set(machineA, "metrics-cluster", "up")
+
+	if value := metricValue(t, vmStatusGauge.WithLabelValues("metrics-cluster", "down")); value != 1 {
+		t.Errorf("Expected 1 VM down, but got %v", value)
+	}
+	if value := metricValue(t, vmStatusGauge.WithLabelValues("metrics-cluster", "up")); value != 1 {
+		t.Errorf("Expected 1 VM up, but got %v", value)
+	}
+
+	vmStatuses.remove(machineA)
+	vmStatuses.remove(machineA)
+	if value := metricValue(t, vmStatusGauge.WithLabelValues("metrics-cluster", "up")); value != 0 {
+		t.Errorf("Expected no VM up after the machine was deleted, but got %v", value)
+	}
+	vmStatuses.remove(machineB)
+}
+
+func TestRecordMachineOperation(t *testing.T) {
+	testCases := []struct {
+		name   string
+		err    error
+		result string
+		reason string
+	}{
+		{name: "success", err: nil, result: "success", reason: ""},
+		{
+			name:   "machine error",
+			err:    apierrors.InvalidMachineConfiguration("invalid"),
+			result: "failure",
+			reason: "InvalidConfiguration",
+		},
+		{
+			name:   "throttled",
+			err:    &requeueError{requeue: &apierrors.RequeueAfterError{}, cause: &ovirt.EngineThrottledError{}},
+			result: "requeued",
+			reason: "EngineThrottled",
+		},
+		{
+			name:   "requeued",
+			err:    &apierrors.RequeueAfterError{},
+			result: "requeued",
+			reason: "Requeued",
+		},
+		{name: "other error", err: errors.New("failed"), result: "failure", reason: "Unknown"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			counter := machineOperations.WithLabelValues("test", tc.result, tc.reason)
+			before := metricValue(t, counter)
+			recordMachineOperation("test", tc.err)
+			if after := metricValue(t, counter); after != before+1 {
+				t.Errorf("Expected the %s/%s counter to be incremented, but got %v after %v", tc.result, tc.reason, after, before)
+			}
+		})
+	}
+}
+
+func TestRequeueIfThrottled(t *testing.T) {
+	actuator := &OvirtActuator{logger: ovirt.NewKLogr("test")}
+	machine := &machinev1.Machine{}
+	throttledErr := &ovirt.EngineThrottledError{RetryAfter: time.Minute}
+
+	err := actuator.requeueIfThrottled(machine, fmt.Errorf("failed to get VM: %w", throttledErr))
+	var requeueErr *apierrors.RequeueAfterError
+	if !errors.As(err, &requeueErr) {
+		t.Fatalf("Expected a RequeueAfterError for a throttled call, but got %v", err)
+	}
+	if requeueErr.RequeueAfter != time.Minute {
+		t.Errorf("Expected requeue after %s, but got %s", time.Minute, requeueErr.RequeueAfter)
+	}
+	if !isEngineThrottled(err) {
+		t.Errorf("Expected the requeue error to keep the throttled call as cause, but got %v", err)
+	}
+	if err := actuator.requeueIfThrottled(machine, errors.New("failed")); err != nil {
+		t.Errorf("Expected no requeue for other errors, but got %v", err)
+	}
+}
+
+// metricValue returns the value of a gauge or counter.
+func metricValue(t *testing.T, metric prometheus.Metric) float64 {
+	t.Helper()
+	m := &dto.Metric{}
+	if err := metric.Write(m); err != nil {
+		t.Fatalf("Unexpected error occurred reading metric: %v", err)
+	}
+	if m.Gauge != nil {
+		return m.Gauge.GetValue()
+	}
+	return m.Counter.GetValue()
+}
@@ -0,0 +1,93 @@
+package machine
+
+import (
+	"fmt"
+
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	ovirtconfigv1 "github.com/openshift/cluster-api-provider-ovirt/pkg/apis/ovirtprovider/v1beta1"
+	"github.com/openshift/cluster-api-provider-ovirt/pkg/utils"
+	ovirtC "github.com/ovirt/go-ovirt-client/v2"
+	"github.com/pkg/errors"
+)
+
+// vmOwnershipError is returned if the VM recorded for the machine can't be verified to belong to the cluster.
+type vmOwnershipError struct {
+	id     ovirtC.VMID
+	reason string
+}
+
+func (e *vmOwnershipError) Error() string {
+	return fmt.Sprintf("refusing to delete VM %s: %s", e.id, e.reason)
+}
+
+// isVMOwnershipError returns true if the error is caused by a VM which failed the ownership verification.
+func isVMOwnershipError(err error) bool {
+	var ownershipErr *vmOwnershipError
+	return errors.As(err, &ownershipErr)
+}
+
+// clusterTag returns the name of the oVirt tag which marks the VMs of the cluster.
+func (ms *machineScope) clusterTag() string {
+	return ms.machine.Labels[machinev1.MachineClusterIDLabel]
+}
+
+// ownershipMarker returns the marker which is stored in the comment of the VM on creation.
+// Contrary to the cluster tag, the marker is set atomically with the creation of the VM and
+// therefore identifies VMs whose creation was interrupted before the tag was added.
+// An empty marker is returned if the machine doesn't have the cluster label.
+func (ms *machineScope) ownershipMarker() string {
+	return utils.OwnershipMarker(ms.clusterTag())
+}
+
+// hasOwnershipMarker returns true if one of the lines of the VM comment is the ownership marker.
+func (ms *machineScope) hasOwnershipMarker(vm ovirtC.VM) bool {
+	return utils.HasOwnershipMarker(vm.Comment(), ms.clusterTag())
+}
+
+// isOwned returns true if the VM carries the ownership marker or is tagged with the cluster tag.
+// Machines without the cluster label can't be verified and are considered to own the VM.
+func (ms *machineScope) isOwned(vm ovirtC.VM) (bool, error) {
+	tagName := ms.clusterTag()
+	if tagName == "" {
+		return true, nil
+	}
+	if ms.hasOwnershipMarker(vm) {
+		return true, nil
+	}
+	tags, err := ms.ovirtClient.ListVMTags(vm.ID(), ovirtC.ContextStrategy(ms.Context))
+	if err != nil {
+		return false, errors.Wrapf(err, "failed to list tags of VM %s", vm.ID())
+	}
+	for _, tag := range tags {
+		if tag.Name() == tagName {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// verifyOwnership checks that the VM is the instance recorded in the provider status and that it
+// belongs to the cluster. A vmOwnershipError is returned if one of the checks fails.
+func (ms *machineScope) verifyOwnership(vm ovirtC.VM) error {
+	providerStatus, err := ovirtconfigv1.ProviderStatusFromRawExtension(ms.machine.Status.ProviderStatus)
+	if err != nil {
+		return err
+	}
+	if providerStatus.InstanceID != nil && *providerStatus.InstanceID != "" && *providerStatus.InstanceID != string(vm.ID()) {
+		return &vmOwnershipError{
+			id:     vm.ID(),
+			reason: fmt.Sprintf("the VM doesn't match the recorded instance ID %s", *providerStatus.InstanceID),
+		}
+	}
+	owned, err := ms.isOwned(vm)
+	if err != nil {
+		return err
+	}
+	if !owned {
+		return &vmOwnershipError{
+			id:     vm.ID(),
+			reason: fmt.Sprintf("the VM is neither tagged with cluster tag %s nor carries the ownership marker", ms.clusterTag()),
+		}
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+//go:build unit
+
+package machine
+
+import (
+	"context"
+	"testing"
+
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	"github.com/openshift/cluster-api-provider-ovirt/pkg/apis/ovirtprovider/v1beta1"
+	"github.com/openshift/cluster-api-provider-ovirt/pkg/ovirt"
+	"github.com/openshift/cluster-api-provider-ovirt/pkg/utils"
+	ovirtclient "github.com/ovirt/go-ovirt-client/v2"
+	"k8s.io/apimachinery/pkg/api/meta"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestMachineScope_DeleteVerifiesOwnership(t *testing.T) {
+	recordID := func(ms *machineScope, id ovirtclient.VMID) {
+		providerID := utils.ProviderIDPrefix + string(id)
+		ms.machine.Spec.ProviderID = &providerID
+	}
+
+	testcases := []struct {
+		name            string
+		setup           func(t *testing.T, helper ovirtclient.TestHelper, ms *machineScope) ovirtclient.VMID
+		expectedError   func(err error) bool
+		expectedDeleted bool
+	}{
+		{
+			name: "tagged VM is deleted",
+			setup: func(t *testing.T, helper ovirtclient.TestHelper, ms *machineScope) ovirtclient.VMID {
+				vm := createTestVM(t, helper, "test-machine", "test-cluster")
+				recordID(ms, vm.ID())
+				return vm.ID()
+			},
+			expectedDeleted: true,
+		},
+		{
+			name: "VM with ownership marker but without tag is deleted",
+			setup: func(t *testing.T, helper ovirtclient.TestHelper, ms *machineScope) ovirtclient.VMID {
+				params := ovirtclient.CreateVMParams().MustWithComment(ms.ownershipMarker())
+				vm, err := helper.GetClient().CreateVM(helper.GetClusterID(), helper.GetBlankTemplateID(), "test-machine", params)
+				if err != nil {
+					t.Fatalf("Unexpected error occurred creating VM: %v", err)
+				}
+				return vm.ID()
+			},
+			expectedDeleted: true,
+		},
+		{
+			name: "recorded VM without tag and ownership marker is not deleted",
+			setup: func(t *testing.T, helper ovirtclient.TestHelper, ms *machineScope) ovirtclient.VMID {
+				vm := createTestVM(t, helper, "other-vm", "")
+				recordID(ms, vm.ID())
+				return vm.ID()
+			},
+			expectedError: isVMOwnershipError,
+		},
+		{
+			name: "VM not matching the recorded instance ID is not deleted",
+			setup: func(t *testing.T, helper ovirtclient.TestHelper, ms *machineScope) ovirtclient.VMID {
+				vm := createTestVM(t, helper, "test-machine", "test-cluster")
+				recordID(ms, vm.ID())
+				ms.updateProviderStatusOrLog(func(providerStatus *v1beta1.OvirtMachineProviderStatus) {
+					instanceID := "00000000-0000-0000-0000-000000000000"
+					providerStatus.InstanceID = &instanceID
+				})
+				return vm.ID()
+			},
+			expectedError: isVMOwnershipError,
+		},
+		{
+			name: "VM with the machine name of another cluster is not deleted",
+			setup: func(t *testing.T, helper ovirtclient.TestHelper, ms *machineScope) ovirtclient.VMID {
+				return createTestVM(t, helper, "test-machine", "other-cluster").ID()
+			},
+			expectedError: isVMNameCollision,
+		},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.name, func(t *testing.T) {
+			helper, err := ovirtclient.NewMockTestHelper(ovirt.NewKLogr("go-ovirt-client"))
+			if err != nil {
+				t.Fatalf("Unexpected error occurred setting up test helper: %v", err)
+			}
+			ms := &machineScope{
+				Context:     context.Background(),
+				logger:      ovirt.NewKLogr("machine-scope"),
+				ovirtClient: helper.GetClient(),
+				machine: &machinev1.Machine{
+					ObjectMeta: v1.ObjectMeta{
+						Name:   "test-machine",
+						Labels: map[string]string{machinev1.MachineClusterIDLabel: "test-cluster"},
+					},
+				},
+			}
+			vmID := testcase.setup(t, helper, ms)
+
+			err = ms.delete()
+			if testcase.expectedError != nil {
+				if err == nil || !testcase.expectedError(err) {
+					t.Fatalf("Expected a different error, but got %v", err)
+				}
+			} else if err != nil {
+				t.Fatalf("Unexpected error occurred deleting VM: %v", err)
+			}
+
+			_, err = helper.GetClient().GetVM(vmID)
+			deleted := err != nil && ovirtclient.HasErrorCode(err, ovirtclient.ENotFound)
+			if deleted != testcase.expectedDeleted {
+				t.Errorf("Expected VM to be deleted: %t, but got %t (%v)", testcase.expectedDeleted, deleted, err)
+			}
+
+			providerStatus, err := v1beta1.ProviderStatusFromRawExtension(ms.machine.Status.ProviderStatus)
+			if err != nil {
+				t.Fatalf("Unexpected error occurred parsing provider status: %v", err)
+			}
+			if verified := meta.IsStatusConditionTrue(providerStatus.Conditions, v1beta1.OwnershipVerifiedCondition); verified != testcase.expectedDeleted {
+				t.Errorf("Expected condition %s to be %t, but got %t",
+					v1beta1.OwnershipVerifiedCondition, testcase.expectedDeleted, verified)
+			}
+		})
+	}
+}
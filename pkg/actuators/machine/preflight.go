@@ -0,0 +1,344 @@
+package machine
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/openshift/cluster-api-provider-ovirt/pkg/ovirt"
+	ovirtsdk "github.com/ovirt/go-ovirt"
+	ovirtC "github.com/ovirt/go-ovirt-client/v2"
+	"github.com/pkg/errors"
+)
+
+const (
+	// bytesInGiB is the number of bytes in a GiB, the unit of the disk sizes of the provider spec.
+	bytesInGiB = 1024 * 1024 * 1024
+	// minHugepagesClusterMajor and minHugepagesClusterMinor are the oldest cluster compatibility
+	// version supporting the hugepages custom property.
+	minHugepagesClusterMajor = 4
+	minHugepagesClusterMinor = 2
+)
+
+// preflightError lists the problems of the provider spec found by the preflight checks.
+type preflightError struct {
+	problems []string
+}
+
+func (e *preflightError) Error() string {
+	return fmt.Sprintf("preflight checks failed: %s", strings.Join(e.problems, "; "))
+}
+
+// add records the error as a problem of the provider spec. Errors communicating with the engine
+// aren't problems of the provider spec and are returned, so the preflight is retried.
+func (e *preflightError) add(err error) error {
+	var engineErr ovirtC.EngineError
+	if errors.As(err, &engineErr) && engineErr.CanAutoRetry() || isEngineThrottled(err) || isTransientSDKError(err) {
+		return err
+	}
+	e.problems = append(e.problems, err.Error())
+	return nil
+}
+
+// isTransientSDKError returns true if a call through the underlying oVirt SDK connection failed because
+// the engine couldn't be reached or its response couldn't be parsed. Other SDK errors aren't typed and
+// are treated as permanent.
+func isTransientSDKError(err error) bool {
+	var netErr net.Error
+	var parseErr *ovirtsdk.ResponseParseError
+	return errors.As(err, &netErr) || errors.As(err, &parseErr)
+}
+
+// addf records a problem of the provider spec.
+func (e *preflightError) addf(format string, args ...interface{}) {
+	e.problems = append(e.problems, fmt.Sprintf(format, args...))
+}
+
+// isPreflightError returns true if the provider spec failed the preflight checks.
+func isPreflightError(err error) bool {
+	var preflightErr *preflightError
+	return errors.As(err, &preflightErr)
+}
+
+// preflight checks the provider spec against the engine before the VM is created, so that all
+// problems of the provider spec are reported at once instead of failing midway through the creation.
+// The problems are returned as a *preflightError. If the checks pass, the resolved template is returned,
+// so it doesn't have to be looked up again for creating the VM.
+func (ms *machineScope) preflight() (ovirtC.Template, error) {
+	spec := ms.machineProviderSpec
+	result := &preflightError{}
+
+	cluster, err := ms.ovirtClient.GetCluster(ovirtC.ClusterID(spec.ClusterId), ovirtC.ContextStrategy(ms.Context))
+	if err != nil {
+		if err := result.add(errors.Wrapf(err, "cluster %s", spec.ClusterId)); err != nil {
+			return nil, err
+		}
+		// all other checks depend on the cluster
+		return nil, result
+	}
+
+	template, err := ms.resolveTemplate()
+	if err != nil {
+		if err := result.add(err); err != nil {
+			return nil, err
+		}
+	}
+	checks := []func(*preflightError) error{
+		func(result *preflightError) error { return ms.checkStorageDomains(result, template) },
+		ms.checkVNICProfiles,
+		ms.checkAffinityGroups,
+		ms.checkInstanceType,
+		func(result *preflightError) error { return ms.checkHugepages(result, cluster) },
+		func(result *preflightError) error { return ms.checkHostCapacity(result, cluster) },
+	}
+	for _, check := range checks {
+		if err := check(result); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(result.problems) > 0 {
+		return nil, result
+	}
+	return template, nil
+}
+
+// checkStorageDomains checks that the storage domains of the disks are active and have enough free
+// space for the disks. The OS disk is created in the storage domain of the template disk, unless the
+// provider spec overrides it.
+func (ms *machineScope) checkStorageDomains(result *preflightError, template ovirtC.Template) error {
+	spec := ms.machineProviderSpec
+	required := map[ovirtC.StorageDomainID]uint64{}
+	var storageDomainIDs []ovirtC.StorageDomainID
+	require := func(id ovirtC.StorageDomainID, sizeGB int64) {
+		if _, ok := required[id]; !ok {
+			storageDomainIDs = append(storageDomainIDs, id)
+		}
+		required[id] += uint64(sizeGB) * bytesInGiB
+	}
+
+	if spec.OSDisk != nil {
+		osDiskStorageDomainID := ovirtC.StorageDomainID(spec.StorageDomainId)
+		if osDiskStorageDomainID == "" && template != nil {
+			storageDomainID, err := ms.templateStorageDomain(template)
+			if err != nil {
+				return err
+			}
+			osDiskStorageDomainID = storageDomainID
+		}
+		if osDiskStorageDomainID != "" {
+			require(osDiskStorageDomainID, spec.OSDisk.SizeGB)
+		}
+	}
+	for _, disk := range spec.AdditionalDisks {
+		storageDomainID := disk.StorageDomainId
+		if storageDomainID == "" {
+			storageDomainID = spec.StorageDomainId
+		}
+		require(ovirtC.StorageDomainID(storageDomainID), disk.SizeGB)
+	}
+
+	for _, id := range storageDomainIDs {
+		storageDomain, err := ms.ovirtClient.GetStorageDomain(id, ovirtC.ContextStrategy(ms.Context))
+		if err != nil {
+			if err := result.add(errors.Wrapf(err, "storage domain %s", id)); err != nil {
+				return err
+			}
+			continue
+		}
+		if storageDomain.Status() != ovirtC.StorageDomainStatusActive {
+			result.addf("storage domain %s is %s, not %s",
+				storageDomain.Name(), storageDomain.Status(), ovirtC.StorageDomainStatusActive)
+			continue
+		}
+		if storageDomain.Available() < required[id] {
+			result.addf("storage domain %s has %d GiB available, but the disks require %d GiB",
+				storageDomain.Name(), storageDomain.Available()/bytesInGiB, required[id]/bytesInGiB)
+		}
+	}
+	return nil
+}
+
+// templateStorageDomain returns the storage domain of the first disk of the template, or an empty ID
+// if the template has no disks.
+func (ms *machineScope) templateStorageDomain(template ovirtC.Template) (ovirtC.StorageDomainID, error) {
+	diskAttachments, err := ms.ovirtClient.ListTemplateDiskAttachments(template.ID(), ovirtC.ContextStrategy(ms.Context))
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to list disk attachments of template %s", template.ID())
+	}
+	if len(diskAttachments) == 0 {
+		return "", nil
+	}
+	disk, err := ms.ovirtClient.GetDisk(diskAttachments[0].DiskID(), ovirtC.ContextStrategy(ms.Context))
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to get disk %s of template %s", diskAttachments[0].DiskID(), template.ID())
+	}
+	if storageDomainIDs := disk.StorageDomainIDs(); len(storageDomainIDs) > 0 {
+		return storageDomainIDs[0], nil
+	}
+	return "", nil
+}
+
+// checkVNICProfiles checks that the vNic profiles of the network interfaces exist and belong to the
+// datacenter of the oVirt cluster.
+func (ms *machineScope) checkVNICProfiles(result *preflightError) error {
+	spec := ms.machineProviderSpec
+	if len(spec.NetworkInterfaces) == 0 {
+		return nil
+	}
+	datacenter, err := ms.clusterDatacenter()
+	if err != nil {
+		return result.add(err)
+	}
+	for i, nic := range spec.NetworkInterfaces {
+		profileID, err := resolveVNICProfileID(ms.ovirtClient, datacenter, nic, ovirtC.ContextStrategy(ms.Context))
+		if err == nil {
+			err = verifyVNICProfile(ms.ovirtClient, datacenter, profileID, ovirtC.ContextStrategy(ms.Context))
+		}
+		if err != nil {
+			if err := result.add(fmt.Errorf("network interface %d: %w", i+1, err)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// checkAffinityGroups checks that the affinity groups exist in the oVirt cluster.
+func (ms *machineScope) checkAffinityGroups(result *preflightError) error {
+	spec := ms.machineProviderSpec
+	for _, name := range spec.AffinityGroupsNames {
+		_, err := ms.ovirtClient.GetAffinityGroupByName(ovirtC.ClusterID(spec.ClusterId), name, ovirtC.ContextStrategy(ms.Context))
+		if err != nil {
+			if err := result.add(errors.Wrapf(err, "affinity group %s", name)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// checkInstanceType checks that the instance type exists.
+func (ms *machineScope) checkInstanceType(result *preflightError) error {
+	id := ms.machineProviderSpec.InstanceTypeId
+	if id == "" {
+		return nil
+	}
+	if _, err := ms.ovirtClient.GetInstanceType(ovirtC.InstanceTypeID(id), ovirtC.ContextStrategy(ms.Context)); err != nil {
+		return result.add(errors.Wrapf(err, "instance type %s", id))
+	}
+	return nil
+}
+
+// checkHugepages checks that the compatibility version of the oVirt cluster supports the hugepages
+// custom property. The go-ovirt-client doesn't return the cluster version, therefore the underlying
+// oVirt SDK connection is used.
+func (ms *machineScope) checkHugepages(result *preflightError, cluster ovirtC.Cluster) error {
+	if ms.machineProviderSpec.Hugepages == 0 {
+		return nil
+	}
+	legacyClient, ok := ms.ovirtClient.(ovirtC.ClientWithLegacySupport)
+	if !ok {
+		ms.logger.Debugf("Skipping hugepages check of cluster %s, not supported by the oVirt client", cluster.ID())
+		return nil
+	}
+	var response *ovirtsdk.ClusterServiceGetResponse
+	err := ovirt.CallSDK(ms.Context, legacyClient, "GetCluster", func(conn *ovirtsdk.Connection) (err error) {
+		response, err = conn.SystemService().ClustersService().
+			ClusterService(string(cluster.ID())).Get().Send()
+		return err
+	})
+	if err != nil {
+		return errors.Wrapf(err, "failed to get cluster %s", cluster.ID())
+	}
+	sdkCluster, ok := response.Cluster()
+	if !ok {
+		return nil
+	}
+	version, ok := sdkCluster.Version()
+	if !ok {
+		return nil
+	}
+	major, majorOK := version.Major()
+	minor, minorOK := version.Minor()
+	if !majorOK || !minorOK {
+		return nil
+	}
+	if major < minHugepagesClusterMajor || (major == minHugepagesClusterMajor && minor < minHugepagesClusterMinor) {
+		result.addf("hugepages require cluster compatibility version %d.%d, but cluster %s has version %d.%d",
+			minHugepagesClusterMajor, minHugepagesClusterMinor, cluster.Name(), major, minor)
+	}
+	return nil
+}
+
+// checkHostCapacity checks that the requested memory and CPUs fit on at least one host of the oVirt
+// cluster which is up. The hardware of an instance type isn't checked. The go-ovirt-client doesn't
+// return the memory and CPUs of hosts, therefore the underlying oVirt SDK connection is used.
+func (ms *machineScope) checkHostCapacity(result *preflightError, cluster ovirtC.Cluster) error {
+	spec := ms.machineProviderSpec
+	if spec.InstanceTypeId != "" || spec.CPU == nil {
+		return nil
+	}
+	legacyClient, ok := ms.ovirtClient.(ovirtC.ClientWithLegacySupport)
+	if !ok {
+		ms.logger.Debugf("Skipping host capacity check of cluster %s, not supported by the oVirt client", cluster.ID())
+		return nil
+	}
+	var response *ovirtsdk.HostsServiceListResponse
+	err := ovirt.CallSDK(ms.Context, legacyClient, "ListHosts", func(conn *ovirtsdk.Connection) (err error) {
+		response, err = conn.SystemService().HostsService().List().
+			Search(fmt.Sprintf("cluster=%s", searchValue(cluster.Name()))).
+			Send()
+		return err
+	})
+	if err != nil {
+		return errors.Wrapf(err, "failed to list hosts of cluster %s", cluster.Name())
+	}
+
+	memory := int64(spec.MemoryMB) * bytesInMB
+	cpus := int64(spec.CPU.Sockets) * int64(spec.CPU.Cores) * int64(spec.CPU.Threads)
+	hosts, ok := response.Hosts()
+	if !ok {
+		return fmt.Errorf("no hosts returned for cluster %s", cluster.Name())
+	}
+	hostsUp := 0
+	for _, host := range hosts.Slice() {
+		if status, ok := host.Status(); !ok || status != ovirtsdk.HOSTSTATUS_UP {
+			continue
+		}
+		hostsUp++
+		if hostMemory, ok := host.MaxSchedulingMemory(); !ok || hostMemory < memory {
+			continue
+		}
+		if hostCPUs(host) >= cpus {
+			return nil
+		}
+	}
+	// the hosts may be in maintenance temporarily, which isn't a problem of the provider spec
+	if hostsUp == 0 {
+		return fmt.Errorf("no host of cluster %s is up", cluster.Name())
+	}
+	result.addf("%d MiB memory and %d CPUs don't fit on any host of cluster %s",
+		spec.MemoryMB, cpus, cluster.Name())
+	return nil
+}
+
+// hostCPUs returns the number of logical CPUs of the host, or 0 if the engine didn't report the
+// CPU topology of the host.
+func hostCPUs(host *ovirtsdk.Host) int64 {
+	cpu, ok := host.Cpu()
+	if !ok {
+		return 0
+	}
+	topology, ok := cpu.Topology()
+	if !ok {
+		return 0
+	}
+	sockets, socketsOK := topology.Sockets()
+	cores, coresOK := topology.Cores()
+	threads, threadsOK := topology.Threads()
+	if !socketsOK || !coresOK || !threadsOK {
+		return 0
+	}
+	return sockets * cores * threads
+}
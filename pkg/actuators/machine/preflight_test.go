@@ -0,0 +1,301 @@
+//go:build unit
+
+package machine
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"syscall"
+	"testing"
+
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	"github.com/openshift/cluster-api-provider-ovirt/pkg/apis/ovirtprovider/v1beta1"
+	"github.com/openshift/cluster-api-provider-ovirt/pkg/ovirt"
+	ovirtsdk "github.com/ovirt/go-ovirt"
+	ovirtclient "github.com/ovirt/go-ovirt-client/v2"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestMachineScope_Preflight(t *testing.T) {
+	helper, err := ovirtclient.NewMockTestHelper(ovirt.NewKLogr("go-ovirt-client"))
+	if err != nil {
+		t.Fatalf("Unexpected error occurred setting up test helper: %v", err)
+	}
+	client := helper.GetClient()
+	template, err := client.GetBlankTemplate()
+	if err != nil {
+		t.Fatalf("Unexpected error occurred getting blank template: %v", err)
+	}
+	profile, err := client.GetVNICProfile(helper.GetVNICProfileID())
+	if err != nil {
+		t.Fatalf("Unexpected error occurred getting vNic profile: %v", err)
+	}
+	network, err := profile.Network()
+	if err != nil {
+		t.Fatalf("Unexpected error occurred getting network: %v", err)
+	}
+
+	testcases := []struct {
+		name             string
+		modify           func(spec *v1beta1.OvirtMachineProviderSpec)
+		expectedProblems int
+	}{
+		{
+			name:             "valid provider spec passes",
+			modify:           func(spec *v1beta1.OvirtMachineProviderSpec) {},
+			expectedProblems: 0,
+		},
+		{
+			name: "unknown cluster fails",
+			modify: func(spec *v1beta1.OvirtMachineProviderSpec) {
+				spec.ClusterId = "00000000-0000-0000-0000-000000000000"
+			},
+			expectedProblems: 1,
+		},
+		{
+			name: "unknown template fails",
+			modify: func(spec *v1beta1.OvirtMachineProviderSpec) {
+				spec.TemplateName = "unknown"
+			},
+			expectedProblems: 1,
+		},
+		{
+			name: "unknown storage domain fails",
+			modify: func(spec *v1beta1.OvirtMachineProviderSpec) {
+				spec.StorageDomainId = "00000000-0000-0000-0000-000000000000"
+			},
+			expectedProblems: 1,
+		},
+		{
+			name: "storage domain without enough free space fails",
+			modify: func(spec *v1beta1.OvirtMachineProviderSpec) {
+				spec.AdditionalDisks = []v1beta1.AdditionalDisk{{SizeGB: 100}}
+			},
+			expectedProblems: 1,
+		},
+		{
+			name: "vNic profile of the cluster datacenter passes",
+			modify: func(spec *v1beta1.OvirtMachineProviderSpec) {
+				spec.NetworkInterfaces = []*v1beta1.NetworkInterface{{VNICProfileID: string(helper.GetVNICProfileID())}}
+			},
+			expectedProblems: 0,
+		},
+		{
+			name: "unknown vNic profile ID fails",
+			modify: func(spec *v1beta1.OvirtMachineProviderSpec) {
+				spec.NetworkInterfaces = []*v1beta1.NetworkInterface{{VNICProfileID: "00000000-0000-0000-0000-000000000000"}}
+			},
+			expectedProblems: 1,
+		},
+		{
+			name: "network and profile name passes",
+			modify: func(spec *v1beta1.OvirtMachineProviderSpec) {
+				spec.NetworkInterfaces = []*v1beta1.NetworkInterface{{NetworkName: network.Name(), ProfileName: profile.Name()}}
+			},
+			expectedProblems: 0,
+		},
+		{
+			name: "unknown network name fails",
+			modify: func(spec *v1beta1.OvirtMachineProviderSpec) {
+				spec.NetworkInterfaces = []*v1beta1.NetworkInterface{{NetworkName: "unknown", ProfileName: profile.Name()}}
+			},
+			expectedProblems: 1,
+		},
+		{
+			name: "network of another datacenter fails",
+			modify: func(spec *v1beta1.OvirtMachineProviderSpec) {
+				spec.NetworkInterfaces = []*v1beta1.NetworkInterface{{
+					NetworkName:    network.Name(),
+					ProfileName:    profile.Name(),
+					DatacenterName: "other-datacenter",
+				}}
+			},
+			expectedProblems: 1,
+		},
+		{
+			name: "unknown affinity group fails",
+			modify: func(spec *v1beta1.OvirtMachineProviderSpec) {
+				spec.AffinityGroupsNames = []string{"unknown"}
+			},
+			expectedProblems: 1,
+		},
+		{
+			name: "unknown instance type fails",
+			modify: func(spec *v1beta1.OvirtMachineProviderSpec) {
+				spec.InstanceTypeId = "00000000-0000-0000-0000-000000000000"
+			},
+			expectedProblems: 1,
+		},
+		{
+			name: "all problems are listed at once",
+			modify: func(spec *v1beta1.OvirtMachineProviderSpec) {
+				spec.TemplateName = "unknown"
+				spec.AffinityGroupsNames = []string{"unknown"}
+				spec.NetworkInterfaces = []*v1beta1.NetworkInterface{{NetworkName: "unknown"}}
+			},
+			expectedProblems: 3,
+		},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.name, func(t *testing.T) {
+			spec := BasicValidSpec(func(spec *v1beta1.OvirtMachineProviderSpec) *v1beta1.OvirtMachineProviderSpec {
+				spec.ClusterId = string(helper.GetClusterID())
+				spec.TemplateName = template.Name()
+				spec.StorageDomainId = string(helper.GetStorageDomainID())
+				spec.OSDisk.SizeGB = 5
+				return spec
+			})
+			testcase.modify(spec)
+			ms := machineScope{
+				Context:             context.Background(),
+				logger:              ovirt.NewKLogr("machine-scope"),
+				ovirtClient:         client,
+				machine:             &machinev1.Machine{ObjectMeta: v1.ObjectMeta{Name: "test-machine"}},
+				machineProviderSpec: spec,
+			}
+
+			resolvedTemplate, err := ms.preflight()
+			if testcase.expectedProblems == 0 {
+				if err != nil {
+					t.Fatalf("Unexpected error occurred running preflight checks: %v", err)
+				}
+				if resolvedTemplate == nil || resolvedTemplate.ID() != template.ID() {
+					t.Errorf("Expected preflight to resolve template %s, but got %v", template.ID(), resolvedTemplate)
+				}
+				return
+			}
+			preflightErr, ok := err.(*preflightError)
+			if !ok {
+				t.Fatalf("Expected preflight error, but got %v", err)
+			}
+			if len(preflightErr.problems) != testcase.expectedProblems {
+				t.Errorf("Expected %d problems, but got %d: %v", testcase.expectedProblems, len(preflightErr.problems), err)
+			}
+		})
+	}
+}
+
+// datacenterCountingClient counts the datacenter lookups of the machine scope.
+type datacenterCountingClient struct {
+	ovirtclient.Client
+	listDatacenters int
+}
+
+func (c *datacenterCountingClient) ListDatacenters(retries ...ovirtclient.RetryStrategy) ([]ovirtclient.Datacenter, error) {
+	c.listDatacenters++
+	return c.Client.ListDatacenters(retries...)
+}
+
+func TestMachineScope_PreflightLooksUpDatacenterOnce(t *testing.T) {
+	helper, err := ovirtclient.NewMockTestHelper(ovirt.NewKLogr("go-ovirt-client"))
+	if err != nil {
+		t.Fatalf("Unexpected error occurred setting up test helper: %v", err)
+	}
+	client := &datacenterCountingClient{Client: helper.GetClient()}
+	template, err := client.GetBlankTemplate()
+	if err != nil {
+		t.Fatalf("Unexpected error occurred getting blank template: %v", err)
+	}
+	spec := BasicValidSpec(func(spec *v1beta1.OvirtMachineProviderSpec) *v1beta1.OvirtMachineProviderSpec {
+		spec.ClusterId = string(helper.GetClusterID())
+		spec.TemplateName = template.Name()
+		spec.StorageDomainId = string(helper.GetStorageDomainID())
+		spec.OSDisk.SizeGB = 5
+		spec.NetworkInterfaces = []*v1beta1.NetworkInterface{
+			{VNICProfileID: string(helper.GetVNICProfileID())},
+			{VNICProfileID: string(helper.GetVNICProfileID())},
+		}
+		return spec
+	})
+	ms := machineScope{
+		Context:             context.Background(),
+		logger:              ovirt.NewKLogr("machine-scope"),
+		ovirtClient:         client,
+		machine:             &machinev1.Machine{ObjectMeta: v1.ObjectMeta{Name: "test-machine"}},
+		machineProviderSpec: spec,
+	}
+
+	if _, err := ms.preflight(); err != nil {
+		t.Fatalf("Unexpected error occurred running preflight checks: %v", err)
+	}
+	if client.listDatacenters != 1 {
+		t.Errorf("Expected the datacenter to be looked up once, but got %d lookups", client.listDatacenters)
+	}
+}
+
+func TestPreflightErrorAdd(t *testing.T) {
+	testcases := []struct {
+		name            string
+		err             error
+		expectedProblem bool
+	}{
+		{
+			name:            "missing object is a problem of the provider spec",
+			err:             errors.New("version 3 of template rhcos not found"),
+			expectedProblem: true,
+		},
+		{
+			name:            "SDK not found error is a problem of the provider spec",
+			err:             &ovirtsdk.NotFoundError{},
+			expectedProblem: true,
+		},
+		{
+			name:            "SDK connection error is retried",
+			err:             &url.Error{Op: "Get", URL: "https://engine/ovirt-engine/api", Err: syscall.ECONNREFUSED},
+			expectedProblem: false,
+		},
+		{
+			name:            "SDK response parse error is retried",
+			err:             &ovirtsdk.ResponseParseError{},
+			expectedProblem: false,
+		},
+		{
+			name:            "untyped SDK error is a problem of the provider spec",
+			err:             errors.New(`HTTP response code is "503". HTTP response message is "503 Service Unavailable".`),
+			expectedProblem: true,
+		},
+	}
+	for _, testcase := range testcases {
+		t.Run(testcase.name, func(t *testing.T) {
+			result := &preflightError{}
+			err := result.add(testcase.err)
+			if testcase.expectedProblem && (err != nil || len(result.problems) != 1) {
+				t.Errorf("Expected the error to be recorded as a problem, but got %v and %v", err, result.problems)
+			}
+			if !testcase.expectedProblem && (err == nil || len(result.problems) != 0) {
+				t.Errorf("Expected the error to be returned, but got %v and %v", err, result.problems)
+			}
+		})
+	}
+}
+
+func TestHostCPUs(t *testing.T) {
+	testcases := []struct {
+		name     string
+		topology *ovirtsdk.CpuTopologyBuilder
+		expected int64
+	}{
+		{
+			name:     "complete topology",
+			topology: ovirtsdk.NewCpuTopologyBuilder().Sockets(2).Cores(4).Threads(2),
+			expected: 16,
+		},
+		{
+			name:     "incomplete topology",
+			topology: ovirtsdk.NewCpuTopologyBuilder().Sockets(2).Cores(4),
+			expected: 0,
+		},
+	}
+	for _, testcase := range testcases {
+		t.Run(testcase.name, func(t *testing.T) {
+			host := ovirtsdk.NewHostBuilder().
+				Cpu(ovirtsdk.NewCpuBuilder().Topology(testcase.topology.MustBuild()).MustBuild()).
+				MustBuild()
+			if cpus := hostCPUs(host); cpus != testcase.expected {
+				t.Errorf("Expected %d CPUs, but got %d", testcase.expected, cpus)
+			}
+		})
+	}
+}
@@ -0,0 +1,140 @@
+package machine
+
+import (
+	"fmt"
+
+	ovirtconfigv1 "github.com/openshift/cluster-api-provider-ovirt/pkg/apis/ovirtprovider/v1beta1"
+	ovirtC "github.com/ovirt/go-ovirt-client/v2"
+	"github.com/pkg/errors"
+)
+
+// invalidReferenceError is returned if a reference of the provider spec is invalid, e.g. because no or
+// several oVirt objects have the referenced name. It is a problem of the provider spec, contrary to a
+// failure to list the objects, which can be retried.
+type invalidReferenceError struct {
+	message string
+}
+
+func (e *invalidReferenceError) Error() string {
+	return e.message
+}
+
+// isInvalidReference returns true if a reference of the provider spec can't be resolved.
+func isInvalidReference(err error) bool {
+	var referenceErr *invalidReferenceError
+	return errors.As(err, &referenceErr)
+}
+
+// resolveReferences resolves the name-based references of the provider spec to the IDs of the oVirt
+// objects and sets them in the provider spec, so that the rest of the actuator only deals with IDs.
+// A reference can be given either by ID or by name, but not both. References which can't be resolved
+// are returned as an *invalidReferenceError, all other errors are failures to list the objects.
+func resolveReferences(ovirtClient ovirtC.Client, config *ovirtconfigv1.OvirtMachineProviderSpec, retries ...ovirtC.RetryStrategy) error {
+	if config.ClusterName != "" {
+		if config.ClusterId != "" {
+			return &invalidReferenceError{message: fmt.Sprintf("%s ClusterId and ClusterName cannot be set at the same time", ErrorInvalidMachineObject)}
+		}
+		clusterID, err := resolveClusterID(ovirtClient, config.ClusterName, retries...)
+		if err != nil {
+			return err
+		}
+		config.ClusterId = string(clusterID)
+	}
+
+	if config.StorageDomainName != "" {
+		if config.StorageDomainId != "" {
+			return &invalidReferenceError{message: fmt.Sprintf("%s StorageDomainId and StorageDomainName cannot be set at the same time", ErrorInvalidMachineObject)}
+		}
+		storageDomainID, err := resolveStorageDomainID(ovirtClient, config.StorageDomainName, retries...)
+		if err != nil {
+			return err
+		}
+		config.StorageDomainId = string(storageDomainID)
+	}
+
+	if config.InstanceTypeName != "" {
+		if config.InstanceTypeId != "" {
+			return &invalidReferenceError{message: fmt.Sprintf("%s InstanceTypeId and InstanceTypeName cannot be set at the same time", ErrorInvalidMachineObject)}
+		}
+		instanceTypeID, err := resolveInstanceTypeID(ovirtClient, config.InstanceTypeName, retries...)
+		if err != nil {
+			return err
+		}
+		config.InstanceTypeId = string(instanceTypeID)
+	}
+	return nil
+}
+
+// resolveClusterID returns the ID of the only oVirt cluster with the given name.
+func resolveClusterID(ovirtClient ovirtC.Client, name string, retries ...ovirtC.RetryStrategy) (ovirtC.ClusterID, error) {
+	clusters, err := ovirtClient.ListClusters(retries...)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to list clusters")
+	}
+	var clusterID ovirtC.ClusterID
+	for _, cluster := range clusters {
+		if cluster.Name() != name {
+			continue
+		}
+		if clusterID != "" {
+			return "", ambiguousNameError("cluster", name)
+		}
+		clusterID = cluster.ID()
+	}
+	if clusterID == "" {
+		return "", notFoundError("cluster", name)
+	}
+	return clusterID, nil
+}
+
+// resolveStorageDomainID returns the ID of the only storage domain with the given name.
+func resolveStorageDomainID(ovirtClient ovirtC.Client, name string, retries ...ovirtC.RetryStrategy) (ovirtC.StorageDomainID, error) {
+	storageDomains, err := ovirtClient.ListStorageDomains(retries...)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to list storage domains")
+	}
+	var storageDomainID ovirtC.StorageDomainID
+	for _, storageDomain := range storageDomains {
+		if storageDomain.Name() != name {
+			continue
+		}
+		if storageDomainID != "" {
+			return "", ambiguousNameError("storage domain", name)
+		}
+		storageDomainID = storageDomain.ID()
+	}
+	if storageDomainID == "" {
+		return "", notFoundError("storage domain", name)
+	}
+	return storageDomainID, nil
+}
+
+// resolveInstanceTypeID returns the ID of the only instance type with the given name.
+func resolveInstanceTypeID(ovirtClient ovirtC.Client, name string, retries ...ovirtC.RetryStrategy) (ovirtC.InstanceTypeID, error) {
+	instanceTypes, err := ovirtClient.ListInstanceTypes(retries...)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to list instance types")
+	}
+	var instanceTypeID ovirtC.InstanceTypeID
+	for _, instanceType := range instanceTypes {
+		if instanceType.Name() != name {
+			continue
+		}
+		if instanceTypeID != "" {
+			return "", ambiguousNameError("instance type", name)
+		}
+		instanceTypeID = instanceType.ID()
+	}
+	if instanceTypeID == "" {
+		return "", notFoundError("instance type", name)
+	}
+	return instanceTypeID, nil
+}
+
+func ambiguousNameError(kind string, name string) error {
+	return &invalidReferenceError{message: fmt.Sprintf("%s name %s is ambiguous", kind, name)}
+}
+
+func notFoundError(kind string, name string) error {
+	return &invalidReferenceError{message: fmt.Sprintf("%s %s not found", kind, name)}
+}
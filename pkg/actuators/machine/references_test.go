@@ -0,0 +1,196 @@
+//go:build unit
+
+package machine
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/openshift/cluster-api-provider-ovirt/pkg/apis/ovirtprovider/v1beta1"
+	"github.com/openshift/cluster-api-provider-ovirt/pkg/ovirt"
+	ovirtclient "github.com/ovirt/go-ovirt-client/v2"
+)
+
+// referencesClient lists the given objects instead of the ones of the mock, so names can be made unique
+// or ambiguous, and fails listing them with listErr.
+type referencesClient struct {
+	ovirtclient.Client
+	clusters       []ovirtclient.Cluster
+	storageDomains ovirtclient.StorageDomainList
+	instanceTypes  []ovirtclient.InstanceType
+	listErr        error
+}
+
+func (c *referencesClient) ListClusters(retries ...ovirtclient.RetryStrategy) ([]ovirtclient.Cluster, error) {
+	if c.listErr != nil {
+		return nil, c.listErr
+	}
+	if c.clusters == nil {
+		return c.Client.ListClusters(retries...)
+	}
+	return c.clusters, nil
+}
+
+func (c *referencesClient) ListStorageDomains(retries ...ovirtclient.RetryStrategy) (ovirtclient.StorageDomainList, error) {
+	if c.listErr != nil {
+		return nil, c.listErr
+	}
+	if c.storageDomains == nil {
+		return c.Client.ListStorageDomains(retries...)
+	}
+	return c.storageDomains, nil
+}
+
+func (c *referencesClient) ListInstanceTypes(retries ...ovirtclient.RetryStrategy) ([]ovirtclient.InstanceType, error) {
+	if c.listErr != nil {
+		return nil, c.listErr
+	}
+	if c.instanceTypes == nil {
+		return c.Client.ListInstanceTypes(retries...)
+	}
+	return c.instanceTypes, nil
+}
+
+func TestResolveReferences(t *testing.T) {
+	helper, err := ovirtclient.NewMockTestHelper(ovirt.NewKLogr("go-ovirt-client"))
+	if err != nil {
+		t.Fatalf("Unexpected error occurred setting up test helper: %v", err)
+	}
+	client := helper.GetClient()
+	cluster, err := client.GetCluster(helper.GetClusterID())
+	if err != nil {
+		t.Fatalf("Unexpected error occurred getting cluster: %v", err)
+	}
+	storageDomain, err := client.GetStorageDomain(helper.GetStorageDomainID())
+	if err != nil {
+		t.Fatalf("Unexpected error occurred getting storage domain: %v", err)
+	}
+	instanceTypes, err := client.ListInstanceTypes()
+	if err != nil || len(instanceTypes) == 0 {
+		t.Fatalf("Unexpected error occurred listing instance types: %v", err)
+	}
+	instanceType := instanceTypes[0]
+
+	testcases := []struct {
+		name                    string
+		client                  *referencesClient
+		spec                    v1beta1.OvirtMachineProviderSpec
+		expectedClusterID       string
+		expectedStorageDomainID string
+		expectedInstanceTypeID  string
+		expectError             bool
+		expectInvalidReference  bool
+	}{
+		{
+			name:                    "IDs are kept",
+			spec:                    v1beta1.OvirtMachineProviderSpec{ClusterId: "cluster", StorageDomainId: "storage"},
+			expectedClusterID:       "cluster",
+			expectedStorageDomainID: "storage",
+		},
+		{
+			name:                    "names are resolved",
+			spec:                    v1beta1.OvirtMachineProviderSpec{ClusterName: cluster.Name(), StorageDomainId: "storage"},
+			expectedClusterID:       string(cluster.ID()),
+			expectedStorageDomainID: "storage",
+		},
+		{
+			name: "unique names are resolved",
+			client: &referencesClient{
+				storageDomains: ovirtclient.StorageDomainList{storageDomain},
+				instanceTypes:  []ovirtclient.InstanceType{instanceType},
+			},
+			spec: v1beta1.OvirtMachineProviderSpec{
+				ClusterName:       cluster.Name(),
+				StorageDomainName: storageDomain.Name(),
+				InstanceTypeName:  instanceType.Name(),
+			},
+			expectedClusterID:       string(cluster.ID()),
+			expectedStorageDomainID: string(storageDomain.ID()),
+			expectedInstanceTypeID:  string(instanceType.ID()),
+		},
+		{
+			// the mock has two storage domains with the same name
+			name:                   "ambiguous storage domain name",
+			spec:                   v1beta1.OvirtMachineProviderSpec{StorageDomainName: storageDomain.Name()},
+			expectError:            true,
+			expectInvalidReference: true,
+		},
+		{
+			name:                   "ambiguous cluster name",
+			client:                 &referencesClient{clusters: []ovirtclient.Cluster{cluster, cluster}},
+			spec:                   v1beta1.OvirtMachineProviderSpec{ClusterName: cluster.Name()},
+			expectError:            true,
+			expectInvalidReference: true,
+		},
+		{
+			name:                   "ambiguous instance type name",
+			client:                 &referencesClient{instanceTypes: []ovirtclient.InstanceType{instanceType, instanceType}},
+			spec:                   v1beta1.OvirtMachineProviderSpec{InstanceTypeName: instanceType.Name()},
+			expectError:            true,
+			expectInvalidReference: true,
+		},
+		{
+			name:        "failure listing clusters is retryable",
+			client:      &referencesClient{listErr: errors.New("connection refused")},
+			spec:        v1beta1.OvirtMachineProviderSpec{ClusterName: cluster.Name()},
+			expectError: true,
+		},
+		{
+			name:                   "ID and name are exclusive",
+			spec:                   v1beta1.OvirtMachineProviderSpec{ClusterId: "cluster", ClusterName: cluster.Name()},
+			expectError:            true,
+			expectInvalidReference: true,
+		},
+		{
+			name:                   "unknown cluster name",
+			spec:                   v1beta1.OvirtMachineProviderSpec{ClusterName: "not-existing"},
+			expectError:            true,
+			expectInvalidReference: true,
+		},
+		{
+			name:                   "unknown storage domain name",
+			spec:                   v1beta1.OvirtMachineProviderSpec{StorageDomainName: "not-existing"},
+			expectError:            true,
+			expectInvalidReference: true,
+		},
+		{
+			name:                   "unknown instance type name",
+			spec:                   v1beta1.OvirtMachineProviderSpec{InstanceTypeName: "not-existing"},
+			expectError:            true,
+			expectInvalidReference: true,
+		},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.name, func(t *testing.T) {
+			spec := testcase.spec
+			var testClient ovirtclient.Client = client
+			if testcase.client != nil {
+				testcase.client.Client = client
+				testClient = testcase.client
+			}
+			err := resolveReferences(testClient, &spec)
+			if testcase.expectError {
+				if err == nil {
+					t.Fatalf("Expected error, but got none")
+				}
+				if isInvalidReference(err) != testcase.expectInvalidReference {
+					t.Errorf("Expected invalid reference %t, but got %v", testcase.expectInvalidReference, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error occurred resolving references: %v", err)
+			}
+			if spec.ClusterId != testcase.expectedClusterID {
+				t.Errorf("Expected cluster ID %s, but got %s", testcase.expectedClusterID, spec.ClusterId)
+			}
+			if spec.StorageDomainId != testcase.expectedStorageDomainID {
+				t.Errorf("Expected storage domain ID %s, but got %s", testcase.expectedStorageDomainID, spec.StorageDomainId)
+			}
+			if spec.InstanceTypeId != testcase.expectedInstanceTypeID {
+				t.Errorf("Expected instance type ID %s, but got %s", testcase.expectedInstanceTypeID, spec.InstanceTypeId)
+			}
+		})
+	}
+}
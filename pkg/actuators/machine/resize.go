@@ -0,0 +1,278 @@
+package machine
+
+import (
+	"fmt"
+
+	ovirtconfigv1 "github.com/openshift/cluster-api-provider-ovirt/pkg/apis/ovirtprovider/v1beta1"
+	"github.com/openshift/cluster-api-provider-ovirt/pkg/ovirt"
+	ovirtsdk "github.com/ovirt/go-ovirt"
+	ovirtC "github.com/ovirt/go-ovirt-client/v2"
+	"github.com/pkg/errors"
+)
+
+const (
+	resizeChangeMemory           = "memory"
+	resizeChangeMaxMemory        = "max_memory"
+	resizeChangeGuaranteedMemory = "guaranteed_memory"
+	resizeChangeCPU              = "cpu"
+)
+
+// resourceUpdate contains the CPU and memory settings which have to be changed on a VM.
+// Fields which are nil are left untouched.
+type resourceUpdate struct {
+	memory           *int64
+	maxMemory        *int64
+	guaranteedMemory *int64
+	cpu              *ovirtconfigv1.CPU
+}
+
+// isEmpty returns true if the update doesn't change anything.
+func (u resourceUpdate) isEmpty() bool {
+	return len(u.changes()) == 0
+}
+
+// changes returns the names of the settings changed by the update.
+func (u resourceUpdate) changes() []string {
+	changes := []string{}
+	if u.memory != nil {
+		changes = append(changes, resizeChangeMemory)
+	}
+	if u.maxMemory != nil {
+		changes = append(changes, resizeChangeMaxMemory)
+	}
+	if u.guaranteedMemory != nil {
+		changes = append(changes, resizeChangeGuaranteedMemory)
+	}
+	if u.cpu != nil {
+		changes = append(changes, resizeChangeCPU)
+	}
+	return changes
+}
+
+// toSDK converts the update into the VM representation of the oVirt SDK.
+func (u resourceUpdate) toSDK() *ovirtsdk.Vm {
+	vmBuilder := ovirtsdk.NewVmBuilder()
+	if u.memory != nil {
+		vmBuilder.Memory(*u.memory)
+	}
+	if u.maxMemory != nil || u.guaranteedMemory != nil {
+		memoryPolicyBuilder := ovirtsdk.NewMemoryPolicyBuilder()
+		if u.maxMemory != nil {
+			memoryPolicyBuilder.Max(*u.maxMemory)
+		}
+		if u.guaranteedMemory != nil {
+			memoryPolicyBuilder.Guaranteed(*u.guaranteedMemory)
+		}
+		vmBuilder.MemoryPolicy(memoryPolicyBuilder.MustBuild())
+	}
+	if u.cpu != nil {
+		vmBuilder.Cpu(ovirtsdk.NewCpuBuilder().Topology(
+			ovirtsdk.NewCpuTopologyBuilder().
+				Sockets(int64(u.cpu.Sockets)).
+				Cores(int64(u.cpu.Cores)).
+				Threads(int64(u.cpu.Threads)).
+				MustBuild(),
+		).MustBuild())
+	}
+	return vmBuilder.MustBuild()
+}
+
+// planResourceUpdate compares the CPU and memory settings of the provider spec with the VM and
+// splits the differences into changes that can be applied to the VM immediately and changes that
+// have to be written to the next run configuration of the VM.
+// A VM which is down receives all changes immediately. On a running VM memory and CPU sockets
+// can only be hot-plugged, everything else requires a reboot.
+func planResourceUpdate(spec *ovirtconfigv1.OvirtMachineProviderSpec, vm ovirtC.VM) (live resourceUpdate, nextRun resourceUpdate) {
+	// the instance type overrides the hardware parameters of the VM
+	if spec.InstanceTypeId != "" {
+		return live, nextRun
+	}
+	running := vm.Status() != ovirtC.VMStatusDown
+
+	if spec.MemoryMB > 0 {
+		desiredMemory := int64(bytesInMB) * int64(spec.MemoryMB)
+		currentMaxMemory := vm.MemoryPolicy().Max()
+		switch {
+		case desiredMemory == vm.Memory():
+		case !running:
+			live.memory = &desiredMemory
+			if currentMaxMemory != nil && desiredMemory > *currentMaxMemory {
+				live.maxMemory = &desiredMemory
+			}
+		case desiredMemory > vm.Memory() && (currentMaxMemory == nil || desiredMemory <= *currentMaxMemory):
+			// memory hot-plug
+			live.memory = &desiredMemory
+		default:
+			// memory hot-unplug is not reliable and hot-plugging beyond the maximum memory is not possible
+			nextRun.memory = &desiredMemory
+			if currentMaxMemory != nil && desiredMemory > *currentMaxMemory {
+				nextRun.maxMemory = &desiredMemory
+			}
+		}
+	}
+
+	if spec.GuaranteedMemoryMB > 0 {
+		desiredGuaranteedMemory := int64(bytesInMB) * int64(spec.GuaranteedMemoryMB)
+		currentGuaranteedMemory := vm.MemoryPolicy().Guaranteed()
+		if currentGuaranteedMemory == nil || *currentGuaranteedMemory != desiredGuaranteedMemory {
+			if running {
+				nextRun.guaranteedMemory = &desiredGuaranteedMemory
+			} else {
+				live.guaranteedMemory = &desiredGuaranteedMemory
+			}
+		}
+	}
+
+	if spec.CPU != nil {
+		desiredCPU := *spec.CPU
+		topo := vm.CPU().Topo()
+		sameCoresAndThreads := uint(desiredCPU.Cores) == topo.Cores() && uint(desiredCPU.Threads) == topo.Threads()
+		switch {
+		case sameCoresAndThreads && uint(desiredCPU.Sockets) == topo.Sockets():
+		case !running:
+			live.cpu = &desiredCPU
+		case sameCoresAndThreads && uint(desiredCPU.Sockets) > topo.Sockets():
+			// CPU hot-plug
+			live.cpu = &desiredCPU
+		default:
+			nextRun.cpu = &desiredCPU
+		}
+	}
+
+	return live, nextRun
+}
+
+// withoutNextRunConfig removes the changes which the next run configuration of the VM already contains,
+// so that pending changes aren't sent to the engine again on every reconcile.
+func (u resourceUpdate) withoutNextRunConfig(nextRunVM *ovirtsdk.Vm) resourceUpdate {
+	if u.memory != nil {
+		if memory, ok := nextRunVM.Memory(); ok && memory == *u.memory {
+			u.memory = nil
+		}
+	}
+	if memoryPolicy, ok := nextRunVM.MemoryPolicy(); ok {
+		if u.maxMemory != nil {
+			if maxMemory, ok := memoryPolicy.Max(); ok && maxMemory == *u.maxMemory {
+				u.maxMemory = nil
+			}
+		}
+		if u.guaranteedMemory != nil {
+			if guaranteedMemory, ok := memoryPolicy.Guaranteed(); ok && guaranteedMemory == *u.guaranteedMemory {
+				u.guaranteedMemory = nil
+			}
+		}
+	}
+	if u.cpu != nil {
+		if cpu, ok := nextRunVM.Cpu(); ok {
+			if topology, ok := cpu.Topology(); ok && sameTopology(*u.cpu, topology) {
+				u.cpu = nil
+			}
+		}
+	}
+	return u
+}
+
+// sameTopology returns true if the CPU topology of the oVirt SDK matches the CPU of the provider spec.
+func sameTopology(cpu ovirtconfigv1.CPU, topology *ovirtsdk.CpuTopology) bool {
+	sockets, socketsOK := topology.Sockets()
+	cores, coresOK := topology.Cores()
+	threads, threadsOK := topology.Threads()
+	return socketsOK && coresOK && threadsOK &&
+		sockets == int64(cpu.Sockets) && cores == int64(cpu.Cores) && threads == int64(cpu.Threads)
+}
+
+// reconcileVerticalResize applies changes of the CPU, memory and OS disk size in the provider spec
+// to the existing VM. Changes which can't be applied to the running VM are written to its next run
+// configuration and recorded in the PendingNextRunChanges of the provider status.
+func (ms *machineScope) reconcileVerticalResize() error {
+	if ms.machineProviderSpec == nil {
+		return nil
+	}
+	vm, err := ms.getVM()
+	if err != nil {
+		return err
+	}
+
+	if _, err := ms.extendOSDisk(vm); err != nil {
+		return ms.markConditionFailed(ovirtconfigv1.DiskResizedCondition, errors.Wrap(err, "error extending OS disk"))
+	}
+
+	live, nextRun := planResourceUpdate(ms.machineProviderSpec, vm)
+	if !live.isEmpty() {
+		ms.logger.Infof("Updating %v of VM %s", live.changes(), vm.Name())
+		if err := ms.updateVMResources(vm.ID(), live, false); err != nil {
+			return ms.markConditionFailed(ovirtconfigv1.ResourcesUpdatedCondition, err)
+		}
+	}
+	if !nextRun.isEmpty() {
+		nextRunVM, err := ms.getNextRunVM(vm.ID())
+		if err != nil {
+			return ms.markConditionFailed(ovirtconfigv1.ResourcesUpdatedCondition, err)
+		}
+		if unsent := nextRun.withoutNextRunConfig(nextRunVM); !unsent.isEmpty() {
+			ms.logger.Infof("Updating %v of VM %s in the next run configuration, a reboot is required", unsent.changes(), vm.Name())
+			if err := ms.updateVMResources(vm.ID(), unsent, true); err != nil {
+				return ms.markConditionFailed(ovirtconfigv1.ResourcesUpdatedCondition, err)
+			}
+		}
+	}
+	if !live.isEmpty() || !nextRun.isEmpty() {
+		ms.markConditionTrue(ovirtconfigv1.ResourcesUpdatedCondition, ovirtconfigv1.ConditionReasonSucceeded,
+			"updated %v, pending next run %v", live.changes(), nextRun.changes())
+	}
+
+	return ms.reconcilePendingNextRunChanges(nextRun.changes())
+}
+
+// getNextRunVM fetches the next run configuration of the VM, which contains the changes that take
+// effect after the next reboot. The go-ovirt-client doesn't support it, therefore the underlying
+// oVirt SDK connection is used.
+func (ms *machineScope) getNextRunVM(id ovirtC.VMID) (*ovirtsdk.Vm, error) {
+	legacyClient, ok := ms.ovirtClient.(ovirtC.ClientWithLegacySupport)
+	if !ok {
+		return nil, fmt.Errorf("fetching the next run configuration of VM %s is not supported by the oVirt client", id)
+	}
+	var resp *ovirtsdk.VmServiceGetResponse
+	err := ovirt.CallSDK(ms.Context, legacyClient, "GetVM", func(conn *ovirtsdk.Connection) (err error) {
+		resp, err = conn.SystemService().VmsService().VmService(string(id)).
+			Get().
+			NextRun(true).
+			Send()
+		return err
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to fetch next run configuration of VM %s", id)
+	}
+	nextRunVM, ok := resp.Vm()
+	if !ok {
+		return nil, fmt.Errorf("next run configuration of VM %s is empty", id)
+	}
+	return nextRunVM, nil
+}
+
+// updateVMResources sends the CPU and memory update to the oVirt engine. The go-ovirt-client doesn't
+// support updating these settings, therefore the underlying oVirt SDK connection is used.
+func (ms *machineScope) updateVMResources(id ovirtC.VMID, update resourceUpdate, nextRun bool) error {
+	legacyClient, ok := ms.ovirtClient.(ovirtC.ClientWithLegacySupport)
+	if !ok {
+		return fmt.Errorf("updating %v of VM %s is not supported by the oVirt client", update.changes(), id)
+	}
+	err := ovirt.CallSDK(ms.Context, legacyClient, "UpdateVM", func(conn *ovirtsdk.Connection) error {
+		_, err := conn.SystemService().VmsService().VmService(string(id)).
+			Update().
+			Vm(update.toSDK()).
+			NextRun(nextRun).
+			Send()
+		return err
+	})
+	if err != nil {
+		return errors.Wrapf(err, "failed to update %v of VM %s", update.changes(), id)
+	}
+	return nil
+}
+
+func (ms *machineScope) reconcilePendingNextRunChanges(changes []string) error {
+	return ms.updateProviderStatus(func(status *ovirtconfigv1.OvirtMachineProviderStatus) {
+		status.PendingNextRunChanges = changes
+	})
+}
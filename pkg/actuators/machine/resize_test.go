@@ -0,0 +1,320 @@
+//go:build unit
+
+package machine
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	"github.com/openshift/cluster-api-provider-ovirt/pkg/apis/ovirtprovider/v1beta1"
+	"github.com/openshift/cluster-api-provider-ovirt/pkg/ovirt"
+	"github.com/openshift/cluster-api-provider-ovirt/pkg/utils"
+	ovirtsdk "github.com/ovirt/go-ovirt"
+	ovirtclient "github.com/ovirt/go-ovirt-client/v2"
+	"k8s.io/apimachinery/pkg/api/meta"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// vmWithStatus overrides the status of a VM to avoid waiting for the mock to start the VM.
+type vmWithStatus struct {
+	ovirtclient.VM
+	status ovirtclient.VMStatus
+}
+
+func (v vmWithStatus) Status() ovirtclient.VMStatus {
+	return v.status
+}
+
+func TestPlanResourceUpdate(t *testing.T) {
+	testcases := []struct {
+		name            string
+		status          ovirtclient.VMStatus
+		setup           func(spec *v1beta1.OvirtMachineProviderSpec)
+		expectedLive    []string
+		expectedNextRun []string
+	}{
+		{
+			name:            "unchanged spec results in no update",
+			status:          ovirtclient.VMStatusUp,
+			setup:           func(spec *v1beta1.OvirtMachineProviderSpec) {},
+			expectedLive:    []string{},
+			expectedNextRun: []string{},
+		},
+		{
+			name:   "memory increase on running VM is hot-plugged",
+			status: ovirtclient.VMStatusUp,
+			setup: func(spec *v1beta1.OvirtMachineProviderSpec) {
+				spec.MemoryMB = 8192
+			},
+			expectedLive:    []string{resizeChangeMemory},
+			expectedNextRun: []string{},
+		},
+		{
+			name:   "memory decrease on running VM requires next run",
+			status: ovirtclient.VMStatusUp,
+			setup: func(spec *v1beta1.OvirtMachineProviderSpec) {
+				spec.MemoryMB = 2048
+				spec.GuaranteedMemoryMB = 1024
+			},
+			expectedLive:    []string{},
+			expectedNextRun: []string{resizeChangeMemory, resizeChangeGuaranteedMemory},
+		},
+		{
+			name:   "socket increase on running VM is hot-plugged",
+			status: ovirtclient.VMStatusUp,
+			setup: func(spec *v1beta1.OvirtMachineProviderSpec) {
+				spec.CPU.Sockets = 4
+			},
+			expectedLive:    []string{resizeChangeCPU},
+			expectedNextRun: []string{},
+		},
+		{
+			name:   "core change on running VM requires next run",
+			status: ovirtclient.VMStatusUp,
+			setup: func(spec *v1beta1.OvirtMachineProviderSpec) {
+				spec.CPU.Cores = 4
+			},
+			expectedLive:    []string{},
+			expectedNextRun: []string{resizeChangeCPU},
+		},
+		{
+			name:   "all changes on a VM which is down are applied immediately",
+			status: ovirtclient.VMStatusDown,
+			setup: func(spec *v1beta1.OvirtMachineProviderSpec) {
+				spec.MemoryMB = 2048
+				spec.GuaranteedMemoryMB = 1024
+				spec.CPU.Cores = 4
+			},
+			expectedLive:    []string{resizeChangeMemory, resizeChangeGuaranteedMemory, resizeChangeCPU},
+			expectedNextRun: []string{},
+		},
+		{
+			name:   "instance type ignores CPU and memory",
+			status: ovirtclient.VMStatusUp,
+			setup: func(spec *v1beta1.OvirtMachineProviderSpec) {
+				spec.InstanceTypeId = "Metal"
+				spec.MemoryMB = 2048
+			},
+			expectedLive:    []string{},
+			expectedNextRun: []string{},
+		},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.name, func(t *testing.T) {
+			helper, err := ovirtclient.NewMockTestHelper(ovirt.NewKLogr("go-ovirt-client"))
+			if err != nil {
+				t.Fatalf("Unexpected error occurred setting up test helper: %v", err)
+			}
+			params := ovirtclient.NewCreateVMParams().
+				MustWithMemory(4096*bytesInMB).
+				MustWithCPUParameters(2, 1, 2).
+				WithMemoryPolicy(ovirtclient.NewMemoryPolicyParameters().MustWithGuaranteed(4096 * bytesInMB))
+			vm, err := helper.GetClient().CreateVM(helper.GetClusterID(), helper.GetBlankTemplateID(), "test-vm", params)
+			if err != nil {
+				t.Fatalf("Unexpected error occurred creating VM: %v", err)
+			}
+
+			spec := &v1beta1.OvirtMachineProviderSpec{
+				MemoryMB:           4096,
+				GuaranteedMemoryMB: 4096,
+				CPU:                &v1beta1.CPU{Sockets: 2, Cores: 2, Threads: 1},
+			}
+			testcase.setup(spec)
+
+			live, nextRun := planResourceUpdate(spec, vmWithStatus{VM: vm, status: testcase.status})
+			if diff := cmp.Diff(testcase.expectedLive, live.changes()); diff != "" {
+				t.Errorf("Unexpected live changes: %s", diff)
+			}
+			if diff := cmp.Diff(testcase.expectedNextRun, nextRun.changes()); diff != "" {
+				t.Errorf("Unexpected next run changes: %s", diff)
+			}
+		})
+	}
+}
+
+// sdkEngine is a minimal oVirt engine serving the next run configuration of a single VM to the oVirt SDK.
+// It records the updates sent to the engine.
+type sdkEngine struct {
+	nextRunCores int
+	failUpdates  bool
+	updates      []string
+}
+
+func (e *sdkEngine) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.URL.Path == "/ovirt-engine/sso/oauth/token":
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"access_token": "token"}`)
+	case r.Method == http.MethodGet:
+		w.Header().Set("Content-Type", "application/xml")
+		fmt.Fprintf(w, `<vm><memory>%d</memory><cpu><topology><sockets>2</sockets><cores>%d</cores><threads>1</threads></topology></cpu></vm>`,
+			4096*bytesInMB, e.nextRunCores)
+	case r.Method == http.MethodPut && e.failUpdates:
+		w.WriteHeader(http.StatusInternalServerError)
+	case r.Method == http.MethodPut:
+		e.updates = append(e.updates, "next_run="+r.URL.Query().Get("next_run"))
+		w.Header().Set("Content-Type", "application/xml")
+		fmt.Fprint(w, `<vm></vm>`)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+// sdkClient serves the VMs of the mock with the given status and provides the oVirt SDK connection
+// for the settings the go-ovirt-client doesn't support.
+type sdkClient struct {
+	ovirtclient.Client
+	connection *ovirtsdk.Connection
+	status     ovirtclient.VMStatus
+}
+
+func (c *sdkClient) GetVM(id ovirtclient.VMID, retries ...ovirtclient.RetryStrategy) (ovirtclient.VM, error) {
+	vm, err := c.Client.GetVM(id, retries...)
+	if err != nil {
+		return nil, err
+	}
+	return vmWithStatus{VM: vm, status: c.status}, nil
+}
+
+func (c *sdkClient) GetSDKClient() *ovirtsdk.Connection {
+	return c.connection
+}
+
+func (c *sdkClient) GetHTTPClient() http.Client {
+	return http.Client{}
+}
+
+func TestReconcileVerticalResize(t *testing.T) {
+	testcases := []struct {
+		name              string
+		setup             func(spec *v1beta1.OvirtMachineProviderSpec, engine *sdkEngine)
+		expectedUpdates   []string
+		expectedPending   []string
+		expectedCondition v1.ConditionStatus
+		expectError       bool
+	}{
+		{
+			name:            "unchanged spec sends no update",
+			setup:           func(spec *v1beta1.OvirtMachineProviderSpec, engine *sdkEngine) {},
+			expectedUpdates: nil,
+			expectedPending: nil,
+		},
+		{
+			name: "memory increase is hot-plugged",
+			setup: func(spec *v1beta1.OvirtMachineProviderSpec, engine *sdkEngine) {
+				spec.MemoryMB = 8192
+			},
+			expectedUpdates:   []string{"next_run=false"},
+			expectedPending:   nil,
+			expectedCondition: v1.ConditionTrue,
+		},
+		{
+			name: "core change is written to the next run configuration",
+			setup: func(spec *v1beta1.OvirtMachineProviderSpec, engine *sdkEngine) {
+				spec.CPU.Cores = 4
+			},
+			expectedUpdates:   []string{"next_run=true"},
+			expectedPending:   []string{resizeChangeCPU},
+			expectedCondition: v1.ConditionTrue,
+		},
+		{
+			name: "core change already in the next run configuration is not sent again",
+			setup: func(spec *v1beta1.OvirtMachineProviderSpec, engine *sdkEngine) {
+				spec.CPU.Cores = 4
+				engine.nextRunCores = 4
+			},
+			expectedUpdates:   nil,
+			expectedPending:   []string{resizeChangeCPU},
+			expectedCondition: v1.ConditionTrue,
+		},
+		{
+			name: "failed update is recorded in the conditions",
+			setup: func(spec *v1beta1.OvirtMachineProviderSpec, engine *sdkEngine) {
+				spec.CPU.Cores = 4
+				engine.failUpdates = true
+			},
+			expectedUpdates:   nil,
+			expectedPending:   nil,
+			expectedCondition: v1.ConditionFalse,
+			expectError:       true,
+		},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.name, func(t *testing.T) {
+			helper, err := ovirtclient.NewMockTestHelper(ovirt.NewKLogr("go-ovirt-client"))
+			if err != nil {
+				t.Fatalf("Unexpected error occurred setting up test helper: %v", err)
+			}
+			params := ovirtclient.NewCreateVMParams().
+				MustWithMemory(4096*bytesInMB).
+				MustWithCPUParameters(2, 1, 2)
+			vm, err := helper.GetClient().CreateVM(helper.GetClusterID(), helper.GetBlankTemplateID(), "test-vm", params)
+			if err != nil {
+				t.Fatalf("Unexpected error occurred creating VM: %v", err)
+			}
+
+			engine := &sdkEngine{nextRunCores: 2}
+			spec := &v1beta1.OvirtMachineProviderSpec{
+				MemoryMB: 4096,
+				CPU:      &v1beta1.CPU{Sockets: 2, Cores: 2, Threads: 1},
+			}
+			testcase.setup(spec, engine)
+
+			server := httptest.NewServer(engine)
+			defer server.Close()
+			connection, err := ovirtsdk.NewConnectionBuilder().
+				URL(server.URL + "/ovirt-engine/api").
+				Username("admin@internal").
+				Password("password").
+				Build()
+			if err != nil {
+				t.Fatalf("Unexpected error occurred connecting to the engine: %v", err)
+			}
+
+			providerID := utils.ProviderIDPrefix + string(vm.ID())
+			ms := machineScope{
+				Context:             context.Background(),
+				logger:              ovirt.NewKLogr("machine-scope"),
+				ovirtClient:         &sdkClient{Client: helper.GetClient(), connection: connection, status: ovirtclient.VMStatusUp},
+				machineProviderSpec: spec,
+				machine: &machinev1.Machine{
+					ObjectMeta: v1.ObjectMeta{Name: "test-machine"},
+					Spec:       machinev1.MachineSpec{ProviderID: &providerID},
+				},
+			}
+
+			err = ms.reconcileVerticalResize()
+			if testcase.expectError && err == nil {
+				t.Fatalf("Expected error resizing the VM, but got none")
+			}
+			if !testcase.expectError && err != nil {
+				t.Fatalf("Unexpected error occurred resizing the VM: %v", err)
+			}
+			if diff := cmp.Diff(testcase.expectedUpdates, engine.updates); diff != "" {
+				t.Errorf("Unexpected updates sent to the engine: %s", diff)
+			}
+
+			providerStatus, err := v1beta1.ProviderStatusFromRawExtension(ms.machine.Status.ProviderStatus)
+			if err != nil {
+				t.Fatalf("Unexpected error occurred reading provider status: %v", err)
+			}
+			if diff := cmp.Diff(testcase.expectedPending, providerStatus.PendingNextRunChanges); diff != "" {
+				t.Errorf("Unexpected pending next run changes: %s", diff)
+			}
+			condition := meta.FindStatusCondition(providerStatus.Conditions, v1beta1.ResourcesUpdatedCondition)
+			switch {
+			case testcase.expectedCondition == "" && condition != nil:
+				t.Errorf("Expected no %s condition, but got %v", v1beta1.ResourcesUpdatedCondition, condition)
+			case testcase.expectedCondition != "" && (condition == nil || condition.Status != testcase.expectedCondition):
+				t.Errorf("Expected %s condition to be %s, but got %v", v1beta1.ResourcesUpdatedCondition, testcase.expectedCondition, condition)
+			}
+		})
+	}
+}
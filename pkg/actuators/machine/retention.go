@@ -0,0 +1,162 @@
+package machine
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	ovirtconfigv1 "github.com/openshift/cluster-api-provider-ovirt/pkg/apis/ovirtprovider/v1beta1"
+	"github.com/openshift/cluster-api-provider-ovirt/pkg/ovirt"
+	ovirtsdk "github.com/ovirt/go-ovirt"
+	ovirtC "github.com/ovirt/go-ovirt-client/v2"
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+const (
+	// RetainedDisksAnnotationKey lists the comma separated IDs of the disks retained on deletion of the machine.
+	RetainedDisksAnnotationKey = "machine.openshift.io/retained-disks"
+	// copyPollInterval is the interval in which the engine is checked for the copy of a retained disk.
+	copyPollInterval = 5 * time.Second
+	// copyStartTimeout is the time the engine is given to start copying a retained disk.
+	copyStartTimeout = 5 * time.Minute
+)
+
+// diskRetentionPolicy returns the retention policy of the provider spec for the disk with the given alias.
+// The policies refer to the additional disks by position, the alias of the disk at the position is the
+// alias the disk was created with. Disks without a retention policy are deleted together with the VM.
+func (ms *machineScope) diskRetentionPolicy(alias string) ovirtconfigv1.DiskRetentionPolicy {
+	if ms.machineProviderSpec == nil {
+		return ovirtconfigv1.DiskRetentionPolicyDelete
+	}
+	for _, retention := range ms.machineProviderSpec.DiskRetention {
+		index := int(retention.AdditionalDisk) - 1
+		if index < 0 || index >= len(ms.machineProviderSpec.AdditionalDisks) {
+			continue
+		}
+		if ms.additionalDiskAlias(index) == alias {
+			return retention.Policy
+		}
+	}
+	return ovirtconfigv1.DiskRetentionPolicyDelete
+}
+
+// retainDisks applies the retention policies of the provider spec to the disks of the stopped VM,
+// before the VM is removed together with its remaining disks. The IDs of the retained disks are
+// recorded in the RetainedDisksAnnotationKey annotation as soon as they are retained, so they aren't
+// lost if the deletion fails afterwards.
+func (ms *machineScope) retainDisks(vm ovirtC.VM) error {
+	diskAttachments, err := ms.ovirtClient.ListDiskAttachments(vm.ID(), ovirtC.ContextStrategy(ms.Context))
+	if err != nil {
+		return errors.Wrapf(err, "failed to list disk attachments for VM %s", vm.ID())
+	}
+	for _, diskAttachment := range diskAttachments {
+		disk, err := ms.ovirtClient.GetDisk(diskAttachment.DiskID(), ovirtC.ContextStrategy(ms.Context))
+		if err != nil {
+			return errors.Wrapf(err, "failed to get disk %s of VM %s", diskAttachment.DiskID(), vm.ID())
+		}
+		switch policy := ms.diskRetentionPolicy(disk.Alias()); policy {
+		case ovirtconfigv1.DiskRetentionPolicyDelete:
+			continue
+		case ovirtconfigv1.DiskRetentionPolicyDetach:
+			ms.logger.Infof("Detaching disk %s (%s) from VM %s.", disk.Alias(), disk.ID(), vm.ID())
+			err := ms.ovirtClient.RemoveDiskAttachment(vm.ID(), diskAttachment.ID(), ovirtC.ContextStrategy(ms.Context))
+			if err != nil && !ovirtC.HasErrorCode(err, ovirtC.ENotFound) {
+				return errors.Wrapf(err, "failed to detach disk %s from VM %s", disk.ID(), vm.ID())
+			}
+			ms.recordRetainedDisk(disk.ID())
+		case ovirtconfigv1.DiskRetentionPolicyCopy:
+			copyID, err := ms.copyDisk(disk)
+			if err != nil {
+				return err
+			}
+			ms.recordRetainedDisk(copyID)
+		default:
+			return fmt.Errorf("unknown retention policy %s for disk %s", policy, disk.Alias())
+		}
+	}
+	return nil
+}
+
+// copyDisk implements the Copy retention policy. It makes a full copy of the disk in the same storage
+// domain, an oVirt snapshot would be removed together with the VM, and waits for the copy to be OK, which
+// takes as long as copying the data of the disk. An existing copy from a previous attempt is reused.
+// The go-ovirt-client doesn't support copying disks, therefore the underlying oVirt SDK connection is used.
+func (ms *machineScope) copyDisk(disk ovirtC.Disk) (ovirtC.DiskID, error) {
+	alias := fmt.Sprintf("%s-%s-copy", ms.machine.Name, disk.Alias())
+	copyID, err := ms.findDiskByAlias(alias)
+	if err != nil {
+		return "", err
+	}
+	if copyID == "" {
+		storageDomainIDs := disk.StorageDomainIDs()
+		if len(storageDomainIDs) == 0 {
+			return "", fmt.Errorf("failed to copy disk %s, the disk isn't in any storage domain", disk.ID())
+		}
+		legacyClient, ok := ms.ovirtClient.(ovirtC.ClientWithLegacySupport)
+		if !ok {
+			return "", fmt.Errorf("copying disk %s is not supported by the oVirt client", disk.ID())
+		}
+		ms.logger.Infof("Copying disk %s (%s) to %s.", disk.Alias(), disk.ID(), alias)
+		err := ovirt.CallSDK(ms.Context, legacyClient, "CopyDisk", func(conn *ovirtsdk.Connection) error {
+			_, err := conn.SystemService().DisksService().DiskService(string(disk.ID())).
+				Copy().
+				Disk(ovirtsdk.NewDiskBuilder().Alias(alias).MustBuild()).
+				StorageDomain(ovirtsdk.NewStorageDomainBuilder().Id(string(storageDomainIDs[0])).MustBuild()).
+				Send()
+			return err
+		})
+		if err != nil {
+			return "", errors.Wrapf(err, "failed to copy disk %s", disk.ID())
+		}
+		err = wait.PollImmediateWithContext(ms.Context, copyPollInterval, copyStartTimeout,
+			func(ctx context.Context) (bool, error) {
+				copyID, err = ms.findDiskByAlias(alias)
+				return copyID != "", err
+			})
+		if err != nil {
+			return "", errors.Wrapf(err, "failed to find copy %s of disk %s", alias, disk.ID())
+		}
+	}
+	if _, err := ms.ovirtClient.WaitForDiskOK(copyID, ovirtC.ContextStrategy(ms.Context)); err != nil {
+		return "", errors.Wrapf(err, "failed waiting for copy %s of disk %s", alias, disk.ID())
+	}
+	return copyID, nil
+}
+
+// findDiskByAlias returns the ID of the disk with the given alias, or an empty ID if no such disk exists.
+func (ms *machineScope) findDiskByAlias(alias string) (ovirtC.DiskID, error) {
+	disks, err := ms.ovirtClient.ListDisksByAlias(alias, ovirtC.ContextStrategy(ms.Context))
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to list disks with alias %s", alias)
+	}
+	if len(disks) == 0 {
+		return "", nil
+	}
+	return disks[0].ID(), nil
+}
+
+// recordRetainedDisk adds the disk to the RetainedDisksAnnotationKey annotation and checkpoints the machine.
+func (ms *machineScope) recordRetainedDisk(id ovirtC.DiskID) {
+	retained := ms.retainedDisks()
+	for _, retainedID := range retained {
+		if retainedID == string(id) {
+			return
+		}
+	}
+	if ms.machine.Annotations == nil {
+		ms.machine.Annotations = make(map[string]string)
+	}
+	ms.machine.Annotations[RetainedDisksAnnotationKey] = strings.Join(append(retained, string(id)), ",")
+	ms.checkpoint()
+}
+
+// retainedDisks returns the IDs of the disks recorded in the RetainedDisksAnnotationKey annotation.
+func (ms *machineScope) retainedDisks() []string {
+	value := ms.machine.Annotations[RetainedDisksAnnotationKey]
+	if value == "" {
+		return nil
+	}
+	return strings.Split(value, ",")
+}
@@ -0,0 +1,129 @@
+//go:build unit
+
+package machine
+
+import (
+	"context"
+	"testing"
+
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	"github.com/openshift/cluster-api-provider-ovirt/pkg/apis/ovirtprovider/v1beta1"
+	"github.com/openshift/cluster-api-provider-ovirt/pkg/ovirt"
+	"github.com/openshift/cluster-api-provider-ovirt/pkg/utils"
+	ovirtclient "github.com/ovirt/go-ovirt-client/v2"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestMachineScope_DeleteRetainsDisks(t *testing.T) {
+	testcases := []struct {
+		name             string
+		diskRetention    []v1beta1.DiskRetention
+		expectedRetained bool
+	}{
+		{
+			name:             "disk without retention policy is deleted",
+			diskRetention:    nil,
+			expectedRetained: false,
+		},
+		{
+			name:             "disk with Delete policy is deleted",
+			diskRetention:    []v1beta1.DiskRetention{{AdditionalDisk: 1, Policy: v1beta1.DiskRetentionPolicyDelete}},
+			expectedRetained: false,
+		},
+		{
+			name:             "disk with Detach policy is kept",
+			diskRetention:    []v1beta1.DiskRetention{{AdditionalDisk: 1, Policy: v1beta1.DiskRetentionPolicyDetach}},
+			expectedRetained: true,
+		},
+		{
+			name:             "disk with Detach policy on another additional disk is deleted",
+			diskRetention:    []v1beta1.DiskRetention{{AdditionalDisk: 2, Policy: v1beta1.DiskRetentionPolicyDetach}},
+			expectedRetained: false,
+		},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.name, func(t *testing.T) {
+			helper, err := ovirtclient.NewMockTestHelper(ovirt.NewKLogr("go-ovirt-client"))
+			if err != nil {
+				t.Fatalf("Unexpected error occurred setting up test helper: %v", err)
+			}
+			client := helper.GetClient()
+			vm := createTestVM(t, helper, "test-machine", "")
+			disk, err := client.CreateDisk(helper.GetStorageDomainID(), ovirtclient.ImageFormatRaw, 1024*bytesInMB,
+				ovirtclient.CreateDiskParams().MustWithAlias("test-machine-disk1"))
+			if err != nil {
+				t.Fatalf("Unexpected error occurred creating disk: %v", err)
+			}
+			if _, err := client.CreateDiskAttachment(vm.ID(), disk.ID(), ovirtclient.DiskInterfaceVirtIO, nil); err != nil {
+				t.Fatalf("Unexpected error occurred attaching disk: %v", err)
+			}
+
+			ms := machineScope{
+				Context:     context.Background(),
+				logger:      ovirt.NewKLogr("machine-scope"),
+				ovirtClient: client,
+				machine: &machinev1.Machine{
+					ObjectMeta: v1.ObjectMeta{
+						Name:        "test-machine",
+						Annotations: map[string]string{utils.OvirtIDAnnotationKey: string(vm.ID())},
+					},
+				},
+				machineProviderSpec: &v1beta1.OvirtMachineProviderSpec{
+					AdditionalDisks: []v1beta1.AdditionalDisk{{SizeGB: 1}, {SizeGB: 1}},
+					DiskRetention:   testcase.diskRetention,
+				},
+			}
+			if err := ms.delete(); err != nil {
+				t.Fatalf("Unexpected error occurred deleting VM: %v", err)
+			}
+
+			_, err = client.GetDisk(disk.ID())
+			retained := err == nil
+			if retained != testcase.expectedRetained {
+				t.Errorf("Expected disk to be retained: %t, but got %t (%v)", testcase.expectedRetained, retained, err)
+			}
+			expectedAnnotation := ""
+			if testcase.expectedRetained {
+				expectedAnnotation = string(disk.ID())
+			}
+			if annotation := ms.machine.Annotations[RetainedDisksAnnotationKey]; annotation != expectedAnnotation {
+				t.Errorf("Expected retained disks annotation %q, but got %q", expectedAnnotation, annotation)
+			}
+		})
+	}
+}
+
+// diskWithoutStorageDomains is a disk the engine reports without any storage domain.
+type diskWithoutStorageDomains struct {
+	ovirtclient.Disk
+}
+
+func (d diskWithoutStorageDomains) StorageDomainIDs() []ovirtclient.StorageDomainID {
+	return nil
+}
+
+func TestMachineScope_CopyDiskWithoutStorageDomain(t *testing.T) {
+	helper, err := ovirtclient.NewMockTestHelper(ovirt.NewKLogr("go-ovirt-client"))
+	if err != nil {
+		t.Fatalf("Unexpected error occurred setting up test helper: %v", err)
+	}
+	client := helper.GetClient()
+	disk, err := client.CreateDisk(helper.GetStorageDomainID(), ovirtclient.ImageFormatRaw, 1024*bytesInMB,
+		ovirtclient.CreateDiskParams().MustWithAlias("data"))
+	if err != nil {
+		t.Fatalf("Unexpected error occurred creating disk: %v", err)
+	}
+
+	ms := machineScope{
+		Context:     context.Background(),
+		logger:      ovirt.NewKLogr("machine-scope"),
+		ovirtClient: client,
+		machine: &machinev1.Machine{
+			ObjectMeta: v1.ObjectMeta{Name: "test-machine"},
+		},
+	}
+	if _, err := ms.copyDisk(diskWithoutStorageDomains{Disk: disk}); err == nil {
+		t.Errorf("Expected error copying a disk without storage domain, but got none")
+	}
+}
@@ -0,0 +1,199 @@
+package machine
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strings"
+
+	ovirtconfigv1 "github.com/openshift/cluster-api-provider-ovirt/pkg/apis/ovirtprovider/v1beta1"
+	"github.com/openshift/cluster-api-provider-ovirt/pkg/ovirt"
+	ovirtsdk "github.com/ovirt/go-ovirt"
+	ovirtC "github.com/ovirt/go-ovirt-client/v2"
+	"github.com/pkg/errors"
+)
+
+const (
+	// nmConnectionsDir is the directory NetworkManager reads the keyfiles of the connections from.
+	nmConnectionsDir = "/etc/NetworkManager/system-connections"
+	// defaultIgnitionVersion is used if the user data doesn't contain an ignition config.
+	defaultIgnitionVersion = "3.2.0"
+)
+
+// staticIPNIC is a network interface of the VM with a static IP configuration.
+type staticIPNIC struct {
+	name   string
+	mac    string
+	config *ovirtconfigv1.StaticIPConfig
+}
+
+// reconcileStaticIPs injects the static IP configuration of the network interfaces as NetworkManager
+// keyfiles into the ignition of the VM. The keyfiles match the interfaces by their MAC addresses,
+// which are only known after the NICs were created, therefore the initialization of the VM is
+// updated after the creation. The go-ovirt-client doesn't support reading the MAC addresses and
+// updating the initialization, therefore the underlying oVirt SDK connection is used.
+func (ms *machineScope) reconcileStaticIPs(instance ovirtC.VM) error {
+	var nics []staticIPNIC
+	for i, nic := range ms.machineProviderSpec.NetworkInterfaces {
+		if nic.StaticIP != nil {
+			nics = append(nics, staticIPNIC{name: ms.nicName(i), mac: nic.MAC, config: nic.StaticIP})
+		}
+	}
+	if len(nics) == 0 {
+		ms.markConditionTrue(ovirtconfigv1.NetworkConfiguredCondition, ovirtconfigv1.ConditionReasonNotRequested,
+			"no static IP configuration requested")
+		return nil
+	}
+
+	legacyClient, ok := ms.ovirtClient.(ovirtC.ClientWithLegacySupport)
+	if !ok {
+		return fmt.Errorf("static IP configuration of VM %s is not supported by the oVirt client", instance.ID())
+	}
+	vmService := func(conn *ovirtsdk.Connection) *ovirtsdk.VmService {
+		return conn.SystemService().VmsService().VmService(string(instance.ID()))
+	}
+
+	var response *ovirtsdk.VmNicsServiceListResponse
+	err := ovirt.CallSDK(ms.Context, legacyClient, "ListNICs", func(conn *ovirtsdk.Connection) (err error) {
+		response, err = vmService(conn).NicsService().List().Send()
+		return err
+	})
+	if err != nil {
+		return errors.Wrapf(err, "failed to list NICs of VM %s", instance.ID())
+	}
+	macs := make(map[string]string)
+	for _, nic := range response.MustNics().Slice() {
+		if mac, ok := nic.Mac(); ok {
+			macs[nic.MustName()] = mac.MustAddress()
+		}
+	}
+	for i := range nics {
+		if mac, ok := macs[nics[i].name]; ok {
+			nics[i].mac = mac
+		}
+		if nics[i].mac == "" {
+			return fmt.Errorf("MAC address of NIC %s of VM %s is unknown", nics[i].name, instance.ID())
+		}
+	}
+
+	ignition, err := ms.getIgnition()
+	if err != nil {
+		return errors.Wrap(err, "error getting VM ignition")
+	}
+	ignition, err = injectStaticIPConfig(ignition, nics)
+	if err != nil {
+		return err
+	}
+	err = ovirt.CallSDK(ms.Context, legacyClient, "UpdateVM", func(conn *ovirtsdk.Connection) error {
+		_, err := vmService(conn).Update().
+			Vm(ovirtsdk.NewVmBuilder().
+				Initialization(ovirtsdk.NewInitializationBuilder().
+					CustomScript(string(ignition)).
+					HostName(ms.machine.Name).
+					MustBuild()).
+				MustBuild()).
+			Send()
+		return err
+	})
+	if err != nil {
+		return errors.Wrapf(err, "failed to update initialization of VM %s", instance.ID())
+	}
+	ms.markConditionTrue(ovirtconfigv1.NetworkConfiguredCondition, ovirtconfigv1.ConditionReasonSucceeded,
+		"static IP configuration of %d NICs injected", len(nics))
+	return nil
+}
+
+// injectStaticIPConfig adds a NetworkManager keyfile for each of the network interfaces to the files
+// of the ignition config. Ignition spec version 2 and 3 configs are supported, an empty ignition is
+// replaced by an empty config of the defaultIgnitionVersion.
+func injectStaticIPConfig(ignition []byte, nics []staticIPNIC) ([]byte, error) {
+	config := map[string]interface{}{}
+	if len(ignition) == 0 {
+		config["ignition"] = map[string]interface{}{"version": defaultIgnitionVersion}
+	} else if err := json.Unmarshal(ignition, &config); err != nil {
+		return nil, errors.Wrap(err, "static IP configuration requires the user data to be an ignition config")
+	}
+
+	ignitionSection, _ := config["ignition"].(map[string]interface{})
+	version, _ := ignitionSection["version"].(string)
+	if version == "" {
+		return nil, fmt.Errorf("static IP configuration requires the user data to be an ignition config with a version")
+	}
+
+	storage, _ := config["storage"].(map[string]interface{})
+	if storage == nil {
+		storage = map[string]interface{}{}
+		config["storage"] = storage
+	}
+	files, _ := storage["files"].([]interface{})
+	for _, nic := range nics {
+		keyfile, err := nmKeyfile(nic)
+		if err != nil {
+			return nil, err
+		}
+		file := map[string]interface{}{
+			"path": fmt.Sprintf("%s/%s.nmconnection", nmConnectionsDir, nic.name),
+			// NetworkManager ignores keyfiles which are readable by others
+			"mode": 0600,
+			"contents": map[string]interface{}{
+				"source": "data:text/plain;charset=utf-8;base64," + base64.StdEncoding.EncodeToString([]byte(keyfile)),
+			},
+		}
+		if strings.HasPrefix(version, "2.") {
+			file["filesystem"] = "root"
+		} else {
+			file["overwrite"] = true
+		}
+		files = append(files, file)
+	}
+	storage["files"] = files
+
+	return json.Marshal(config)
+}
+
+// nmKeyfile returns the NetworkManager keyfile with the static IP configuration of the network interface.
+func nmKeyfile(nic staticIPNIC) (string, error) {
+	var ipv4DNS, ipv6DNS []string
+	for _, server := range nic.config.DNS {
+		ip := net.ParseIP(server)
+		if ip == nil {
+			return "", fmt.Errorf("invalid DNS server %s of NIC %s", server, nic.name)
+		}
+		if ip.To4() != nil {
+			ipv4DNS = append(ipv4DNS, server)
+		} else {
+			ipv6DNS = append(ipv6DNS, server)
+		}
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "[connection]\nid=%s\ntype=ethernet\nautoconnect=true\n\n", nic.name)
+	fmt.Fprintf(&b, "[ethernet]\nmac-address=%s\n\n", strings.ToUpper(nic.mac))
+	b.WriteString("[ipv4]\n")
+	if nic.config.IPv4 == nil {
+		b.WriteString("method=disabled\n")
+	} else {
+		writeNMIPSection(&b, nic.config.IPv4, ipv4DNS)
+	}
+	b.WriteString("\n[ipv6]\n")
+	if nic.config.IPv6 == nil {
+		b.WriteString("method=ignore\n")
+	} else {
+		writeNMIPSection(&b, nic.config.IPv6, ipv6DNS)
+	}
+	return b.String(), nil
+}
+
+// writeNMIPSection writes the settings of a manually configured ipv4 or ipv6 section of a keyfile.
+func writeNMIPSection(b *strings.Builder, config *ovirtconfigv1.IPConfig, dns []string) {
+	b.WriteString("method=manual\n")
+	if config.Gateway != "" {
+		fmt.Fprintf(b, "address1=%s,%s\n", config.Address, config.Gateway)
+	} else {
+		fmt.Fprintf(b, "address1=%s\n", config.Address)
+	}
+	if len(dns) > 0 {
+		fmt.Fprintf(b, "dns=%s;\n", strings.Join(dns, ";"))
+	}
+}
@@ -0,0 +1,107 @@
+//go:build unit
+
+package machine
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/openshift/cluster-api-provider-ovirt/pkg/apis/ovirtprovider/v1beta1"
+)
+
+func TestInjectStaticIPConfig(t *testing.T) {
+	nic := staticIPNIC{
+		name: "nic1",
+		mac:  "56:6f:1a:2b:00:01",
+		config: &v1beta1.StaticIPConfig{
+			IPv4: &v1beta1.IPConfig{Address: "192.168.1.10/24", Gateway: "192.168.1.1"},
+			DNS:  []string{"192.168.1.1", "fd00::1"},
+		},
+	}
+
+	testcases := []struct {
+		name               string
+		ignition           string
+		expectedFilesystem bool
+		expectedFiles      int
+		expectError        bool
+	}{
+		{
+			name:          "empty ignition is replaced by a config with the keyfile",
+			ignition:      "",
+			expectedFiles: 1,
+		},
+		{
+			name:          "keyfile is appended to the files of a spec 3 config",
+			ignition:      `{"ignition":{"version":"3.2.0"},"storage":{"files":[{"path":"/etc/motd"}]}}`,
+			expectedFiles: 2,
+		},
+		{
+			name:               "keyfile of a spec 2 config is written to the root filesystem",
+			ignition:           `{"ignition":{"version":"2.2.0"}}`,
+			expectedFilesystem: true,
+			expectedFiles:      1,
+		},
+		{
+			name:        "user data which isn't an ignition config fails",
+			ignition:    "#cloud-config\n",
+			expectError: true,
+		},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.name, func(t *testing.T) {
+			result, err := injectStaticIPConfig([]byte(testcase.ignition), []staticIPNIC{nic})
+			if testcase.expectError {
+				if err == nil {
+					t.Fatalf("Expected an error, but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error occurred injecting static IP config: %v", err)
+			}
+
+			var config struct {
+				Storage struct {
+					Files []struct {
+						Path       string `json:"path"`
+						Filesystem string `json:"filesystem"`
+						Contents   struct {
+							Source string `json:"source"`
+						} `json:"contents"`
+					} `json:"files"`
+				} `json:"storage"`
+			}
+			if err := json.Unmarshal(result, &config); err != nil {
+				t.Fatalf("Unexpected error occurred parsing ignition: %v", err)
+			}
+			if len(config.Storage.Files) != testcase.expectedFiles {
+				t.Fatalf("Expected %d files, but got %d", testcase.expectedFiles, len(config.Storage.Files))
+			}
+			file := config.Storage.Files[len(config.Storage.Files)-1]
+			if file.Path != "/etc/NetworkManager/system-connections/nic1.nmconnection" {
+				t.Errorf("Unexpected keyfile path %s", file.Path)
+			}
+			if (file.Filesystem == "root") != testcase.expectedFilesystem {
+				t.Errorf("Unexpected filesystem %q", file.Filesystem)
+			}
+			keyfile, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(file.Contents.Source, "data:text/plain;charset=utf-8;base64,"))
+			if err != nil {
+				t.Fatalf("Unexpected error occurred decoding keyfile: %v", err)
+			}
+			for _, expected := range []string{
+				"mac-address=56:6F:1A:2B:00:01",
+				"address1=192.168.1.10/24,192.168.1.1",
+				"dns=192.168.1.1;",
+				"[ipv6]\nmethod=ignore\n",
+			} {
+				if !strings.Contains(string(keyfile), expected) {
+					t.Errorf("Expected keyfile to contain %q, but got:\n%s", expected, keyfile)
+				}
+			}
+		})
+	}
+}
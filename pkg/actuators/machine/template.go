@@ -0,0 +1,163 @@
+package machine
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	ovirtconfigv1 "github.com/openshift/cluster-api-provider-ovirt/pkg/apis/ovirtprovider/v1beta1"
+	"github.com/openshift/cluster-api-provider-ovirt/pkg/ovirt"
+	ovirtsdk "github.com/ovirt/go-ovirt"
+	ovirtC "github.com/ovirt/go-ovirt-client/v2"
+	"github.com/pkg/errors"
+)
+
+// baseTemplateVersion is the version number of the base version of a template.
+const baseTemplateVersion = 1
+
+// resolveTemplate returns the template the VM is created from. The template is selected by its ID, or by
+// its name and version in the datacenter of the oVirt cluster. It has to belong to the datacenter of
+// the oVirt cluster and be in OK status.
+func (ms *machineScope) resolveTemplate() (ovirtC.Template, error) {
+	spec := ms.machineProviderSpec
+	datacenter, err := ms.clusterDatacenter()
+	if err != nil {
+		return nil, err
+	}
+
+	templateID := ovirtC.TemplateID(spec.TemplateId)
+	if templateID == "" {
+		if templateID, err = ms.findTemplateVersion(spec.TemplateName, spec.TemplateVersion, datacenter); err != nil {
+			return nil, err
+		}
+	} else if err := ms.verifyTemplateDatacenter(templateID, datacenter); err != nil {
+		return nil, err
+	}
+
+	template, err := ms.ovirtClient.GetTemplate(templateID, ovirtC.ContextStrategy(ms.Context))
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get template %s", templateID)
+	}
+	if template.Status() != ovirtC.TemplateStatusOK {
+		return nil, fmt.Errorf("template %s (%s) is in status %s, expected %s",
+			template.Name(), template.ID(), template.Status(), ovirtC.TemplateStatusOK)
+	}
+	return template, nil
+}
+
+// findTemplateVersion returns the ID of the given version of the template with the given name in the
+// datacenter. The go-ovirt-client doesn't support template versions and datacenters, therefore the
+// underlying oVirt SDK connection is used.
+func (ms *machineScope) findTemplateVersion(name string, version string, datacenter ovirtC.Datacenter) (ovirtC.TemplateID, error) {
+	legacyClient, ok := ms.ovirtClient.(ovirtC.ClientWithLegacySupport)
+	if !ok {
+		if version != "" {
+			return "", fmt.Errorf("template versions are not supported by the oVirt client")
+		}
+		template, err := ms.ovirtClient.GetTemplateByName(name, ovirtC.ContextStrategy(ms.Context))
+		if err != nil {
+			return "", errors.Wrapf(err, "error finding template name %s", name)
+		}
+		return template.ID(), nil
+	}
+
+	var response *ovirtsdk.TemplatesServiceListResponse
+	err := ovirt.CallSDK(ms.Context, legacyClient, "ListTemplates", func(conn *ovirtsdk.Connection) (err error) {
+		response, err = conn.SystemService().TemplatesService().List().
+			Search(fmt.Sprintf("name=%s and datacenter=%s", searchValue(name), searchValue(datacenter.Name()))).
+			Send()
+		return err
+	})
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to list templates with name %s", name)
+	}
+	templateID, err := selectTemplateVersion(response.MustTemplates().Slice(), name, version)
+	if err != nil {
+		return "", fmt.Errorf("%w in datacenter %s", err, datacenter.Name())
+	}
+	return templateID, nil
+}
+
+// searchValue quotes the value for an oVirt search query, so that names containing spaces or search
+// syntax are matched literally. Backslashes and double quotes in the value are escaped.
+func searchValue(value string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(value) + `"`
+}
+
+// selectTemplateVersion returns the ID of the given version of the template with the given name.
+// An empty version selects the base version, ovirtconfigv1.TemplateVersionLatest the newest version.
+func selectTemplateVersion(templates []*ovirtsdk.Template, name string, version string) (ovirtC.TemplateID, error) {
+	var selected *ovirtsdk.Template
+	var selectedNumber int64
+	for _, template := range templates {
+		if templateName, ok := template.Name(); !ok || templateName != name {
+			continue
+		}
+		number := int64(baseTemplateVersion)
+		if templateVersion, ok := template.Version(); ok {
+			if versionNumber, ok := templateVersion.VersionNumber(); ok {
+				number = versionNumber
+			}
+		}
+
+		var matches bool
+		switch version {
+		case "":
+			matches = number == baseTemplateVersion
+		case ovirtconfigv1.TemplateVersionLatest:
+			matches = selected == nil || number > selectedNumber
+		default:
+			matches = strconv.FormatInt(number, 10) == version
+		}
+		if matches {
+			selected, selectedNumber = template, number
+		}
+	}
+
+	if selected == nil {
+		if version == "" {
+			return "", fmt.Errorf("base version of template %s not found", name)
+		}
+		return "", fmt.Errorf("version %s of template %s not found", version, name)
+	}
+	return ovirtC.TemplateID(selected.MustId()), nil
+}
+
+// verifyTemplateDatacenter checks that the template belongs to the datacenter. Templates without a
+// cluster, like the Blank template, are available in all datacenters. The go-ovirt-client doesn't
+// return the cluster of a template, therefore the underlying oVirt SDK connection is used.
+func (ms *machineScope) verifyTemplateDatacenter(templateID ovirtC.TemplateID, datacenter ovirtC.Datacenter) error {
+	legacyClient, ok := ms.ovirtClient.(ovirtC.ClientWithLegacySupport)
+	if !ok {
+		ms.logger.Debugf("Skipping datacenter verification of template %s, not supported by the oVirt client", templateID)
+		return nil
+	}
+	var response *ovirtsdk.TemplateServiceGetResponse
+	err := ovirt.CallSDK(ms.Context, legacyClient, "GetTemplate", func(conn *ovirtsdk.Connection) (err error) {
+		response, err = conn.SystemService().TemplatesService().
+			TemplateService(string(templateID)).Get().Send()
+		return err
+	})
+	if err != nil {
+		return errors.Wrapf(err, "failed to get template %s", templateID)
+	}
+	cluster, ok := response.MustTemplate().Cluster()
+	if !ok {
+		return nil
+	}
+	clusterID, ok := cluster.Id()
+	if !ok {
+		return nil
+	}
+	clusters, err := ms.ovirtClient.ListDatacenterClusters(datacenter.ID(), ovirtC.ContextStrategy(ms.Context))
+	if err != nil {
+		return errors.Wrapf(err, "failed to list clusters of datacenter %s", datacenter.Name())
+	}
+	for _, cluster := range clusters {
+		if cluster.ID() == ovirtC.ClusterID(clusterID) {
+			return nil
+		}
+	}
+	return fmt.Errorf("template %s belongs to cluster %s, which is not in datacenter %s of the cluster",
+		templateID, clusterID, datacenter.Name())
+}
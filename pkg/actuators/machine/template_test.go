@@ -0,0 +1,110 @@
+//go:build unit
+
+package machine
+
+import (
+	"testing"
+
+	"github.com/openshift/cluster-api-provider-ovirt/pkg/apis/ovirtprovider/v1beta1"
+	ovirtsdk "github.com/ovirt/go-ovirt"
+)
+
+func TestSelectTemplateVersion(t *testing.T) {
+	templates := []*ovirtsdk.Template{
+		newSDKTemplate("base", "rhcos", 1),
+		newSDKTemplate("v3", "rhcos", 3),
+		newSDKTemplate("v2", "rhcos", 2),
+		newSDKTemplate("other", "fedora", 4),
+	}
+
+	testcases := []struct {
+		name        string
+		version     string
+		expectedID  string
+		expectError bool
+	}{
+		{
+			name:       "empty version selects the base version",
+			version:    "",
+			expectedID: "base",
+		},
+		{
+			name:       "latest selects the newest version of the template",
+			version:    v1beta1.TemplateVersionLatest,
+			expectedID: "v3",
+		},
+		{
+			name:       "version number selects the sub-version",
+			version:    "2",
+			expectedID: "v2",
+		},
+		{
+			name:        "unknown version number fails",
+			version:     "4",
+			expectError: true,
+		},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.name, func(t *testing.T) {
+			templateID, err := selectTemplateVersion(templates, "rhcos", testcase.version)
+			if testcase.expectError {
+				if err == nil {
+					t.Fatalf("Expected error, but got template %s", templateID)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error occurred selecting template version: %v", err)
+			}
+			if string(templateID) != testcase.expectedID {
+				t.Errorf("Expected template %s, but got %s", testcase.expectedID, templateID)
+			}
+		})
+	}
+}
+
+func TestSearchValue(t *testing.T) {
+	testcases := []struct {
+		name     string
+		value    string
+		expected string
+	}{
+		{
+			name:     "plain name is quoted",
+			value:    "rhcos",
+			expected: `"rhcos"`,
+		},
+		{
+			name:     "name containing a space is quoted",
+			value:    "rhcos template",
+			expected: `"rhcos template"`,
+		},
+		{
+			name:     "name containing search syntax is quoted",
+			value:    "rhcos and datacenter=other",
+			expected: `"rhcos and datacenter=other"`,
+		},
+		{
+			name:     "quotes and backslashes are escaped",
+			value:    `rhcos "4.10"\`,
+			expected: `"rhcos \"4.10\"\\"`,
+		},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.name, func(t *testing.T) {
+			if value := searchValue(testcase.value); value != testcase.expected {
+				t.Errorf("Expected search value %s, but got %s", testcase.expected, value)
+			}
+		})
+	}
+}
+
+func newSDKTemplate(id string, name string, version int64) *ovirtsdk.Template {
+	return ovirtsdk.NewTemplateBuilder().
+		Id(id).
+		Name(name).
+		Version(ovirtsdk.NewTemplateVersionBuilder().VersionNumber(version).MustBuild()).
+		MustBuild()
+}
@@ -0,0 +1,46 @@
+package machine
+
+import (
+	"context"
+
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracer creates the spans of the actuator operations and machine scope steps. It uses the global
+// tracer provider, which doesn't record anything unless tracing is configured.
+var tracer = otel.Tracer("github.com/openshift/cluster-api-provider-ovirt/pkg/actuators/machine")
+
+// startMachineSpan starts the span of an actuator operation on the machine.
+func startMachineSpan(ctx context.Context, operation string, machine *machinev1.Machine) (context.Context, trace.Span) {
+	return tracer.Start(ctx, "OvirtActuator."+operation, trace.WithAttributes(
+		attribute.String("machine.namespace", machine.Namespace),
+		attribute.String("machine.name", machine.Name),
+	))
+}
+
+// endSpan records the error of the traced operation and ends the span.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// traceStep runs a step of the machine scope in its own span. While the step runs, the context of the
+// machine scope is the context of the span, so the engine calls made with ContextStrategy(ms.Context)
+// are bound to it.
+func (ms *machineScope) traceStep(name string, step func() error) error {
+	parent := ms.Context
+	ctx, span := tracer.Start(parent, name)
+	ms.Context = ctx
+	defer func() { ms.Context = parent }()
+
+	err := step()
+	endSpan(span, err)
+	return err
+}
@@ -0,0 +1,56 @@
+//go:build unit
+
+package machine
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestMachineScope_TraceStep(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	defer otel.SetTracerProvider(trace.NewNoopTracerProvider())
+
+	machine := &machinev1.Machine{ObjectMeta: metav1.ObjectMeta{Namespace: "openshift-machine-api", Name: "machine"}}
+	ctx, span := startMachineSpan(context.Background(), "Create", machine)
+	ms := newMachineScope(ctx, nil, nil, machine, nil)
+
+	var stepSpan trace.SpanContext
+	err := ms.traceStep("failingStep", func() error {
+		stepSpan = trace.SpanContextFromContext(ms.Context)
+		return errors.New("step failed")
+	})
+	endSpan(span, err)
+
+	if ms.Context != ctx {
+		t.Errorf("Expected the context of the machine scope to be restored after the step")
+	}
+	spans := recorder.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("Expected 2 spans, but got %d", len(spans))
+	}
+	step, operation := spans[0], spans[1]
+	if step.Name() != "failingStep" || operation.Name() != "OvirtActuator.Create" {
+		t.Errorf("Expected spans failingStep and OvirtActuator.Create, but got %s and %s", step.Name(), operation.Name())
+	}
+	if step.SpanContext().SpanID() != stepSpan.SpanID() {
+		t.Errorf("Expected the step to run with the context of its span")
+	}
+	if step.Parent().SpanID() != operation.SpanContext().SpanID() {
+		t.Errorf("Expected the step span to be a child of the operation span")
+	}
+	if step.Status().Code != codes.Error || operation.Status().Code != codes.Error {
+		t.Errorf("Expected the error to be recorded in both spans, but got %v and %v",
+			step.Status().Code, operation.Status().Code)
+	}
+}
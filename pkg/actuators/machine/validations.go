@@ -2,10 +2,13 @@ package machine
 
 import (
 	"fmt"
+	"net"
+	"strconv"
 
 	ovirtconfigv1 "github.com/openshift/cluster-api-provider-ovirt/pkg/apis/ovirtprovider/v1beta1"
 	ovirtC "github.com/ovirt/go-ovirt-client/v2"
 	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/util/validation/field"
 )
 
 const (
@@ -13,117 +16,414 @@ const (
 	noHugePages               = 0
 	hugePages2M               = 2048
 	hugePages1GB              = 1048576
+	autoPinningNone           = "none"
+	autoPinningResizeAndPin   = "resize_and_pin"
 )
 
-// validateMachine validates the machine object yaml fields and
-// returns InvalidMachineConfiguration in case the validation failed
-func validateMachine(ovirtClient ovirtC.Client, config *ovirtconfigv1.OvirtMachineProviderSpec) error {
-	// UserDataSecret
-	if config.UserDataSecret == nil {
-		return fmt.Errorf("%s UserDataSecret must be provided!", ErrorInvalidMachineObject)
-	} else if config.UserDataSecret.Name == "" {
-		return fmt.Errorf("%s UserDataSecret *Name* must be provided!", ErrorInvalidMachineObject)
-	}
-
-	err := validateInstanceID(config)
-	if err != nil {
-		return fmt.Errorf("error validating InstanceID %v", err)
-	}
+var (
+	// MachineProviderSpecPath is the path of the provider spec in a Machine.
+	MachineProviderSpecPath = field.NewPath("spec", "providerSpec", "value")
+	// supportedVMTypes are the values of the VMType.
+	supportedVMTypes = []string{"server", "high_performance", "desktop"}
+	// supportedHugepages are the values of the Hugepages, 0 disables hugepages.
+	supportedHugepages = []string{"2048", "1048576"}
+	// supportedAutoPinningPolicies are the values of the AutoPinningPolicy.
+	supportedAutoPinningPolicies = []string{autoPinningNone, autoPinningResizeAndPin}
+)
 
-	// root disk of the node
-	if config.OSDisk == nil {
-		return fmt.Errorf("%s OS Disk (os_disk) must be specified!", ErrorInvalidMachineObject)
-	} else if config.OSDisk.SizeGB == 0 {
-		return fmt.Errorf("%s OS Disk (os_disk) *SizeGB* must be specified!", ErrorInvalidMachineObject)
-	}
+// validateMachine validates the machine object yaml fields and
+// returns InvalidMachineConfiguration in case the validation failed.
+// All problems are reported at once, together with their field paths below the provider spec path.
+func validateMachine(
+	ovirtClient ovirtC.Client,
+	config *ovirtconfigv1.OvirtMachineProviderSpec,
+	fldPath *field.Path,
+	retries ...ovirtC.RetryStrategy) error {
+	allErrs := ValidateProviderSpec(config, fldPath)
 
-	err = validateVirtualMachineType(config.VMType)
+	diskErrs, err := validateDiskAllocation(ovirtClient, config, fldPath, retries...)
 	if err != nil {
-		return fmt.Errorf("error validating Machine Type %w", err)
+		return err
 	}
+	allErrs = append(allErrs, diskErrs...)
 
-	if config.AutoPinningPolicy != "" {
-		supported, err := ovirtClient.SupportsFeature(ovirtC.FeatureAutoPinning)
+	if config.AutoPinningPolicy == autoPinningResizeAndPin {
+		supported, err := ovirtClient.SupportsFeature(ovirtC.FeatureAutoPinning, retries...)
 		if err != nil {
 			return errors.Wrap(err, "failed to check autopinning support")
 		}
 		if !supported {
-			return errors.Wrap(err, "autopinning is not supported.")
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("auto_pinning_policy"),
+				config.AutoPinningPolicy, "autopinning is not supported by the oVirt engine"))
 		}
 	}
-	if err := validateHugepages(config.Hugepages); err != nil {
-		return errors.Wrap(err, "error validating Hugepages")
+	return allErrs.ToAggregate()
+}
+
+// ValidateProviderSpec validates the fields of the provider spec at the given path which don't depend
+// on the oVirt engine. It is shared by the actuator and the admission webhooks.
+func ValidateProviderSpec(config *ovirtconfigv1.OvirtMachineProviderSpec, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+
+	if config.UserDataSecret == nil {
+		allErrs = append(allErrs, field.Required(fldPath.Child("userDataSecret"), "UserDataSecret must be provided"))
+	} else if config.UserDataSecret.Name == "" {
+		allErrs = append(allErrs, field.Required(fldPath.Child("userDataSecret", "name"),
+			"UserDataSecret name must be provided"))
 	}
 
-	if err := validateGuaranteedMemory(config); err != nil {
-		return errors.Wrap(err, "error validating GuaranteedMemory")
+	allErrs = append(allErrs, validateTemplate(config, fldPath)...)
+	allErrs = append(allErrs, validateInstanceID(config, fldPath)...)
+
+	// root disk of the node
+	if config.OSDisk == nil {
+		allErrs = append(allErrs, field.Required(fldPath.Child("os_disk"), "OS disk must be specified"))
+	} else if config.OSDisk.SizeGB <= 0 {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("os_disk", "size_gb"), config.OSDisk.SizeGB,
+			"OS disk size must be bigger than 0"))
 	}
 
-	return nil
+	allErrs = append(allErrs, validateNetworkInterfaces(config.NetworkInterfaces, fldPath.Child("network_interfaces"))...)
+	allErrs = append(allErrs, validateAdditionalDisks(config, fldPath)...)
+	allErrs = append(allErrs, validateDiskRetention(config, fldPath)...)
+	allErrs = append(allErrs, validateVirtualMachineType(config.VMType, fldPath.Child("type"))...)
+	allErrs = append(allErrs, validateHugepages(config.Hugepages, fldPath.Child("hugepages"))...)
+	allErrs = append(allErrs, validateCPU(config.CPU, fldPath.Child("cpu"))...)
+	allErrs = append(allErrs, validateMemory(config, fldPath)...)
+	allErrs = append(allErrs, validateGuaranteedMemory(config, fldPath)...)
+	allErrs = append(allErrs, validateAutoPinningPolicy(config.AutoPinningPolicy, fldPath.Child("auto_pinning_policy"))...)
+	allErrs = append(allErrs, validateFieldCombinations(config, fldPath)...)
+
+	return allErrs
 }
 
 // validateInstanceID execute validations regarding the InstanceID.
-// Returns: nil or InvalidMachineConfiguration
-func validateInstanceID(config *ovirtconfigv1.OvirtMachineProviderSpec) error {
+// Returns: the problems of the InstanceID
+func validateInstanceID(config *ovirtconfigv1.OvirtMachineProviderSpec, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
 	// Cannot set InstanceTypeID and at same time: MemoryMB OR CPU
-	if len(config.InstanceTypeId) != 0 {
-		if config.MemoryMB != 0 || config.CPU != nil {
-			return fmt.Errorf(
-				"%s InstanceTypeID and MemoryMB OR CPU cannot be set at the same time", ErrorInvalidMachineObject)
+	// the InstanceTypeName is resolved to the InstanceTypeID by the actuator
+	if len(config.InstanceTypeId) != 0 || len(config.InstanceTypeName) != 0 {
+		if config.MemoryMB != 0 {
+			allErrs = append(allErrs, field.Forbidden(fldPath.Child("memory_mb"),
+				"MemoryMB cannot be set at the same time as the instance type"))
+		}
+		if config.CPU != nil {
+			allErrs = append(allErrs, field.Forbidden(fldPath.Child("cpu"),
+				"CPU cannot be set at the same time as the instance type"))
 		}
 	} else {
 		if config.MemoryMB == 0 {
-			return fmt.Errorf("%s MemoryMB must be specified", ErrorInvalidMachineObject)
+			allErrs = append(allErrs, field.Required(fldPath.Child("memory_mb"),
+				"MemoryMB must be specified if no instance type is set"))
 		}
 		if config.CPU == nil {
-			return fmt.Errorf("%s CPU must be specified", ErrorInvalidMachineObject)
+			allErrs = append(allErrs, field.Required(fldPath.Child("cpu"),
+				"CPU must be specified if no instance type is set"))
 		}
 	}
-	return nil
+	return allErrs
+}
+
+// validateTemplate execute validations regarding the template the Virtual Machine is created from.
+// Returns: the problems of the template
+func validateTemplate(config *ovirtconfigv1.OvirtMachineProviderSpec, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	if config.TemplateId == "" && config.TemplateName == "" {
+		allErrs = append(allErrs, field.Required(fldPath.Child("template_name"),
+			"either TemplateId or TemplateName must be specified"))
+	}
+	if config.TemplateVersion == "" || config.TemplateVersion == ovirtconfigv1.TemplateVersionLatest {
+		return allErrs
+	}
+	if config.TemplateId != "" {
+		allErrs = append(allErrs, field.Forbidden(fldPath.Child("template_version"),
+			"TemplateVersion cannot be set at the same time as TemplateId"))
+	}
+	if version, err := strconv.Atoi(config.TemplateVersion); err != nil || version < 1 {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("template_version"), config.TemplateVersion,
+			fmt.Sprintf("must be a version number or %q", ovirtconfigv1.TemplateVersionLatest)))
+	}
+	return allErrs
 }
 
 // validateVirtualMachineType execute validations regarding the
 // Virtual Machine type (desktop, server, high_performance).
-// Returns: nil or InvalidMachineConfiguration
-func validateVirtualMachineType(vmtype string) error {
+// Returns: the problems of the VM type
+func validateVirtualMachineType(vmtype string, fldPath *field.Path) field.ErrorList {
 	if len(vmtype) == 0 {
-		return fmt.Errorf("VMType (keyword: type in YAML) must be specified")
+		return field.ErrorList{field.Required(fldPath, "VMType must be specified")}
 	}
-	switch vmtype {
-	case "server", "high_performance", "desktop":
-		return nil
-	default:
-		return fmt.Errorf(
-			"error creating oVirt instance: The machine type must "+
-				"be one of the following options: "+
-				"server, high_performance or desktop. The value: %s is not valid", vmtype)
+	for _, supported := range supportedVMTypes {
+		if vmtype == supported {
+			return nil
+		}
 	}
+	return field.ErrorList{field.NotSupported(fldPath, vmtype, supportedVMTypes)}
 }
 
 // validateHugepages execute validation regarding the Virtual Machine hugepages
 // custom property (2048, 1048576).
-// Returns: nil or error
-func validateHugepages(value int32) error {
+// Returns: the problems of the hugepages
+func validateHugepages(value int32, fldPath *field.Path) field.ErrorList {
 	switch value {
 	case noHugePages, hugePages2M, hugePages1GB:
 		return nil
 	default:
-		return fmt.Errorf(
-			"error creating oVirt instance: The machine `hugepages` custom property must "+
-				"be one of the following options: 2048, 1048576. "+
-				"The value: %d is not valid", value)
+		return field.ErrorList{field.NotSupported(fldPath, value, supportedHugepages)}
 	}
 }
 
 // validateGuaranteedMemory execute validation regarding the Virtual Machine validateGuaranteedMemory
-// Returns: nil or error
-func validateGuaranteedMemory(config *ovirtconfigv1.OvirtMachineProviderSpec) error {
+// Returns: the problems of the guaranteed memory
+func validateGuaranteedMemory(config *ovirtconfigv1.OvirtMachineProviderSpec, fldPath *field.Path) field.ErrorList {
 	if config.GuaranteedMemoryMB > config.MemoryMB {
-		return fmt.Errorf("GuaranteedMemoryMB (%d) cannot be bigger then  MemoryMB (%d)",
-			config.GuaranteedMemoryMB,
-			config.MemoryMB)
+		return field.ErrorList{field.Invalid(fldPath.Child("guaranteed_memory_mb"), config.GuaranteedMemoryMB,
+			fmt.Sprintf("cannot be bigger than MemoryMB (%d)", config.MemoryMB))}
 	}
-
 	return nil
+}
+
+// validateCPU execute validation regarding the CPU topology of the Virtual Machine
+// Returns: the problems of the CPU topology
+func validateCPU(cpu *ovirtconfigv1.CPU, fldPath *field.Path) field.ErrorList {
+	if cpu == nil {
+		return nil
+	}
+	allErrs := field.ErrorList{}
+	if cpu.Sockets < 1 {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("sockets"), cpu.Sockets, "must be at least 1"))
+	}
+	if cpu.Cores < 1 {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("cores"), cpu.Cores, "must be at least 1"))
+	}
+	if cpu.Threads < 1 {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("threads"), cpu.Threads, "must be at least 1"))
+	}
+	return allErrs
+}
+
+// validateMemory execute validation regarding the memory sizes of the Virtual Machine
+// Returns: the problems of the memory sizes
+func validateMemory(config *ovirtconfigv1.OvirtMachineProviderSpec, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	if config.MemoryMB < 0 {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("memory_mb"), config.MemoryMB, "cannot be negative"))
+	}
+	if config.GuaranteedMemoryMB < 0 {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("guaranteed_memory_mb"), config.GuaranteedMemoryMB,
+			"cannot be negative"))
+	}
+	return allErrs
+}
+
+// validateAutoPinningPolicy execute validation regarding the auto pinning policy (none, resize_and_pin).
+// Returns: the problems of the auto pinning policy
+func validateAutoPinningPolicy(policy string, fldPath *field.Path) field.ErrorList {
+	switch policy {
+	case "", autoPinningNone, autoPinningResizeAndPin:
+		return nil
+	default:
+		return field.ErrorList{field.NotSupported(fldPath, policy, supportedAutoPinningPolicies)}
+	}
+}
+
+// validateFieldCombinations execute validation regarding fields which are valid on their own,
+// but can't be combined.
+// Returns: the problems of the field combinations
+func validateFieldCombinations(config *ovirtconfigv1.OvirtMachineProviderSpec, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+
+	// disks are only copied to another storage domain when they are cloned, desktops aren't cloned by default
+	clone := config.VMType != string(ovirtC.VMTypeDesktop)
+	if config.Clone != nil {
+		clone = *config.Clone
+	}
+	if !clone {
+		if config.StorageDomainId != "" {
+			allErrs = append(allErrs, field.Forbidden(fldPath.Child("storage_domain_id"),
+				"the storage domain can only be set if the disks are cloned from the template"))
+		}
+		if config.StorageDomainName != "" {
+			allErrs = append(allErrs, field.Forbidden(fldPath.Child("storage_domain_name"),
+				"the storage domain can only be set if the disks are cloned from the template"))
+		}
+	}
+
+	if config.Hugepages != noHugePages && config.VMType == string(ovirtC.VMTypeDesktop) {
+		allErrs = append(allErrs, field.Forbidden(fldPath.Child("hugepages"),
+			"hugepages are not supported for the desktop VM type"))
+	}
+	return allErrs
+}
 
+// validateDiskAllocation checks that raw disks aren't thin provisioned on block storage domains, which
+// oVirt doesn't support. The OS disk is only checked if sparse provisioning is requested explicitly,
+// additional disks are thin provisioned by default.
+// Returns: the problems of the disk allocation, or an error if the storage domains couldn't be fetched
+func validateDiskAllocation(
+	ovirtClient ovirtC.Client,
+	config *ovirtconfigv1.OvirtMachineProviderSpec,
+	fldPath *field.Path,
+	retries ...ovirtC.RetryStrategy) (field.ErrorList, error) {
+	allErrs := field.ErrorList{}
+	isBlockStorage := func(id string) (bool, error) {
+		storageDomain, err := ovirtClient.GetStorageDomain(ovirtC.StorageDomainID(id), retries...)
+		if err != nil {
+			return false, errors.Wrapf(err, "failed to get storage domain %s", id)
+		}
+		return isBlockStorageType(storageDomain.StorageType()), nil
+	}
+
+	if config.Format == string(ovirtC.ImageFormatRaw) && config.Sparse != nil && *config.Sparse && config.StorageDomainId != "" {
+		block, err := isBlockStorage(config.StorageDomainId)
+		if err != nil {
+			return nil, err
+		}
+		if block {
+			allErrs = append(allErrs, field.Forbidden(fldPath.Child("sparse"),
+				"raw disks can't be thin provisioned on block storage"))
+		}
+	}
+	for i, disk := range config.AdditionalDisks {
+		if disk.Format != string(ovirtC.ImageFormatRaw) || (disk.Sparse != nil && !*disk.Sparse) {
+			continue
+		}
+		storageDomainID := disk.StorageDomainId
+		if storageDomainID == "" {
+			storageDomainID = config.StorageDomainId
+		}
+		if storageDomainID == "" {
+			continue
+		}
+		block, err := isBlockStorage(storageDomainID)
+		if err != nil {
+			return nil, err
+		}
+		if block {
+			allErrs = append(allErrs, field.Forbidden(fldPath.Child("additional_disks").Index(i).Child("sparse"),
+				"raw disks can't be thin provisioned on block storage"))
+		}
+	}
+	return allErrs, nil
+}
+
+// isBlockStorageType returns true if the storage domain type is backed by block storage.
+func isBlockStorageType(storageType ovirtC.StorageDomainType) bool {
+	switch storageType {
+	case ovirtC.StorageDomainTypeISCSI, ovirtC.StorageDomainTypeFCP:
+		return true
+	default:
+		return false
+	}
+}
+
+// validateAdditionalDisks execute validation regarding the additional disks of the Virtual Machine
+// Returns: the problems of the additional disks
+func validateAdditionalDisks(config *ovirtconfigv1.OvirtMachineProviderSpec, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	aliases := make(map[string]bool, len(config.AdditionalDisks))
+	for i, disk := range config.AdditionalDisks {
+		diskPath := fldPath.Child("additional_disks").Index(i)
+		if disk.SizeGB <= 0 {
+			allErrs = append(allErrs, field.Invalid(diskPath.Child("size_gb"), disk.SizeGB, "must be bigger than 0"))
+		}
+		if disk.StorageDomainId == "" && config.StorageDomainId == "" && config.StorageDomainName == "" {
+			allErrs = append(allErrs, field.Required(diskPath.Child("storage_domain_id"),
+				"the storage domain must be specified on the disk or the provider spec"))
+		}
+		if disk.Alias != "" {
+			if aliases[disk.Alias] {
+				allErrs = append(allErrs, field.Duplicate(diskPath.Child("alias"), disk.Alias))
+			}
+			aliases[disk.Alias] = true
+		}
+	}
+	return allErrs
+}
+
+// validateDiskRetention execute validation regarding the retention policies of the additional disks
+// Returns: the problems of the retention policies
+func validateDiskRetention(config *ovirtconfigv1.OvirtMachineProviderSpec, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	disks := make(map[int32]bool, len(config.DiskRetention))
+	for i, retention := range config.DiskRetention {
+		retentionPath := fldPath.Child("disk_retention").Index(i)
+		if retention.AdditionalDisk < 1 || int(retention.AdditionalDisk) > len(config.AdditionalDisks) {
+			allErrs = append(allErrs, field.Invalid(retentionPath.Child("additional_disk"), retention.AdditionalDisk,
+				fmt.Sprintf("must be the position of one of the %d additional disks, starting at 1", len(config.AdditionalDisks))))
+		} else if disks[retention.AdditionalDisk] {
+			allErrs = append(allErrs, field.Duplicate(retentionPath.Child("additional_disk"), retention.AdditionalDisk))
+		}
+		disks[retention.AdditionalDisk] = true
+		switch retention.Policy {
+		case ovirtconfigv1.DiskRetentionPolicyDelete, ovirtconfigv1.DiskRetentionPolicyDetach,
+			ovirtconfigv1.DiskRetentionPolicyCopy:
+		default:
+			allErrs = append(allErrs, field.NotSupported(retentionPath.Child("policy"), retention.Policy,
+				[]string{string(ovirtconfigv1.DiskRetentionPolicyDelete), string(ovirtconfigv1.DiskRetentionPolicyDetach),
+					string(ovirtconfigv1.DiskRetentionPolicyCopy)}))
+		}
+	}
+	return allErrs
+}
+
+// validateNetworkInterfaces execute validation regarding the network interfaces of the Virtual Machine
+// Returns: the problems of the network interfaces
+func validateNetworkInterfaces(nics []*ovirtconfigv1.NetworkInterface, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	names := make(map[string]bool, len(nics))
+	for i, nic := range nics {
+		nicPath := fldPath.Index(i)
+		if nic.Name != "" {
+			if names[nic.Name] {
+				allErrs = append(allErrs, field.Duplicate(nicPath.Child("name"), nic.Name))
+			}
+			names[nic.Name] = true
+		}
+		if nic.VNICProfileID == "" && nic.NetworkName == "" {
+			allErrs = append(allErrs, field.Required(nicPath.Child("vnic_profile_id"),
+				"either the vNic profile ID or the network name must be set"))
+		}
+		if nic.MAC != "" {
+			if _, err := net.ParseMAC(nic.MAC); err != nil {
+				allErrs = append(allErrs, field.Invalid(nicPath.Child("mac"), nic.MAC, "invalid MAC address"))
+			}
+		}
+		if nic.StaticIP == nil {
+			continue
+		}
+		staticIPPath := nicPath.Child("static_ip")
+		if nic.StaticIP.IPv4 != nil {
+			allErrs = append(allErrs, validateIPConfig(nic.StaticIP.IPv4, false, staticIPPath.Child("ipv4"))...)
+		}
+		if nic.StaticIP.IPv6 != nil {
+			allErrs = append(allErrs, validateIPConfig(nic.StaticIP.IPv6, true, staticIPPath.Child("ipv6"))...)
+		}
+		for j, server := range nic.StaticIP.DNS {
+			if net.ParseIP(server) == nil {
+				allErrs = append(allErrs, field.Invalid(staticIPPath.Child("dns").Index(j), server, "invalid DNS server"))
+			}
+		}
+	}
+	return allErrs
+}
+
+// validateIPConfig checks that the address is in CIDR notation and that the address and the gateway
+// belong to the given IP family.
+func validateIPConfig(config *ovirtconfigv1.IPConfig, ipv6 bool, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	ip, _, err := net.ParseCIDR(config.Address)
+	if err != nil {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("address"), config.Address, "not in CIDR notation"))
+	} else if (ip.To4() == nil) != ipv6 {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("address"), config.Address, "wrong IP family"))
+	}
+	if config.Gateway != "" {
+		gateway := net.ParseIP(config.Gateway)
+		if gateway == nil || (gateway.To4() == nil) != ipv6 {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("gateway"), config.Gateway, "invalid gateway"))
+		}
+	}
+	return allErrs
 }
@@ -3,6 +3,7 @@
 package machine
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/openshift/cluster-api-provider-ovirt/pkg/apis/ovirtprovider/v1beta1"
@@ -10,6 +11,7 @@ import (
 	ovirtclient "github.com/ovirt/go-ovirt-client/v2"
 	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/pointer"
 )
 
 func TestValidateMachine(t *testing.T) {
@@ -62,6 +64,56 @@ func TestValidateMachine(t *testing.T) {
 			}),
 			expectIsValid: false,
 		},
+		{
+			name: "validation of machine provider spec without template fails",
+			spec: BasicValidSpec(func(omps *v1beta1.OvirtMachineProviderSpec) *v1beta1.OvirtMachineProviderSpec {
+				omps.TemplateName = ""
+				return omps
+			}),
+			expectIsValid: false,
+		},
+		{
+			name: "validation of machine provider spec with template ID succeeds",
+			spec: BasicValidSpec(func(omps *v1beta1.OvirtMachineProviderSpec) *v1beta1.OvirtMachineProviderSpec {
+				omps.TemplateName = ""
+				omps.TemplateId = "template"
+				return omps
+			}),
+			expectIsValid: true,
+		},
+		{
+			name: "validation of machine provider spec with latest template version succeeds",
+			spec: BasicValidSpec(func(omps *v1beta1.OvirtMachineProviderSpec) *v1beta1.OvirtMachineProviderSpec {
+				omps.TemplateVersion = v1beta1.TemplateVersionLatest
+				return omps
+			}),
+			expectIsValid: true,
+		},
+		{
+			name: "validation of machine provider spec with template version number succeeds",
+			spec: BasicValidSpec(func(omps *v1beta1.OvirtMachineProviderSpec) *v1beta1.OvirtMachineProviderSpec {
+				omps.TemplateVersion = "3"
+				return omps
+			}),
+			expectIsValid: true,
+		},
+		{
+			name: "validation of machine provider spec with invalid template version fails",
+			spec: BasicValidSpec(func(omps *v1beta1.OvirtMachineProviderSpec) *v1beta1.OvirtMachineProviderSpec {
+				omps.TemplateVersion = "newest"
+				return omps
+			}),
+			expectIsValid: false,
+		},
+		{
+			name: "validation of machine provider spec with template ID and version number fails",
+			spec: BasicValidSpec(func(omps *v1beta1.OvirtMachineProviderSpec) *v1beta1.OvirtMachineProviderSpec {
+				omps.TemplateId = "template"
+				omps.TemplateVersion = "2"
+				return omps
+			}),
+			expectIsValid: false,
+		},
 		{
 			name: "validation of machine provider spec with instance type ID set at the same time as MemoryMB and CPU fails",
 			spec: BasicValidSpec(func(omps *v1beta1.OvirtMachineProviderSpec) *v1beta1.OvirtMachineProviderSpec {
@@ -128,10 +180,246 @@ func TestValidateMachine(t *testing.T) {
 			}),
 			expectIsValid: false,
 		},
+		{
+			name: "validation of machine provider spec with static IP configuration succeeds",
+			spec: BasicValidSpec(func(omps *v1beta1.OvirtMachineProviderSpec) *v1beta1.OvirtMachineProviderSpec {
+				omps.ClusterId = string(helper.GetClusterID())
+				omps.NetworkInterfaces = []*v1beta1.NetworkInterface{{
+					VNICProfileID: string(helper.GetVNICProfileID()),
+					MAC:           "56:6f:1a:2b:00:01",
+					StaticIP: &v1beta1.StaticIPConfig{
+						IPv4: &v1beta1.IPConfig{Address: "192.168.1.10/24", Gateway: "192.168.1.1"},
+						IPv6: &v1beta1.IPConfig{Address: "fd00::10/64"},
+						DNS:  []string{"192.168.1.1", "fd00::1"},
+					},
+				}}
+				return omps
+			}),
+			expectIsValid: true,
+		},
+		{
+			name: "validation of machine provider spec with invalid MAC address fails",
+			spec: BasicValidSpec(func(omps *v1beta1.OvirtMachineProviderSpec) *v1beta1.OvirtMachineProviderSpec {
+				omps.NetworkInterfaces = []*v1beta1.NetworkInterface{{VNICProfileID: "profile", MAC: "not-a-mac"}}
+				return omps
+			}),
+			expectIsValid: false,
+		},
+		{
+			name: "validation of machine provider spec with static IPv4 address without prefix fails",
+			spec: BasicValidSpec(func(omps *v1beta1.OvirtMachineProviderSpec) *v1beta1.OvirtMachineProviderSpec {
+				omps.NetworkInterfaces = []*v1beta1.NetworkInterface{{
+					VNICProfileID: "profile",
+					StaticIP:      &v1beta1.StaticIPConfig{IPv4: &v1beta1.IPConfig{Address: "192.168.1.10"}},
+				}}
+				return omps
+			}),
+			expectIsValid: false,
+		},
+		{
+			name: "validation of machine provider spec with IPv6 address as IPv4 configuration fails",
+			spec: BasicValidSpec(func(omps *v1beta1.OvirtMachineProviderSpec) *v1beta1.OvirtMachineProviderSpec {
+				omps.NetworkInterfaces = []*v1beta1.NetworkInterface{{
+					VNICProfileID: "profile",
+					StaticIP:      &v1beta1.StaticIPConfig{IPv4: &v1beta1.IPConfig{Address: "fd00::10/64"}},
+				}}
+				return omps
+			}),
+			expectIsValid: false,
+		},
+		{
+			name: "validation of machine provider spec with duplicate network interface names fails",
+			spec: BasicValidSpec(func(omps *v1beta1.OvirtMachineProviderSpec) *v1beta1.OvirtMachineProviderSpec {
+				omps.NetworkInterfaces = []*v1beta1.NetworkInterface{
+					{Name: "eth", VNICProfileID: "profile"},
+					{Name: "eth", VNICProfileID: "profile"},
+				}
+				return omps
+			}),
+			expectIsValid: false,
+		},
+		{
+			name: "validation of machine provider spec without vNic profile ID and network name fails",
+			spec: BasicValidSpec(func(omps *v1beta1.OvirtMachineProviderSpec) *v1beta1.OvirtMachineProviderSpec {
+				omps.ClusterId = string(helper.GetClusterID())
+				omps.NetworkInterfaces = []*v1beta1.NetworkInterface{{}}
+				return omps
+			}),
+			expectIsValid: false,
+		},
+		{
+			name: "validation of machine provider spec with additional disk succeeds",
+			spec: BasicValidSpec(func(omps *v1beta1.OvirtMachineProviderSpec) *v1beta1.OvirtMachineProviderSpec {
+				omps.AdditionalDisks = []v1beta1.AdditionalDisk{{SizeGB: 100, StorageDomainId: "sd"}}
+				return omps
+			}),
+			expectIsValid: true,
+		},
+		{
+			name: "validation of machine provider spec with additional disk size 0 fails",
+			spec: BasicValidSpec(func(omps *v1beta1.OvirtMachineProviderSpec) *v1beta1.OvirtMachineProviderSpec {
+				omps.AdditionalDisks = []v1beta1.AdditionalDisk{{SizeGB: 0, StorageDomainId: "sd"}}
+				return omps
+			}),
+			expectIsValid: false,
+		},
+		{
+			name: "validation of machine provider spec with additional disk without storage domain fails",
+			spec: BasicValidSpec(func(omps *v1beta1.OvirtMachineProviderSpec) *v1beta1.OvirtMachineProviderSpec {
+				omps.AdditionalDisks = []v1beta1.AdditionalDisk{{SizeGB: 100}}
+				return omps
+			}),
+			expectIsValid: false,
+		},
+		{
+			name: "validation of machine provider spec with duplicate additional disk aliases fails",
+			spec: BasicValidSpec(func(omps *v1beta1.OvirtMachineProviderSpec) *v1beta1.OvirtMachineProviderSpec {
+				omps.StorageDomainId = "sd"
+				omps.AdditionalDisks = []v1beta1.AdditionalDisk{{Alias: "data", SizeGB: 100}, {Alias: "data", SizeGB: 10}}
+				return omps
+			}),
+			expectIsValid: false,
+		},
+		{
+			name: "validation of machine provider spec with disk retention of an additional disk succeeds",
+			spec: BasicValidSpec(func(omps *v1beta1.OvirtMachineProviderSpec) *v1beta1.OvirtMachineProviderSpec {
+				omps.AdditionalDisks = []v1beta1.AdditionalDisk{{SizeGB: 100, StorageDomainId: "sd"}}
+				omps.DiskRetention = []v1beta1.DiskRetention{{AdditionalDisk: 1, Policy: v1beta1.DiskRetentionPolicyCopy}}
+				return omps
+			}),
+			expectIsValid: true,
+		},
+		{
+			name: "validation of machine provider spec with disk retention of a missing additional disk fails",
+			spec: BasicValidSpec(func(omps *v1beta1.OvirtMachineProviderSpec) *v1beta1.OvirtMachineProviderSpec {
+				omps.AdditionalDisks = []v1beta1.AdditionalDisk{{SizeGB: 100, StorageDomainId: "sd"}}
+				omps.DiskRetention = []v1beta1.DiskRetention{{AdditionalDisk: 2, Policy: v1beta1.DiskRetentionPolicyDetach}}
+				return omps
+			}),
+			expectIsValid: false,
+		},
+		{
+			name: "validation of machine provider spec with duplicate disk retention fails",
+			spec: BasicValidSpec(func(omps *v1beta1.OvirtMachineProviderSpec) *v1beta1.OvirtMachineProviderSpec {
+				omps.AdditionalDisks = []v1beta1.AdditionalDisk{{SizeGB: 100, StorageDomainId: "sd"}}
+				omps.DiskRetention = []v1beta1.DiskRetention{
+					{AdditionalDisk: 1, Policy: v1beta1.DiskRetentionPolicyDetach},
+					{AdditionalDisk: 1, Policy: v1beta1.DiskRetentionPolicyDelete},
+				}
+				return omps
+			}),
+			expectIsValid: false,
+		},
+		{
+			name: "validation of machine provider spec with 0 CPU sockets fails",
+			spec: BasicValidSpec(func(omps *v1beta1.OvirtMachineProviderSpec) *v1beta1.OvirtMachineProviderSpec {
+				omps.CPU.Sockets = 0
+				return omps
+			}),
+			expectIsValid: false,
+		},
+		{
+			name: "validation of machine provider spec with negative CPU threads fails",
+			spec: BasicValidSpec(func(omps *v1beta1.OvirtMachineProviderSpec) *v1beta1.OvirtMachineProviderSpec {
+				omps.CPU.Threads = -1
+				return omps
+			}),
+			expectIsValid: false,
+		},
+		{
+			name: "validation of machine provider spec with negative MemoryMB fails",
+			spec: BasicValidSpec(func(omps *v1beta1.OvirtMachineProviderSpec) *v1beta1.OvirtMachineProviderSpec {
+				omps.MemoryMB = -1024
+				return omps
+			}),
+			expectIsValid: false,
+		},
+		{
+			name: "validation of machine provider spec with negative guaranteed memory fails",
+			spec: BasicValidSpec(func(omps *v1beta1.OvirtMachineProviderSpec) *v1beta1.OvirtMachineProviderSpec {
+				omps.GuaranteedMemoryMB = -1
+				return omps
+			}),
+			expectIsValid: false,
+		},
+		{
+			name: "validation of machine provider spec with auto pinning policy none succeeds",
+			spec: BasicValidSpec(func(omps *v1beta1.OvirtMachineProviderSpec) *v1beta1.OvirtMachineProviderSpec {
+				omps.AutoPinningPolicy = autoPinningNone
+				return omps
+			}),
+			expectIsValid: true,
+		},
+		{
+			name: "validation of machine provider spec with unknown auto pinning policy fails",
+			spec: BasicValidSpec(func(omps *v1beta1.OvirtMachineProviderSpec) *v1beta1.OvirtMachineProviderSpec {
+				omps.AutoPinningPolicy = "pin"
+				return omps
+			}),
+			expectIsValid: false,
+		},
+		{
+			name: "validation of machine provider spec with storage domain and disabled clone fails",
+			spec: BasicValidSpec(func(omps *v1beta1.OvirtMachineProviderSpec) *v1beta1.OvirtMachineProviderSpec {
+				omps.StorageDomainId = "sd"
+				omps.Clone = pointer.Bool(false)
+				return omps
+			}),
+			expectIsValid: false,
+		},
+		{
+			name: "validation of desktop machine provider spec with storage domain fails",
+			spec: BasicValidSpec(func(omps *v1beta1.OvirtMachineProviderSpec) *v1beta1.OvirtMachineProviderSpec {
+				omps.VMType = "desktop"
+				omps.StorageDomainName = "sd"
+				return omps
+			}),
+			expectIsValid: false,
+		},
+		{
+			name: "validation of desktop machine provider spec with storage domain and clone succeeds",
+			spec: BasicValidSpec(func(omps *v1beta1.OvirtMachineProviderSpec) *v1beta1.OvirtMachineProviderSpec {
+				omps.VMType = "desktop"
+				omps.StorageDomainId = "sd"
+				omps.Clone = pointer.Bool(true)
+				return omps
+			}),
+			expectIsValid: true,
+		},
+		{
+			name: "validation of desktop machine provider spec with hugepages fails",
+			spec: BasicValidSpec(func(omps *v1beta1.OvirtMachineProviderSpec) *v1beta1.OvirtMachineProviderSpec {
+				omps.VMType = "desktop"
+				omps.Hugepages = hugePages2M
+				return omps
+			}),
+			expectIsValid: false,
+		},
+		{
+			name: "validation of machine provider spec with sparse raw disk on file storage succeeds",
+			spec: BasicValidSpec(func(omps *v1beta1.OvirtMachineProviderSpec) *v1beta1.OvirtMachineProviderSpec {
+				omps.StorageDomainId = string(helper.GetStorageDomainID())
+				omps.Format = string(ovirtclient.ImageFormatRaw)
+				omps.Sparse = pointer.Bool(true)
+				omps.AdditionalDisks = []v1beta1.AdditionalDisk{{SizeGB: 10, Format: string(ovirtclient.ImageFormatRaw)}}
+				return omps
+			}),
+			expectIsValid: true,
+		},
+		{
+			name: "validation of machine provider spec with sparse raw disk on unknown storage domain fails",
+			spec: BasicValidSpec(func(omps *v1beta1.OvirtMachineProviderSpec) *v1beta1.OvirtMachineProviderSpec {
+				omps.StorageDomainId = "00000000-0000-0000-0000-000000000000"
+				omps.Format = string(ovirtclient.ImageFormatRaw)
+				omps.Sparse = pointer.Bool(true)
+				return omps
+			}),
+			expectIsValid: false,
+		},
 	}
 	for _, testcase := range testCases {
 		t.Run(testcase.name, func(t *testing.T) {
-			validationError := validateMachine(helper.GetClient(), testcase.spec)
+			validationError := validateMachine(helper.GetClient(), testcase.spec, MachineProviderSpecPath)
 			if validationError != nil == testcase.expectIsValid {
 				t.Errorf("expected spec to be valid(%t), but got error '%v'", testcase.expectIsValid, validationError)
 			}
@@ -139,6 +427,47 @@ func TestValidateMachine(t *testing.T) {
 	}
 }
 
+func TestValidateMachineReportsAllErrors(t *testing.T) {
+	helper, err := ovirtclient.NewMockTestHelper(ovirtclientlog.NewTestLogger(t))
+	if err != nil {
+		t.Fatalf("failed to setup test helper: %v", err)
+	}
+	spec := BasicValidSpec(func(omps *v1beta1.OvirtMachineProviderSpec) *v1beta1.OvirtMachineProviderSpec {
+		omps.UserDataSecret = nil
+		omps.OSDisk.SizeGB = 0
+		omps.Hugepages = 4096
+		return omps
+	})
+
+	validationError := validateMachine(helper.GetClient(), spec, MachineProviderSpecPath)
+	if validationError == nil {
+		t.Fatalf("expected spec to be invalid")
+	}
+	for _, path := range []string{
+		"spec.providerSpec.value.userDataSecret",
+		"spec.providerSpec.value.os_disk.size_gb",
+		"spec.providerSpec.value.hugepages",
+	} {
+		if !strings.Contains(validationError.Error(), path) {
+			t.Errorf("expected error for field %s, but got '%v'", path, validationError)
+		}
+	}
+}
+
+func TestIsBlockStorageType(t *testing.T) {
+	testcases := map[ovirtclient.StorageDomainType]bool{
+		ovirtclient.StorageDomainTypeISCSI:     true,
+		ovirtclient.StorageDomainTypeFCP:       true,
+		ovirtclient.StorageDomainTypeNFS:       false,
+		ovirtclient.StorageDomainTypeGlusterFS: false,
+	}
+	for storageType, expected := range testcases {
+		if isBlockStorageType(storageType) != expected {
+			t.Errorf("expected block storage(%t) for storage type %s", expected, storageType)
+		}
+	}
+}
+
 func BasicValidSpec(f func(*v1beta1.OvirtMachineProviderSpec) *v1beta1.OvirtMachineProviderSpec) *v1beta1.OvirtMachineProviderSpec {
 	basicValidSpec := &v1beta1.OvirtMachineProviderSpec{
 		ObjectMeta: metav1.ObjectMeta{
@@ -155,8 +484,9 @@ func BasicValidSpec(f func(*v1beta1.OvirtMachineProviderSpec) *v1beta1.OvirtMach
 			Threads: 1,
 			Sockets: 1,
 		},
-		Name:      "ovirt-vm-12345",
-		ClusterId: "46991e3f-8752-4ab6-9f2d-c37a98358d52",
+		Name:         "ovirt-vm-12345",
+		ClusterId:    "46991e3f-8752-4ab6-9f2d-c37a98358d52",
+		TemplateName: "rhcos",
 		UserDataSecret: &v1.LocalObjectReference{
 			Name: "top secret user data",
 		},
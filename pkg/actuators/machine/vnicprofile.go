@@ -0,0 +1,117 @@
+package machine
+
+import (
+	"fmt"
+
+	ovirtconfigv1 "github.com/openshift/cluster-api-provider-ovirt/pkg/apis/ovirtprovider/v1beta1"
+	ovirtC "github.com/ovirt/go-ovirt-client/v2"
+	"github.com/pkg/errors"
+)
+
+// resolveVNICProfileID returns the ID of the vNic profile of the network interface. The VNICProfileID is
+// used as is, otherwise the profile is looked up by the network and profile name in the datacenter of
+// the oVirt cluster.
+func resolveVNICProfileID(
+	ovirtClient ovirtC.Client,
+	datacenter ovirtC.Datacenter,
+	nic *ovirtconfigv1.NetworkInterface,
+	retries ...ovirtC.RetryStrategy) (ovirtC.VNICProfileID, error) {
+	if nic.VNICProfileID != "" {
+		return ovirtC.VNICProfileID(nic.VNICProfileID), nil
+	}
+	if nic.NetworkName == "" {
+		return "", fmt.Errorf("either the vNic profile ID or the network name has to be set")
+	}
+
+	if nic.DatacenterName != "" && nic.DatacenterName != datacenter.Name() {
+		return "", fmt.Errorf("datacenter %s is not the datacenter %s of the cluster",
+			nic.DatacenterName, datacenter.Name())
+	}
+
+	networks, err := ovirtClient.ListNetworks(retries...)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to list networks")
+	}
+	var network ovirtC.Network
+	for _, candidate := range networks {
+		if candidate.Name() == nic.NetworkName && candidate.DatacenterID() == datacenter.ID() {
+			network = candidate
+			break
+		}
+	}
+	if network == nil {
+		return "", fmt.Errorf("network %s not found in datacenter %s", nic.NetworkName, datacenter.Name())
+	}
+
+	profileName := nic.ProfileName
+	if profileName == "" {
+		profileName = nic.NetworkName
+	}
+	profiles, err := ovirtClient.ListVNICProfiles(retries...)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to list vNic profiles")
+	}
+	for _, profile := range profiles {
+		if profile.Name() == profileName && profile.NetworkID() == network.ID() {
+			return profile.ID(), nil
+		}
+	}
+	return "", fmt.Errorf("vNic profile %s not found on network %s", profileName, nic.NetworkName)
+}
+
+// verifyVNICProfile checks that the vNic profile exists and belongs to a network of the datacenter
+// of the oVirt cluster.
+func verifyVNICProfile(
+	ovirtClient ovirtC.Client,
+	datacenter ovirtC.Datacenter,
+	profileID ovirtC.VNICProfileID,
+	retries ...ovirtC.RetryStrategy) error {
+	profile, err := ovirtClient.GetVNICProfile(profileID, retries...)
+	if err != nil {
+		return errors.Wrapf(err, "failed to get vNic profile %s", profileID)
+	}
+	network, err := ovirtClient.GetNetwork(profile.NetworkID(), retries...)
+	if err != nil {
+		return errors.Wrapf(err, "failed to get network %s of vNic profile %s", profile.NetworkID(), profileID)
+	}
+	if network.DatacenterID() != datacenter.ID() {
+		return fmt.Errorf("network %s of vNic profile %s doesn't belong to datacenter %s of the cluster",
+			network.Name(), profileID, datacenter.Name())
+	}
+	return nil
+}
+
+// clusterDatacenter returns the datacenter the oVirt cluster of the provider spec belongs to.
+// The datacenter is looked up once and reused for the rest of the reconcile.
+func (ms *machineScope) clusterDatacenter() (ovirtC.Datacenter, error) {
+	if ms.datacenter != nil {
+		return ms.datacenter, nil
+	}
+	datacenter, err := findClusterDatacenter(ms.ovirtClient, ms.machineProviderSpec.ClusterId,
+		ovirtC.ContextStrategy(ms.Context))
+	if err != nil {
+		return nil, err
+	}
+	ms.datacenter = datacenter
+	return datacenter, nil
+}
+
+// findClusterDatacenter returns the datacenter the oVirt cluster belongs to.
+func findClusterDatacenter(ovirtClient ovirtC.Client, clusterID string, retries ...ovirtC.RetryStrategy) (ovirtC.Datacenter, error) {
+	datacenters, err := ovirtClient.ListDatacenters(retries...)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list datacenters")
+	}
+	for _, datacenter := range datacenters {
+		clusters, err := ovirtClient.ListDatacenterClusters(datacenter.ID(), retries...)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to list clusters of datacenter %s", datacenter.Name())
+		}
+		for _, cluster := range clusters {
+			if cluster.ID() == ovirtC.ClusterID(clusterID) {
+				return datacenter, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("no datacenter found for cluster %s", clusterID)
+}
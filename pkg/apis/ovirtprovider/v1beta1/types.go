@@ -35,6 +35,7 @@ type OvirtMachineProviderSpec struct {
 	UserDataSecret *corev1.LocalObjectReference `json:"userDataSecret,omitempty"`
 
 	// CredentialsSecret is a reference to the secret with oVirt credentials.
+	// The secret has to match the --credentials-secret-selector of the controller.
 	CredentialsSecret *corev1.LocalObjectReference `json:"credentialsSecret,omitempty"`
 
 	// Id is the UUID of the VM
@@ -44,16 +45,42 @@ type OvirtMachineProviderSpec struct {
 	Name string `json:"name"`
 
 	// The VM template this instance will be created from.
-	TemplateName string `json:"template_name"`
+	// Either TemplateId or TemplateName has to be set. The template is looked up by its name
+	// in the datacenter of the oVirt cluster.
+	// +optional
+	TemplateName string `json:"template_name,omitempty"`
+
+	// TemplateId is the ID of the VM template this instance will be created from.
+	// It selects a specific version of a template and takes precedence over TemplateName.
+	// +optional
+	TemplateId string `json:"template_id,omitempty"`
+
+	// TemplateVersion selects the version of the template named by TemplateName.
+	// It is either the version number of a sub-version or "latest" for the newest version.
+	// Defaults to the base version of the template.
+	// +optional
+	TemplateVersion string `json:"template_version,omitempty"`
 
 	// the oVirt cluster this VM instance belongs too.
-	ClusterId string `json:"cluster_id"`
+	// Either ClusterId or ClusterName has to be set.
+	// +optional
+	ClusterId string `json:"cluster_id,omitempty"`
+
+	// ClusterName is the name of the oVirt cluster this VM instance belongs to.
+	// It is resolved to the ID of the cluster if ClusterId is empty.
+	// +optional
+	ClusterName string `json:"cluster_name,omitempty"`
 
 	// InstanceTypeId defines the VM instance type and overrides
 	// the hardware parameters of the created VM, including cpu and memory.
 	// If InstanceTypeId is passed, all memory and cpu variables will be ignored.
 	InstanceTypeId string `json:"instance_type_id,omitempty"`
 
+	// InstanceTypeName is the name of the VM instance type.
+	// It is resolved to the ID of the instance type if InstanceTypeId is empty.
+	// +optional
+	InstanceTypeName string `json:"instance_type_name,omitempty"`
+
 	// CPU defines the VM CPU.
 	CPU *CPU `json:"cpu,omitempty"`
 
@@ -63,6 +90,11 @@ type OvirtMachineProviderSpec struct {
 	// OSDisk is the the root disk of the node.
 	OSDisk *Disk `json:"os_disk,omitempty"`
 
+	// AdditionalDisks defines the data disks which are created and attached to the VM
+	// in addition to the disks of the template.
+	// +optional
+	AdditionalDisks []AdditionalDisk `json:"additional_disks,omitempty"`
+
 	// VMType defines the workload type the instance will
 	// be used for and this effects the instance parameters.
 	// One of "desktop, server, high_performance"
@@ -80,6 +112,7 @@ type OvirtMachineProviderSpec struct {
 	// AutoPinningPolicy defines the policy to automatically set the CPU
 	// and NUMA including pinning to the host for the instance.
 	// One of "none, resize_and_pin"
+	// +kubebuilder:validation:Enum="";none;resize_and_pin
 	AutoPinningPolicy string `json:"auto_pinning_policy,omitempty"`
 
 	// Hugepages is the size of a VM's hugepages to use in KiBs.
@@ -116,6 +149,24 @@ type OvirtMachineProviderSpec struct {
 	//
 	// +optional
 	StorageDomainId string `json:"storage_domain_id,omitempty"`
+
+	// StorageDomainName is the name of the VM disk Storage Domain.
+	// It is resolved to the ID of the storage domain if StorageDomainId is empty.
+	// +optional
+	StorageDomainName string `json:"storage_domain_name,omitempty"`
+
+	// ShutdownGracePeriodSeconds is the time the guest OS is given to shut down gracefully when the
+	// machine is deleted, before the VM is forcibly powered off. 0 powers the VM off immediately.
+	// Defaults to the grace period configured on the controller.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	ShutdownGracePeriodSeconds *int32 `json:"shutdown_grace_period_seconds,omitempty"`
+
+	// DiskRetention defines the retention policies of the additional disks of the VM when the machine is
+	// deleted. Disks are identified by their position in AdditionalDisks, so the policies apply to all
+	// machines of a MachineSet. Disks without a retention policy are deleted with the VM.
+	// +optional
+	DiskRetention []DiskRetention `json:"disk_retention,omitempty"`
 }
 
 // CPU defines the VM cpu, made of (Sockets * Cores * Threads)
@@ -138,10 +189,135 @@ type Disk struct {
 	SizeGB int64 `json:"size_gb"`
 }
 
+// AdditionalDisk defines a data disk which is created and attached to the VM. Additional disks are never bootable.
+type AdditionalDisk struct {
+	// Alias is the alias of the disk.
+	// Defaults to "<machine name>-disk<N>", where N is the 1-based position in the AdditionalDisks list.
+	// +optional
+	Alias string `json:"alias,omitempty"`
+
+	// SizeGB is the size of the disk in GiB.
+	SizeGB int64 `json:"size_gb"`
+
+	// StorageDomainId is the ID of the storage domain the disk is created in.
+	// Defaults to the StorageDomainId of the provider spec.
+	// +optional
+	StorageDomainId string `json:"storage_domain_id,omitempty"`
+
+	// Format is the disk format. Can be "cow" or "raw". Defaults to "cow".
+	// +kubebuilder:validation:Enum="";raw;cow
+	// +optional
+	Format string `json:"format,omitempty"`
+
+	// Sparse indicates if the disk is thin provisioned. Defaults to true.
+	// +optional
+	Sparse *bool `json:"sparse,omitempty"`
+
+	// Interface is the interface the disk is attached with. Can be "virtio" or "virtio_scsi".
+	// Defaults to "virtio_scsi".
+	// +kubebuilder:validation:Enum="";virtio;virtio_scsi
+	// +optional
+	Interface string `json:"interface,omitempty"`
+}
+
+// TemplateVersionLatest is the TemplateVersion which selects the newest version of a template.
+const TemplateVersionLatest = "latest"
+
+// DiskRetentionPolicy defines what happens with a disk of the VM when the machine is deleted.
+// +kubebuilder:validation:Enum=Delete;Detach;Copy
+type DiskRetentionPolicy string
+
+const (
+	// DiskRetentionPolicyDelete deletes the disk together with the VM.
+	DiskRetentionPolicyDelete DiskRetentionPolicy = "Delete"
+	// DiskRetentionPolicyDetach detaches the disk from the VM and keeps it in its storage domain.
+	DiskRetentionPolicyDetach DiskRetentionPolicy = "Detach"
+	// DiskRetentionPolicyCopy makes a full copy of the disk in its storage domain before the disk is
+	// deleted together with the VM. The copy is a regular disk named "<machine>-<disk alias>-copy", it
+	// takes as much storage as the disk, and the deletion of the machine waits until the copy is complete.
+	DiskRetentionPolicyCopy DiskRetentionPolicy = "Copy"
+)
+
+// DiskRetention defines the retention policy of a single disk of the VM.
+type DiskRetention struct {
+	// AdditionalDisk is the 1-based position in the AdditionalDisks list of the disk the policy applies to.
+	// +kubebuilder:validation:Minimum=1
+	AdditionalDisk int32 `json:"additional_disk"`
+
+	// Policy is the retention policy of the disk.
+	// One of "Delete, Detach, Copy". Copy keeps a full copy of the disk, which takes as much storage
+	// as the disk and delays the deletion of the machine until the copy is complete.
+	Policy DiskRetentionPolicy `json:"policy"`
+}
+
 // NetworkInterface defines a VM network interface
 type NetworkInterface struct {
-	// VNICProfileID the id of the vNic profile
-	VNICProfileID string `json:"vnic_profile_id"`
+	// Name is the name of the network interface.
+	// Defaults to "nic<N>", where N is the 1-based position in the NetworkInterfaces list.
+	// +optional
+	Name string `json:"name,omitempty"`
+
+	// VNICProfileID the id of the vNic profile.
+	// Either VNICProfileID or NetworkName has to be set.
+	// +optional
+	VNICProfileID string `json:"vnic_profile_id,omitempty"`
+
+	// NetworkName is the name of the logical network of the vNic profile. It is used to look up
+	// the vNic profile in the datacenter of the oVirt cluster if VNICProfileID is empty.
+	// +optional
+	NetworkName string `json:"network_name,omitempty"`
+
+	// ProfileName is the name of the vNic profile of the network. Defaults to NetworkName,
+	// which is the name of the default vNic profile of a network.
+	// +optional
+	ProfileName string `json:"profile_name,omitempty"`
+
+	// DatacenterName is the name of the datacenter of the network. If set, it has to be
+	// the datacenter of the oVirt cluster.
+	// +optional
+	DatacenterName string `json:"datacenter_name,omitempty"`
+
+	// MAC is the fixed MAC address of the network interface.
+	// If empty, the MAC address is assigned from the MAC pool of the oVirt cluster.
+	// +optional
+	MAC string `json:"mac,omitempty"`
+
+	// Interface is the model of the network interface.
+	// One of "virtio, e1000, rtl8139, pci_passthrough". Defaults to "virtio".
+	// pci_passthrough requires a vNic profile with passthrough enabled (SR-IOV).
+	// +kubebuilder:validation:Enum="";virtio;e1000;rtl8139;pci_passthrough
+	// +optional
+	Interface string `json:"interface,omitempty"`
+
+	// StaticIP is the static IP configuration of the network interface. It is injected into the
+	// ignition of the VM for networks without DHCP. If nil, the guest configures the interface.
+	// +optional
+	StaticIP *StaticIPConfig `json:"static_ip,omitempty"`
+}
+
+// StaticIPConfig defines the static IP configuration of a network interface.
+type StaticIPConfig struct {
+	// IPv4 is the static IPv4 configuration. If nil, IPv4 is disabled on the interface.
+	// +optional
+	IPv4 *IPConfig `json:"ipv4,omitempty"`
+
+	// IPv6 is the static IPv6 configuration. If nil, IPv6 is left to the guest.
+	// +optional
+	IPv6 *IPConfig `json:"ipv6,omitempty"`
+
+	// DNS is the list of IPv4 and IPv6 addresses of the name servers.
+	// +optional
+	DNS []string `json:"dns,omitempty"`
+}
+
+// IPConfig defines a static IP address of a network interface.
+type IPConfig struct {
+	// Address is the IP address in CIDR notation, e.g. 192.168.1.10/24.
+	Address string `json:"address"`
+
+	// Gateway is the IP address of the default gateway.
+	// +optional
+	Gateway string `json:"gateway,omitempty"`
 }
 
 // +genclient
@@ -185,8 +361,86 @@ type OvirtMachineProviderStatus struct {
 	// InstanceState is the provisioning state of the oVirt Instance.
 	// +optional
 	InstanceState *string `json:"instanceState,omitempty"`
+
+	// PendingNextRunChanges lists the provider spec changes (e.g. "memory", "cpu") which
+	// could not be applied to the running VM and were written to its next run configuration.
+	// They take effect after the VM has been rebooted.
+	// +optional
+	PendingNextRunChanges []string `json:"pendingNextRunChanges,omitempty"`
+
+	// Conditions describe the outcome of the individual steps of creating and reconciling the VM.
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+
+	// HostID is the ID of the oVirt host the VM was last observed running on.
+	// +optional
+	HostID *string `json:"hostId,omitempty"`
+
+	// ClusterID is the ID of the oVirt cluster the VM was last observed in.
+	// +optional
+	ClusterID *string `json:"clusterId,omitempty"`
+
+	// StorageDomainID is the ID of the storage domain the OS disk of the VM is located on.
+	// +optional
+	StorageDomainID *string `json:"storageDomainId,omitempty"`
+
+	// InstanceTypeID is the ID of the instance type of the VM.
+	// +optional
+	InstanceTypeID *string `json:"instanceTypeId,omitempty"`
+
+	// LastEngineError is the last error which occurred while creating or reconciling the VM.
+	// +optional
+	LastEngineError *string `json:"lastEngineError,omitempty"`
 }
 
+// Condition types reported in the OvirtMachineProviderStatus.
+const (
+	// PreflightPassedCondition reports if the provider spec passed the checks against the engine
+	// before the VM was created.
+	PreflightPassedCondition = "PreflightPassed"
+	// TemplateResolvedCondition reports if the template of the provider spec was found.
+	TemplateResolvedCondition = "TemplateResolved"
+	// VMCreatedCondition reports if the VM was created from the template.
+	VMCreatedCondition = "VMCreated"
+	// DiskResizedCondition reports if the OS disk was extended to the requested size.
+	DiskResizedCondition = "DiskResized"
+	// ResourcesUpdatedCondition reports if the CPU and memory changes of the provider spec were sent to
+	// the VM or its next run configuration.
+	ResourcesUpdatedCondition = "ResourcesUpdated"
+	// AdditionalDisksAttachedCondition reports if the additional disks of the provider spec were created and attached.
+	AdditionalDisksAttachedCondition = "AdditionalDisksAttached"
+	// NICsAttachedCondition reports if the network interfaces of the provider spec were attached.
+	NICsAttachedCondition = "NICsAttached"
+	// NetworkConfiguredCondition reports if the static IP configuration of the network interfaces was
+	// injected into the ignition of the VM.
+	NetworkConfiguredCondition = "NetworkConfigured"
+	// TagAssignedCondition reports if the cluster tag was added to the VM.
+	TagAssignedCondition = "TagAssigned"
+	// AffinityAppliedCondition reports if auto pinning and the affinity groups were applied to the VM.
+	AffinityAppliedCondition = "AffinityApplied"
+	// VMStartedCondition reports if the VM was started and reached the Up status.
+	VMStartedCondition = "VMStarted"
+	// AddressAssignedCondition reports if a usable IP address was found for the VM.
+	AddressAssignedCondition = "AddressAssigned"
+	// OwnershipVerifiedCondition reports if the VM was verified to belong to the cluster before it was deleted.
+	OwnershipVerifiedCondition = "OwnershipVerified"
+)
+
+// Condition reasons reported in the OvirtMachineProviderStatus.
+const (
+	// ConditionReasonSucceeded is used when the step completed successfully.
+	ConditionReasonSucceeded = "Succeeded"
+	// ConditionReasonFailed is used when the step failed, the message contains the error.
+	ConditionReasonFailed = "Failed"
+	// ConditionReasonNotRequested is used when the provider spec doesn't request the step.
+	ConditionReasonNotRequested = "NotRequested"
+	// ConditionReasonInvalidConfiguration is used when the provider spec doesn't match the engine,
+	// the message lists the problems.
+	ConditionReasonInvalidConfiguration = "InvalidConfiguration"
+	// ConditionReasonNotOwned is used when the VM doesn't belong to the cluster and is left untouched.
+	ConditionReasonNotOwned = "NotOwned"
+)
+
 func init() {
 	SchemeBuilder.Register(&OvirtMachineProviderSpec{})
 	SchemeBuilder.Register(&OvirtMachineProviderStatus{})
@@ -12,9 +12,30 @@ package v1beta1
 
 import (
 	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AdditionalDisk) DeepCopyInto(out *AdditionalDisk) {
+	*out = *in
+	if in.Sparse != nil {
+		in, out := &in.Sparse, &out.Sparse
+		*out = new(bool)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AdditionalDisk.
+func (in *AdditionalDisk) DeepCopy() *AdditionalDisk {
+	if in == nil {
+		return nil
+	}
+	out := new(AdditionalDisk)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *CPU) DeepCopyInto(out *CPU) {
 	*out = *in
@@ -45,9 +66,44 @@ func (in *Disk) DeepCopy() *Disk {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DiskRetention) DeepCopyInto(out *DiskRetention) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DiskRetention.
+func (in *DiskRetention) DeepCopy() *DiskRetention {
+	if in == nil {
+		return nil
+	}
+	out := new(DiskRetention)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *IPConfig) DeepCopyInto(out *IPConfig) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IPConfig.
+func (in *IPConfig) DeepCopy() *IPConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(IPConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *NetworkInterface) DeepCopyInto(out *NetworkInterface) {
 	*out = *in
+	if in.StaticIP != nil {
+		in, out := &in.StaticIP, &out.StaticIP
+		*out = new(StaticIPConfig)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NetworkInterface.
@@ -145,6 +201,13 @@ func (in *OvirtMachineProviderSpec) DeepCopyInto(out *OvirtMachineProviderSpec)
 		*out = new(Disk)
 		**out = **in
 	}
+	if in.AdditionalDisks != nil {
+		in, out := &in.AdditionalDisks, &out.AdditionalDisks
+		*out = make([]AdditionalDisk, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 	if in.NetworkInterfaces != nil {
 		in, out := &in.NetworkInterfaces, &out.NetworkInterfaces
 		*out = make([]*NetworkInterface, len(*in))
@@ -152,7 +215,7 @@ func (in *OvirtMachineProviderSpec) DeepCopyInto(out *OvirtMachineProviderSpec)
 			if (*in)[i] != nil {
 				in, out := &(*in)[i], &(*out)[i]
 				*out = new(NetworkInterface)
-				**out = **in
+				(*in).DeepCopyInto(*out)
 			}
 		}
 	}
@@ -171,6 +234,16 @@ func (in *OvirtMachineProviderSpec) DeepCopyInto(out *OvirtMachineProviderSpec)
 		*out = new(bool)
 		**out = **in
 	}
+	if in.ShutdownGracePeriodSeconds != nil {
+		in, out := &in.ShutdownGracePeriodSeconds, &out.ShutdownGracePeriodSeconds
+		*out = new(int32)
+		**out = **in
+	}
+	if in.DiskRetention != nil {
+		in, out := &in.DiskRetention, &out.DiskRetention
+		*out = make([]DiskRetention, len(*in))
+		copy(*out, *in)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new OvirtMachineProviderSpec.
@@ -206,6 +279,43 @@ func (in *OvirtMachineProviderStatus) DeepCopyInto(out *OvirtMachineProviderStat
 		*out = new(string)
 		**out = **in
 	}
+	if in.PendingNextRunChanges != nil {
+		in, out := &in.PendingNextRunChanges, &out.PendingNextRunChanges
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]metav1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.HostID != nil {
+		in, out := &in.HostID, &out.HostID
+		*out = new(string)
+		**out = **in
+	}
+	if in.ClusterID != nil {
+		in, out := &in.ClusterID, &out.ClusterID
+		*out = new(string)
+		**out = **in
+	}
+	if in.StorageDomainID != nil {
+		in, out := &in.StorageDomainID, &out.StorageDomainID
+		*out = new(string)
+		**out = **in
+	}
+	if in.InstanceTypeID != nil {
+		in, out := &in.InstanceTypeID, &out.InstanceTypeID
+		*out = new(string)
+		**out = **in
+	}
+	if in.LastEngineError != nil {
+		in, out := &in.LastEngineError, &out.LastEngineError
+		*out = new(string)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new OvirtMachineProviderStatus.
@@ -225,3 +335,33 @@ func (in *OvirtMachineProviderStatus) DeepCopyObject() runtime.Object {
 	}
 	return nil
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *StaticIPConfig) DeepCopyInto(out *StaticIPConfig) {
+	*out = *in
+	if in.IPv4 != nil {
+		in, out := &in.IPv4, &out.IPv4
+		*out = new(IPConfig)
+		**out = **in
+	}
+	if in.IPv6 != nil {
+		in, out := &in.IPv6, &out.IPv6
+		*out = new(IPConfig)
+		**out = **in
+	}
+	if in.DNS != nil {
+		in, out := &in.DNS, &out.DNS
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new StaticIPConfig.
+func (in *StaticIPConfig) DeepCopy() *StaticIPConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(StaticIPConfig)
+	in.DeepCopyInto(out)
+	return out
+}
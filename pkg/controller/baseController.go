@@ -1,10 +1,19 @@
 package controller
 
 import (
+	"context"
+	"fmt"
 	"time"
 
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	ovirtconfigv1 "github.com/openshift/cluster-api-provider-ovirt/pkg/apis/ovirtprovider/v1beta1"
 	"github.com/openshift/cluster-api-provider-ovirt/pkg/ovirt"
+	"github.com/openshift/cluster-api-provider-ovirt/pkg/utils"
 	ovirtclient "github.com/ovirt/go-ovirt-client/v2"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/cache"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 )
@@ -15,15 +24,21 @@ type baseController struct {
 
 	Client            client.Client
 	CachedOVirtClient ovirt.CachedOVirtClient
+	ClientPool        ovirt.ClientPool
 }
 
-func NewBaseController(ctrlName string, k8sClient client.Client, cachedOVirtClient ovirt.CachedOVirtClient) baseController {
+func NewBaseController(
+	ctrlName string,
+	k8sClient client.Client,
+	cachedOVirtClient ovirt.CachedOVirtClient,
+	clientPool ovirt.ClientPool) baseController {
 	return baseController{
 		Name: ctrlName,
 		Log:  ovirt.NewKLogr("controllers", ctrlName).WithVInfo(0),
 
 		Client:            k8sClient,
 		CachedOVirtClient: cachedOVirtClient,
+		ClientPool:        clientPool,
 	}
 }
 
@@ -32,6 +47,56 @@ func (b *baseController) GetoVirtClient() (ovirtclient.Client, error) {
 	return b.CachedOVirtClient.Get()
 }
 
+// GetoVirtClientForNode returns a client to the API endpoint of the oVirt engine the node runs on.
+// Nodes of machines with a CredentialsSecret in their provider spec run on the engine of the secret,
+// all other nodes run on the engine of the default credentials.
+func (b *baseController) GetoVirtClientForNode(ctx context.Context, node *corev1.Node) (ovirtclient.Client, error) {
+	machine, err := b.machineOfNode(ctx, node)
+	if err != nil {
+		return nil, err
+	}
+	if machine == nil || machine.Spec.ProviderSpec.Value == nil {
+		return b.GetoVirtClient()
+	}
+	providerSpec, err := ovirtconfigv1.ProviderSpecFromRawExtension(machine.Spec.ProviderSpec.Value)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read provider spec of machine %s: %w", machine.Name, err)
+	}
+	if providerSpec.CredentialsSecret == nil || providerSpec.CredentialsSecret.Name == "" {
+		return b.GetoVirtClient()
+	}
+	if b.ClientPool == nil {
+		return nil, fmt.Errorf("credentials secret %s is set, but no client pool is configured",
+			providerSpec.CredentialsSecret.Name)
+	}
+	return b.ClientPool.Get(ctx, types.NamespacedName{
+		Namespace: machine.Namespace,
+		Name:      providerSpec.CredentialsSecret.Name,
+	})
+}
+
+// machineOfNode returns the machine referenced by the node annotation.
+// Nil is returned if the node isn't linked to a machine or the machine doesn't exist.
+func (b *baseController) machineOfNode(ctx context.Context, node *corev1.Node) (*machinev1.Machine, error) {
+	machineKey, ok := node.Annotations[utils.MachineAnnotationKey]
+	if !ok {
+		return nil, nil
+	}
+	namespace, name, err := cache.SplitMetaNamespaceKey(machineKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid machine annotation %s on node %s: %w", machineKey, node.Name, err)
+	}
+
+	machine := machinev1.Machine{}
+	if err := b.Client.Get(ctx, client.ObjectKey{Namespace: namespace, Name: name}, &machine); err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed getting machine %s of node %s: %w", machineKey, node.Name, err)
+	}
+	return &machine, nil
+}
+
 const requeueDefaultTime = 30 * time.Second
 
 func ResultRequeueAfter(sec int) reconcile.Result {
@@ -3,7 +3,6 @@ package controller
 import (
 	"context"
 	"fmt"
-	"strings"
 
 	"github.com/openshift/cluster-api-provider-ovirt/pkg/ovirt"
 	"github.com/openshift/cluster-api-provider-ovirt/pkg/utils"
@@ -30,9 +29,12 @@ type nodeController struct {
 }
 
 // Creates a new Node Controller.
-func NewNodeController(k8sClient client.Client, cachedOVirtClient ovirt.CachedOVirtClient) *nodeController {
+func NewNodeController(
+	k8sClient client.Client,
+	cachedOVirtClient ovirt.CachedOVirtClient,
+	clientPool ovirt.ClientPool) *nodeController {
 	return &nodeController{
-		baseController: NewBaseController("NodeController", k8sClient, cachedOVirtClient),
+		baseController: NewBaseController("NodeController", k8sClient, cachedOVirtClient, clientPool),
 	}
 }
 
@@ -70,17 +72,18 @@ func (r *nodeController) Reconcile(ctx context.Context, request reconcile.Reques
 		return ResultRequeueDefault(), errors.Wrap(err, "error getting node requeue")
 	}
 	// Check if the node has a ovirt ProviderID set, if not then ignore it
-	if !strings.Contains(node.Spec.ProviderID, utils.ProviderIDPrefix) {
+	if utils.VMIDFromProviderID(node.Spec.ProviderID) == "" {
 		return ResultNoRequeue(), nil
 	}
-	ovirtClient, err := r.GetoVirtClient()
+	// the node is only deleted if its VM is missing on the engine it runs on
+	ovirtClient, err := r.GetoVirtClientForNode(ctx, &node)
 	if err != nil {
 		msg := "error getting connection to oVirt, requeuing"
 		r.Log.Errorf(msg+": %v", err)
 		return ResultRequeueDefault(), errors.Wrap(err, msg)
 	}
 
-	vm, err := ovirtClient.GetVMByName(node.Name)
+	vm, err := ovirtClient.GetVM(ovirtC.VMID(utils.VMIDFromProviderID(node.Spec.ProviderID)), ovirtC.ContextStrategy(ctx))
 	if err != nil {
 		if ovirtC.HasErrorCode(err, ovirtC.ENotFound) {
 			r.Log.Infof("Deleting Node %s from cluster since it has been removed from the oVirt engine", node.Name)
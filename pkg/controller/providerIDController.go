@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 
+	machinev1 "github.com/openshift/api/machine/v1beta1"
 	"github.com/openshift/cluster-api-provider-ovirt/pkg/ovirt"
 	"github.com/openshift/cluster-api-provider-ovirt/pkg/utils"
 	ovirtC "github.com/ovirt/go-ovirt-client/v2"
@@ -25,9 +26,12 @@ type providerIDController struct {
 }
 
 // Creates a new ProviderID Controller.
-func NewProviderIDController(k8sClient client.Client, cachedOVirtClient ovirt.CachedOVirtClient) *providerIDController {
+func NewProviderIDController(
+	k8sClient client.Client,
+	cachedOVirtClient ovirt.CachedOVirtClient,
+	clientPool ovirt.ClientPool) *providerIDController {
 	return &providerIDController{
-		baseController: NewBaseController("ProviderIDController", k8sClient, cachedOVirtClient),
+		baseController: NewBaseController("ProviderIDController", k8sClient, cachedOVirtClient, clientPool),
 	}
 }
 
@@ -66,7 +70,7 @@ func (r *providerIDController) Reconcile(ctx context.Context, request reconcile.
 	}
 	if node.Spec.ProviderID == "" {
 		r.Log.Infof("spec.ProviderID for Node %s is empty, fetching from ovirt", node.Name)
-		id, err := r.fetchOvirtVmID(node.Name)
+		id, err := r.fetchOvirtVmID(ctx, &node)
 		if err != nil {
 			errMsg := fmt.Errorf("failed getting VM %s from oVirt requeue: %w", node.Name, err)
 			r.Log.Errorf(errMsg.Error())
@@ -85,21 +89,76 @@ func (r *providerIDController) Reconcile(ctx context.Context, request reconcile.
 	return ResultNoRequeue(), nil
 }
 
-// fetchOvirtVmID returns the id of the oVirt VM which correlates to the node
-func (r *providerIDController) fetchOvirtVmID(nodeName string) (string, error) {
-	ovirtclient, err := r.GetoVirtClient()
+// fetchOvirtVmID returns the id of the oVirt VM which correlates to the node.
+// The ID recorded on the machine backing the node is preferred, the VM is only looked up
+// by the node name if the machine is unknown or doesn't carry the ID yet. A VM found by name
+// has to belong to the cluster of the machine, otherwise an error is returned.
+func (r *providerIDController) fetchOvirtVmID(ctx context.Context, node *corev1.Node) (string, error) {
+	machine, err := r.machineOfNode(ctx, node)
+	if err != nil {
+		return "", err
+	}
+	if id := machineVmID(machine); id != "" {
+		return id, nil
+	}
+
+	ovirtclient, err := r.GetoVirtClientForNode(ctx, node)
 	if err != nil {
 		return "", errors.Wrap(err, "error getting connection to oVirt")
 	}
 
-	vm, err := ovirtclient.GetVMByName(nodeName)
+	vm, err := ovirtclient.GetVMByName(node.Name)
 	if err != nil {
 		if ovirtC.HasErrorCode(err, ovirtC.ENotFound) {
 			return "", nil
 		}
-		r.Log.Errorf("Error occurred while searching for VM '%s': %v", nodeName, err)
-		return "", fmt.Errorf("failed getting VM %s from oVirt: %w", nodeName, err)
+		r.Log.Errorf("Error occurred while searching for VM '%s': %v", node.Name, err)
+		return "", fmt.Errorf("failed getting VM %s from oVirt: %w", node.Name, err)
 	}
 
+	clusterID := ""
+	if machine != nil {
+		clusterID = machine.Labels[machinev1.MachineClusterIDLabel]
+	}
+	owned, err := isOwnedByCluster(ovirtclient, vm, clusterID)
+	if err != nil {
+		return "", err
+	}
+	if !owned {
+		return "", fmt.Errorf("VM %s (%s) has the name of node %s, but is not tagged with cluster tag %s",
+			vm.Name(), vm.ID(), node.Name, clusterID)
+	}
 	return string(vm.ID()), nil
 }
+
+// machineVmID returns the VM ID recorded on the machine.
+// An empty ID is returned if the node isn't linked to a machine or the machine doesn't have an ID yet.
+func machineVmID(machine *machinev1.Machine) string {
+	if machine == nil {
+		return ""
+	}
+	if machine.Spec.ProviderID != nil {
+		if id := utils.VMIDFromProviderID(*machine.Spec.ProviderID); id != "" {
+			return id
+		}
+	}
+	return machine.Annotations[utils.OvirtIDAnnotationKey]
+}
+
+// isOwnedByCluster returns true if the VM carries the ownership marker or is tagged with the cluster tag.
+// Nodes without the cluster ID, e.g. nodes without a machine, can't be verified and own the VM.
+func isOwnedByCluster(ovirtclient ovirtC.Client, vm ovirtC.VM, clusterID string) (bool, error) {
+	if clusterID == "" || utils.HasOwnershipMarker(vm.Comment(), clusterID) {
+		return true, nil
+	}
+	tags, err := ovirtclient.ListVMTags(vm.ID())
+	if err != nil {
+		return false, fmt.Errorf("failed to list tags of VM %s: %w", vm.ID(), err)
+	}
+	for _, tag := range tags {
+		if tag.Name() == clusterID {
+			return true, nil
+		}
+	}
+	return false, nil
+}
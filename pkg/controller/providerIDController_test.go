@@ -1 +1,77 @@
-package controller_test
+//go:build unit
+
+package controller
+
+import (
+	"testing"
+
+	"github.com/openshift/cluster-api-provider-ovirt/pkg/ovirt"
+	"github.com/openshift/cluster-api-provider-ovirt/pkg/utils"
+	ovirtclient "github.com/ovirt/go-ovirt-client/v2"
+)
+
+func TestIsOwnedByCluster(t *testing.T) {
+	testcases := []struct {
+		name          string
+		clusterID     string
+		comment       string
+		tagName       string
+		expectedOwned bool
+	}{
+		{
+			name:          "VM of node without cluster ID is owned",
+			clusterID:     "",
+			expectedOwned: true,
+		},
+		{
+			name:          "VM with ownership marker is owned",
+			clusterID:     "test-cluster",
+			comment:       utils.OwnershipMarker("test-cluster"),
+			expectedOwned: true,
+		},
+		{
+			name:          "VM with cluster tag is owned",
+			clusterID:     "test-cluster",
+			tagName:       "test-cluster",
+			expectedOwned: true,
+		},
+		{
+			name:          "VM of another cluster is not owned",
+			clusterID:     "test-cluster",
+			comment:       utils.OwnershipMarker("other-cluster"),
+			tagName:       "other-cluster",
+			expectedOwned: false,
+		},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.name, func(t *testing.T) {
+			helper, err := ovirtclient.NewMockTestHelper(ovirt.NewKLogr("go-ovirt-client"))
+			if err != nil {
+				t.Fatalf("Unexpected error occurred setting up test helper: %v", err)
+			}
+			client := helper.GetClient()
+			vm, err := client.CreateVM(helper.GetClusterID(), helper.GetBlankTemplateID(), "test-node",
+				ovirtclient.CreateVMParams().MustWithComment(testcase.comment))
+			if err != nil {
+				t.Fatalf("Unexpected error occurred creating VM: %v", err)
+			}
+			if testcase.tagName != "" {
+				if _, err := client.CreateTag(testcase.tagName, nil); err != nil {
+					t.Fatalf("Unexpected error occurred creating tag: %v", err)
+				}
+				if err := client.AddTagToVMByName(vm.ID(), testcase.tagName); err != nil {
+					t.Fatalf("Unexpected error occurred tagging VM: %v", err)
+				}
+			}
+
+			owned, err := isOwnedByCluster(client, vm, testcase.clusterID)
+			if err != nil {
+				t.Fatalf("Unexpected error occurred checking ownership: %v", err)
+			}
+			if owned != testcase.expectedOwned {
+				t.Errorf("Expected VM to be owned: %t, but got %t", testcase.expectedOwned, owned)
+			}
+		})
+	}
+}
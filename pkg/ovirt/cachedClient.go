@@ -1,15 +1,51 @@
 package ovirt
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"sync"
+	"time"
 
 	ovirtclient "github.com/ovirt/go-ovirt-client/v2"
 )
 
+// ClientState is the state of a cached client.
+type ClientState string
+
+const (
+	// ClientStateReady means the client is connected to the engine.
+	ClientStateReady ClientState = "Ready"
+	// ClientStateCredentialsMissing means no credentials are available, e.g. because the
+	// credentials secret doesn't exist or was deleted.
+	ClientStateCredentialsMissing ClientState = "CredentialsMissing"
+	// ClientStateCredentialsInvalid means the latest credentials were rejected, either because the
+	// secret can't be parsed or the engine refused them. The last known good client is still used.
+	ClientStateCredentialsInvalid ClientState = "CredentialsInvalid"
+	// ClientStateEngineUnreachable means the client can't connect to the engine.
+	ClientStateEngineUnreachable ClientState = "EngineUnreachable"
+)
+
+// clientStates are all states of a cached client.
+var clientStates = []ClientState{
+	ClientStateReady,
+	ClientStateCredentialsMissing,
+	ClientStateCredentialsInvalid,
+	ClientStateEngineUnreachable,
+}
+
 type CachedOVirtClient interface {
 	Get() (ovirtclient.Client, error)
 	WithCreateFunc(CreateOVirtClientFunc)
+	// State returns the state of the client together with the error which caused it.
+	State() (ClientState, error)
+	// StartHealthProbe tests the connection to the engine in the background every interval until the
+	// context is done, and rebuilds the client if the test fails. Get doesn't test the connection
+	// while the probe runs.
+	StartHealthProbe(ctx context.Context, interval time.Duration)
+	// WithThrottle rate limits the calls to the engine and stops calling an unreachable engine for a while.
+	// Throttled calls fail with an EngineThrottledError.
+	WithThrottle(ThrottleConfig)
 }
 
 type cachedOVirtClient struct {
@@ -18,60 +54,267 @@ type cachedOVirtClient struct {
 
 	credentials      *Credentials
 	client           ovirtclient.Client
-	updateLock       *sync.Mutex
+	updateLock       *sync.RWMutex
 	clientCreateFunc CreateOVirtClientFunc
+	throttle         *engineThrottle
+
+	// stopProbe stops the health probe, it is nil if no probe runs
+	stopProbe context.CancelFunc
+
+	state      ClientState
+	stateError error
 }
 
 func NewCachedOVirtClient(name string) *cachedOVirtClient {
-	return &cachedOVirtClient{
+	cachedClient := &cachedOVirtClient{
 		logger: NewKLogr("cached-client", name).WithVInfo(0),
 		name:   name,
 
 		credentials:      nil,
 		client:           nil,
-		updateLock:       &sync.Mutex{},
+		updateLock:       &sync.RWMutex{},
 		clientCreateFunc: nil,
 	}
+	cachedClient.setState(ClientStateCredentialsMissing, errCredentialsMissing)
+	return cachedClient
 }
 
+var errCredentialsMissing = errors.New("no oVirt credentials available")
+
 func (cachedClient *cachedOVirtClient) WithCreateFunc(createFunc CreateOVirtClientFunc) {
 	cachedClient.clientCreateFunc = createFunc
 }
 
+func (cachedClient *cachedOVirtClient) WithThrottle(config ThrottleConfig) {
+	cachedClient.throttle = newEngineThrottle(config)
+}
+
+func (cachedClient *cachedOVirtClient) State() (ClientState, error) {
+	cachedClient.updateLock.RLock()
+	defer cachedClient.updateLock.RUnlock()
+
+	return cachedClient.state, cachedClient.stateError
+}
+
+// setState sets the state and updates the client state gauge, the caller must hold the update lock.
+func (cachedClient *cachedOVirtClient) setState(state ClientState, err error) {
+	if cachedClient.state != state {
+		cachedClient.logger.Infof("oVirt client state changed from %q to %q", cachedClient.state, state)
+	}
+	cachedClient.state = state
+	cachedClient.stateError = err
+	for _, s := range clientStates {
+		value := 0.0
+		if s == state {
+			value = 1
+		}
+		clientStateGauge.WithLabelValues(cachedClient.name, string(s)).Set(value)
+	}
+}
+
+// SetCredentials replaces the credentials of the client. If the engine refuses the new credentials,
+// the last known good client and credentials are kept until valid credentials arrive.
+// The client is only rebuilt if the credentials or trusted CAs have changed.
 func (cachedClient *cachedOVirtClient) SetCredentials(newCredentials *Credentials) {
 	cachedClient.updateLock.Lock()
 	defer cachedClient.updateLock.Unlock()
 
+	if cachedClient.client != nil && cachedClient.credentials != nil && newCredentials != nil &&
+		*cachedClient.credentials == *newCredentials {
+		return
+	}
+
 	cachedClient.logger.Infof("Updating cached oVirt client credentials")
+	newClient, err := cachedClient.createClient(newCredentials)
+	if err != nil && isCredentialsError(err) && cachedClient.client != nil {
+		cachedClient.logger.Errorf("keeping the last known good oVirt client, the new credentials were refused: %v", err)
+		cachedClient.setState(ClientStateCredentialsInvalid, err)
+		return
+	}
 	cachedClient.credentials = newCredentials
-	cachedClient.buildClient()
+	cachedClient.client = newClient
+	if err == nil {
+		cachedClient.setState(ClientStateReady, nil)
+		return
+	}
+	cachedClient.setStateFromError(err)
 }
 
-func (cachedClient *cachedOVirtClient) buildClient() error {
+// RejectCredentials records that the credentials secret was updated with credentials which can't
+// be used. The last known good client and credentials are kept.
+func (cachedClient *cachedOVirtClient) RejectCredentials(err error) {
+	cachedClient.updateLock.Lock()
+	defer cachedClient.updateLock.Unlock()
+
+	cachedClient.logger.Errorf("Rejecting invalid oVirt credentials: %v", err)
+	cachedClient.setState(ClientStateCredentialsInvalid, err)
+}
+
+func (cachedClient *cachedOVirtClient) InvalidateCredentials() {
+	cachedClient.updateLock.Lock()
+	defer cachedClient.updateLock.Unlock()
+
+	cachedClient.logger.Infof("Invalidating cached oVirt client credentials")
+	cachedClient.credentials = nil
+	cachedClient.client = nil
+	cachedClient.setState(ClientStateCredentialsMissing, errCredentialsMissing)
+}
+
+func (cachedClient *cachedOVirtClient) createClient(credentials *Credentials) (ovirtclient.Client, error) {
 	if cachedClient.clientCreateFunc == nil {
 		cachedClient.clientCreateFunc = CreateNewOVirtClient
 	}
 
-	newClient, err := cachedClient.clientCreateFunc(cachedClient.credentials, NewKLogr("cached-client", cachedClient.name, "ovirt"))
+	newClient, err := cachedClient.clientCreateFunc(credentials, NewKLogr("cached-client", cachedClient.name, "ovirt"))
 	if err != nil {
-		cachedClient.client = nil // invalidate current client, will retrigger build
-		return fmt.Errorf("failed to create oVirt client: %v", err)
+		clientRebuilds.WithLabelValues(cachedClient.name, "failure").Inc()
+		return nil, fmt.Errorf("failed to create oVirt client: %w", err)
+	}
+	clientRebuilds.WithLabelValues(cachedClient.name, "success").Inc()
+	if cachedClient.throttle != nil {
+		return cachedClient.throttle.wrap(newClient), nil
+	}
+	return newClient, nil
+}
+
+func (cachedClient *cachedOVirtClient) buildClient() error {
+	newClient, err := cachedClient.createClient(cachedClient.credentials)
+	cachedClient.client = newClient // a failed build invalidates the current client, will retrigger build
+	cachedClient.setStateFromError(err)
+	return err
+}
+
+// setStateFromError sets the state after the client was built or tested. Rejected credentials stay
+// visible while the last known good client is used.
+func (cachedClient *cachedOVirtClient) setStateFromError(err error) {
+	switch {
+	case err == nil && cachedClient.state == ClientStateCredentialsInvalid:
+		return
+	case err == nil:
+		cachedClient.setState(ClientStateReady, nil)
+	case cachedClient.credentials == nil:
+		cachedClient.setState(ClientStateCredentialsMissing, errCredentialsMissing)
+	case isCredentialsError(err):
+		cachedClient.setState(ClientStateCredentialsInvalid, err)
+	default:
+		cachedClient.setState(ClientStateEngineUnreachable, err)
 	}
-	cachedClient.client = newClient
-	return nil
 }
 
 func (cachedClient *cachedOVirtClient) Get() (ovirtclient.Client, error) {
+	return cachedClient.get(func(client ovirtclient.Client) error {
+		return client.Test()
+	})
+}
+
+// getContext is Get, but the connection test, which logs in to the engine on first use, is bounded by
+// the context.
+func (cachedClient *cachedOVirtClient) getContext(ctx context.Context) (ovirtclient.Client, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get oVirt client: %w", err)
+	}
+	return cachedClient.get(func(client ovirtclient.Client) error {
+		return client.WithContext(ctx).Test()
+	})
+}
+
+// get returns the client, which is rebuilt if the connection test fails.
+func (cachedClient *cachedOVirtClient) get(test func(ovirtclient.Client) error) (ovirtclient.Client, error) {
+	// the health probe keeps the client working, so concurrent reconciles share it without a round-trip
+	cachedClient.updateLock.RLock()
+	client, probing := cachedClient.client, cachedClient.stopProbe != nil
+	cachedClient.updateLock.RUnlock()
+	if client != nil && probing {
+		return client, nil
+	}
+
 	cachedClient.updateLock.Lock()
 	defer cachedClient.updateLock.Unlock()
 
-	if cachedClient.client == nil || cachedClient.client.Test() != nil {
+	if cachedClient.credentials == nil {
+		return nil, errCredentialsMissing
+	}
+	if cachedClient.client == nil || (!probing && test(cachedClient.client) != nil) {
 		cachedClient.logger.Infof("Building new oVirt client...")
 		err := cachedClient.buildClient()
 		if err != nil {
 			return nil, err
 		}
+	} else {
+		cachedClient.setStateFromError(nil)
 	}
 
 	return cachedClient.client, nil
 }
+
+func (cachedClient *cachedOVirtClient) StartHealthProbe(ctx context.Context, interval time.Duration) {
+	cachedClient.updateLock.Lock()
+	defer cachedClient.updateLock.Unlock()
+
+	if cachedClient.stopProbe != nil {
+		return
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	cachedClient.stopProbe = cancel
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				cachedClient.probe()
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// probe tests the connection of the client and rebuilds it if the test fails. The connection is
+// tested without holding the lock, so Get isn't blocked by the round-trip.
+func (cachedClient *cachedOVirtClient) probe() {
+	cachedClient.updateLock.RLock()
+	client, credentials := cachedClient.client, cachedClient.credentials
+	cachedClient.updateLock.RUnlock()
+	if credentials == nil {
+		return
+	}
+
+	var err error
+	if client != nil {
+		err = client.Test()
+	}
+
+	cachedClient.updateLock.Lock()
+	defer cachedClient.updateLock.Unlock()
+
+	if cachedClient.client != client {
+		// the client was replaced while it was tested
+		return
+	}
+	if client != nil && err == nil {
+		cachedClient.setStateFromError(nil)
+		return
+	}
+	if err != nil {
+		cachedClient.logger.Infof("oVirt connection test failed, building new oVirt client: %v", err)
+	}
+	if err := cachedClient.buildClient(); err != nil {
+		cachedClient.logger.Errorf("failed to build oVirt client: %v", err)
+	}
+}
+
+// isCredentialsError returns true if the engine refused the credentials.
+func isCredentialsError(err error) bool {
+	var engineErr ovirtclient.EngineError
+	if !errors.As(err, &engineErr) {
+		return false
+	}
+	switch engineErr.Code() {
+	case ovirtclient.EAccessDenied, ovirtclient.EInvalidGrant, ovirtclient.EUserAccountLocked:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,154 @@
+//go:build unit
+
+package ovirt
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	ovirtclient "github.com/ovirt/go-ovirt-client/v2"
+)
+
+// engineError is an engine error with a fixed error code.
+type engineError struct {
+	code ovirtclient.ErrorCode
+}
+
+func (e engineError) Error() string                           { return string(e.code) }
+func (e engineError) Message() string                         { return string(e.code) }
+func (e engineError) String() string                          { return string(e.code) }
+func (e engineError) HasCode(code ovirtclient.ErrorCode) bool { return e.code == code }
+func (e engineError) Code() ovirtclient.ErrorCode             { return e.code }
+func (e engineError) Unwrap() error                           { return nil }
+func (e engineError) CanRecover() bool                        { return false }
+func (e engineError) CanAutoRetry() bool                      { return false }
+
+func TestCachedOVirtClientState(t *testing.T) {
+	helper, err := ovirtclient.NewMockTestHelper(NewKLogr("go-ovirt-client"))
+	if err != nil {
+		t.Fatalf("Unexpected error occurred setting up test helper: %v", err)
+	}
+	mockClient := helper.GetClient()
+
+	var createErr error
+	builds := 0
+	cachedClient := NewCachedOVirtClient("test")
+	cachedClient.WithCreateFunc(func(creds *Credentials, logger *KLogr) (ovirtclient.Client, error) {
+		builds++
+		if createErr != nil {
+			return nil, createErr
+		}
+		return mockClient, nil
+	})
+
+	expectState := func(expected ClientState) {
+		t.Helper()
+		if state, err := cachedClient.State(); state != expected {
+			t.Errorf("Expected state %s, but got %s: %v", expected, state, err)
+		}
+	}
+
+	expectState(ClientStateCredentialsMissing)
+	if _, err := cachedClient.Get(); err == nil {
+		t.Errorf("Expected error getting client without credentials, but got none")
+	}
+
+	cachedClient.SetCredentials(&Credentials{URL: "https://engine/ovirt-engine/api"})
+	expectState(ClientStateReady)
+
+	cachedClient.SetCredentials(&Credentials{URL: "https://engine/ovirt-engine/api"})
+	if builds != 1 {
+		t.Errorf("Expected the client not to be rebuilt for unchanged credentials, but got %d builds", builds)
+	}
+
+	createErr = engineError{code: ovirtclient.EAccessDenied}
+	cachedClient.SetCredentials(&Credentials{URL: "https://engine/ovirt-engine/api", TrustedCABundle: "new CA"})
+	expectState(ClientStateCredentialsInvalid)
+	if client, err := cachedClient.Get(); err != nil || client != mockClient {
+		t.Errorf("Expected the last known good client after the credentials were refused, but got %v", err)
+	}
+	expectState(ClientStateCredentialsInvalid)
+
+	cachedClient.RejectCredentials(errors.New("unparsable secret"))
+	expectState(ClientStateCredentialsInvalid)
+
+	createErr = nil
+	cachedClient.SetCredentials(&Credentials{URL: "https://engine/ovirt-engine/api", Password: "rotated"})
+	expectState(ClientStateReady)
+
+	createErr = engineError{code: ovirtclient.EConnection}
+	cachedClient.SetCredentials(&Credentials{URL: "https://other-engine/ovirt-engine/api"})
+	expectState(ClientStateEngineUnreachable)
+	if _, err := cachedClient.Get(); err == nil {
+		t.Errorf("Expected error getting client of unreachable engine, but got none")
+	}
+
+	cachedClient.InvalidateCredentials()
+	expectState(ClientStateCredentialsMissing)
+	if _, err := cachedClient.Get(); err == nil {
+		t.Errorf("Expected error getting client after the credentials were invalidated, but got none")
+	}
+}
+
+// testCountingClient counts the connection tests and fails them with testErr.
+type testCountingClient struct {
+	ovirtclient.Client
+	tests   int
+	testErr error
+}
+
+func (c *testCountingClient) Test(_ ...ovirtclient.RetryStrategy) error {
+	c.tests++
+	return c.testErr
+}
+
+func TestCachedOVirtClientHealthProbe(t *testing.T) {
+	helper, err := ovirtclient.NewMockTestHelper(NewKLogr("go-ovirt-client"))
+	if err != nil {
+		t.Fatalf("Unexpected error occurred setting up test helper: %v", err)
+	}
+
+	var clients []*testCountingClient
+	cachedClient := NewCachedOVirtClient("test")
+	cachedClient.WithCreateFunc(func(creds *Credentials, logger *KLogr) (ovirtclient.Client, error) {
+		client := &testCountingClient{Client: helper.GetClient()}
+		clients = append(clients, client)
+		return client, nil
+	})
+	cachedClient.SetCredentials(&Credentials{URL: "https://engine/ovirt-engine/api"})
+
+	if _, err := cachedClient.Get(); err != nil {
+		t.Fatalf("Unexpected error occurred getting client: %v", err)
+	}
+	if clients[0].tests != 1 {
+		t.Errorf("Expected Get to test the connection without health probe, but got %d tests", clients[0].tests)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	cachedClient.StartHealthProbe(ctx, time.Hour)
+	for i := 0; i < 3; i++ {
+		if _, err := cachedClient.Get(); err != nil {
+			t.Fatalf("Unexpected error occurred getting client: %v", err)
+		}
+	}
+	if clients[0].tests != 1 {
+		t.Errorf("Expected Get not to test the connection while probing, but got %d tests", clients[0].tests)
+	}
+
+	cachedClient.probe()
+	if len(clients) != 1 {
+		t.Errorf("Expected the client to be kept after a successful probe, but it was built %d times", len(clients))
+	}
+
+	clients[0].testErr = engineError{code: ovirtclient.EConnection}
+	cachedClient.probe()
+	if len(clients) != 2 {
+		t.Fatalf("Expected the client to be rebuilt after a failed probe, but it was built %d times", len(clients))
+	}
+	if client, err := cachedClient.Get(); err != nil || client != clients[1] {
+		t.Errorf("Expected Get to return the rebuilt client, but got %v", err)
+	}
+}
@@ -1,6 +1,7 @@
 package ovirt
 
 import (
+	"crypto/tls"
 	"fmt"
 
 	ovirtclient "github.com/ovirt/go-ovirt-client/v2"
@@ -13,26 +14,51 @@ var CreateNewOVirtClient = func(creds *Credentials, logger *KLogr) (ovirtclient.
 		return nil, fmt.Errorf("credentials are emtpy")
 	}
 
-	tls := ovirtclient.TLS()
+	tlsProvider := ovirtclient.TLS()
 	if creds.Insecure {
-		tls.Insecure()
+		tlsProvider.Insecure()
 	} else {
-		if creds.CAFile != "" {
-			tls.CACertsFromFile(creds.CAFile)
-		}
 		if creds.CABundle != "" {
-			tls.CACertsFromMemory([]byte(creds.CABundle))
+			tlsProvider.CACertsFromMemory([]byte(creds.CABundle))
+		}
+		if creds.TrustedCABundle != "" {
+			tlsProvider.CACertsFromMemory([]byte(creds.TrustedCABundle))
+		}
+		tlsProvider.CACertsFromSystem()
+	}
+
+	var provider ovirtclient.TLSProvider = tlsProvider
+	if creds.ClientCert != "" {
+		certificate, err := tls.X509KeyPair([]byte(creds.ClientCert), []byte(creds.ClientKey))
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
 		}
-		tls.CACertsFromSystem()
+		provider = clientCertTLSProvider{TLSProvider: tlsProvider, certificate: certificate}
 	}
 
 	return ovirtclient.NewWithVerify(
 		creds.URL,
 		creds.Username,
 		creds.Password,
-		tls,
+		provider,
 		logger,
 		nil,
 		nil, // no verify, will be done when getting cached client
 	)
 }
+
+// clientCertTLSProvider adds a client certificate to the TLS configuration of the wrapped provider,
+// so the engine can require mutual TLS.
+type clientCertTLSProvider struct {
+	ovirtclient.TLSProvider
+	certificate tls.Certificate
+}
+
+func (p clientCertTLSProvider) CreateTLSConfig() (*tls.Config, error) {
+	tlsConfig, err := p.TLSProvider.CreateTLSConfig()
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig.Certificates = append(tlsConfig.Certificates, p.certificate)
+	return tlsConfig, nil
+}
@@ -0,0 +1,105 @@
+package ovirt
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	ovirtclient "github.com/ovirt/go-ovirt-client/v2"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// ClientPool provides clients for the oVirt engines of the credentials secrets referenced by
+// the provider specs, so machines can be placed on different engines.
+type ClientPool interface {
+	// Get returns the client for the engine of the credentials secret.
+	Get(ctx context.Context, secret types.NamespacedName) (ovirtclient.Client, error)
+	WithCreateFunc(CreateOVirtClientFunc)
+	// WithHealthProbe probes the connections of the pooled clients every interval until the context is done.
+	WithHealthProbe(ctx context.Context, interval time.Duration) ClientPool
+	// WithThrottle rate limits the calls of each pooled client to its engine.
+	WithThrottle(ThrottleConfig) ClientPool
+}
+
+type clientPool struct {
+	logger *KLogr
+
+	service          ClientService
+	clients          map[types.NamespacedName]*cachedOVirtClient
+	lock             *sync.Mutex
+	clientCreateFunc CreateOVirtClientFunc
+
+	probeCtx      context.Context
+	probeInterval time.Duration
+	throttle      *ThrottleConfig
+}
+
+// NewClientPool creates a pool whose clients are kept up to date by the client service. The
+// credentials of a secret are only available if the service watches it, either as the default
+// secret or because it matches the label selector of the service. The secrets aren't read from
+// the API server on Get, the pooled clients receive the changes from the informers of the service.
+func NewClientPool(service ClientService) *clientPool {
+	return &clientPool{
+		logger: NewKLogr("client-pool").WithVInfo(0),
+
+		service:          service,
+		clients:          map[types.NamespacedName]*cachedOVirtClient{},
+		lock:             &sync.Mutex{},
+		clientCreateFunc: nil,
+	}
+}
+
+func (pool *clientPool) WithCreateFunc(createFunc CreateOVirtClientFunc) {
+	pool.clientCreateFunc = createFunc
+}
+
+func (pool *clientPool) WithHealthProbe(ctx context.Context, interval time.Duration) ClientPool {
+	pool.probeCtx = ctx
+	pool.probeInterval = interval
+	return pool
+}
+
+func (pool *clientPool) WithThrottle(config ThrottleConfig) ClientPool {
+	pool.throttle = &config
+	return pool
+}
+
+// Get returns the client of the secret. The context bounds the connection test of the client, which
+// logs in to the engine on first use.
+func (pool *clientPool) Get(ctx context.Context, secretName types.NamespacedName) (ovirtclient.Client, error) {
+	client, err := pool.cachedClient(secretName).getContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get oVirt client of credentials secret %s: %w", secretName, err)
+	}
+	return client, nil
+}
+
+// cachedClient returns the pooled client of the secret, which is created and registered as listener
+// of the secret on first use. A client of a secret which doesn't exist or isn't watched stays in the
+// CredentialsMissing state until the secret appears.
+func (pool *clientPool) cachedClient(secretName types.NamespacedName) *cachedOVirtClient {
+	pool.lock.Lock()
+	defer pool.lock.Unlock()
+
+	if cachedClient, ok := pool.clients[secretName]; ok {
+		return cachedClient
+	}
+
+	pool.logger.Infof("Creating oVirt client for credentials secret %s", secretName)
+	cachedClient := NewCachedOVirtClient(secretName.String())
+	if pool.clientCreateFunc != nil {
+		cachedClient.WithCreateFunc(pool.clientCreateFunc)
+	}
+	if pool.throttle != nil {
+		cachedClient.WithThrottle(*pool.throttle)
+	}
+	// the client is configured before it is registered, the service passes known credentials immediately
+	pool.service.AddListenerForSecret(secretName, cachedClient)
+	if pool.probeCtx != nil {
+		cachedClient.StartHealthProbe(pool.probeCtx, pool.probeInterval)
+	}
+
+	pool.clients[secretName] = cachedClient
+	return cachedClient
+}
@@ -0,0 +1,154 @@
+//go:build unit
+
+package ovirt
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	ovirtclient "github.com/ovirt/go-ovirt-client/v2"
+	apicorev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestClientPool(t *testing.T) {
+	defaultSecret := types.NamespacedName{Namespace: "openshift-machine-api", Name: "ovirt-credentials"}
+	siteA := types.NamespacedName{Namespace: "openshift-machine-api", Name: "site-a"}
+	siteB := types.NamespacedName{Namespace: "openshift-machine-api", Name: "site-b"}
+	service := newClientService(defaultSecret)
+	service.handleSecretEvent(secretEvent{secret: credentialsSecret(siteA, "https://site-a/ovirt-engine/api", "1")})
+	service.handleSecretEvent(secretEvent{secret: credentialsSecret(siteB, "https://site-b/ovirt-engine/api", "1")})
+
+	clients := map[string]ovirtclient.Client{}
+	created := map[string]int{}
+	pool := NewClientPool(service)
+	pool.WithCreateFunc(func(creds *Credentials, logger *KLogr) (ovirtclient.Client, error) {
+		created[creds.URL]++
+		if clients[creds.URL] == nil {
+			helper, err := ovirtclient.NewMockTestHelper(logger)
+			if err != nil {
+				return nil, err
+			}
+			clients[creds.URL] = helper.GetClient()
+		}
+		return clients[creds.URL], nil
+	})
+
+	clientA, err := pool.Get(context.Background(), siteA)
+	if err != nil {
+		t.Fatalf("Unexpected error occurred getting client of %s: %v", siteA, err)
+	}
+	clientB, err := pool.Get(context.Background(), siteB)
+	if err != nil {
+		t.Fatalf("Unexpected error occurred getting client of %s: %v", siteB, err)
+	}
+	if clientA == clientB {
+		t.Errorf("Expected different clients for different secrets")
+	}
+	if _, err := pool.Get(context.Background(), siteA); err != nil {
+		t.Fatalf("Unexpected error occurred getting client of %s: %v", siteA, err)
+	}
+	if created["https://site-a/ovirt-engine/api"] != 1 {
+		t.Errorf("Expected the client of an unchanged secret to be reused, but it was created %d times",
+			created["https://site-a/ovirt-engine/api"])
+	}
+
+	// a new version of the secret with the same credentials doesn't rebuild the client
+	service.handleSecretEvent(secretEvent{secret: credentialsSecret(siteA, "https://site-a/ovirt-engine/api", "2")})
+	if created["https://site-a/ovirt-engine/api"] != 1 {
+		t.Errorf("Expected the client to be kept for unchanged credentials, but it was created %d times",
+			created["https://site-a/ovirt-engine/api"])
+	}
+
+	rotated := credentialsSecret(siteA, "https://site-a/ovirt-engine/api", "3")
+	rotated.Data["ovirt_password"] = []byte("rotated")
+	service.handleSecretEvent(secretEvent{secret: rotated})
+	if created["https://site-a/ovirt-engine/api"] != 2 {
+		t.Errorf("Expected the client to be recreated after the credentials changed, but it was created %d times",
+			created["https://site-a/ovirt-engine/api"])
+	}
+
+	service.handleTrustedCAUpdate("trusted CA")
+	if created["https://site-a/ovirt-engine/api"] != 3 {
+		t.Errorf("Expected the client to be recreated after the trusted CAs changed, but it was created %d times",
+			created["https://site-a/ovirt-engine/api"])
+	}
+
+	service.handleSecretEvent(secretEvent{secret: &apicorev1.Secret{ObjectMeta: rotated.ObjectMeta}, deleted: true})
+	if _, err := pool.Get(context.Background(), siteA); !errors.Is(err, errCredentialsMissing) {
+		t.Errorf("Expected missing credentials getting client of deleted secret %s, but got %v", siteA, err)
+	}
+
+	unknown := types.NamespacedName{Namespace: "openshift-machine-api", Name: "unknown"}
+	if _, err := pool.Get(context.Background(), unknown); !errors.Is(err, errCredentialsMissing) {
+		t.Errorf("Expected missing credentials getting client of unknown secret, but got %v", err)
+	}
+	// the secret is picked up once the service sees it
+	service.handleSecretEvent(secretEvent{secret: credentialsSecret(unknown, "https://unknown/ovirt-engine/api", "1")})
+	if _, err := pool.Get(context.Background(), unknown); err != nil {
+		t.Errorf("Unexpected error occurred getting client of %s after it was created: %v", unknown, err)
+	}
+}
+
+// contextTestClient records the contexts of its connection tests.
+type contextTestClient struct {
+	ovirtclient.Client
+	ctx          context.Context
+	testContexts *[]context.Context
+}
+
+func (c *contextTestClient) WithContext(ctx context.Context) ovirtclient.Client {
+	return &contextTestClient{Client: c.Client, ctx: ctx, testContexts: c.testContexts}
+}
+
+func (c *contextTestClient) Test(retries ...ovirtclient.RetryStrategy) error {
+	*c.testContexts = append(*c.testContexts, c.ctx)
+	return c.Client.Test(retries...)
+}
+
+func TestClientPoolGetUsesContext(t *testing.T) {
+	defaultSecret := types.NamespacedName{Namespace: "openshift-machine-api", Name: "ovirt-credentials"}
+	service := newClientService(defaultSecret)
+	service.handleSecretEvent(secretEvent{secret: credentialsSecret(defaultSecret, "https://engine/ovirt-engine/api", "1")})
+
+	var testContexts []context.Context
+	pool := NewClientPool(service)
+	pool.WithCreateFunc(func(creds *Credentials, logger *KLogr) (ovirtclient.Client, error) {
+		helper, err := ovirtclient.NewMockTestHelper(logger)
+		if err != nil {
+			return nil, err
+		}
+		return &contextTestClient{Client: helper.GetClient(), testContexts: &testContexts}, nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if _, err := pool.Get(ctx, defaultSecret); err != nil {
+		t.Fatalf("Unexpected error occurred getting client: %v", err)
+	}
+	if len(testContexts) != 1 || testContexts[0] != ctx {
+		t.Errorf("Expected the connection test to use the context of Get, but got %v", testContexts)
+	}
+
+	cancel()
+	if _, err := pool.Get(ctx, defaultSecret); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected getting a client with a canceled context to fail, but got %v", err)
+	}
+	if len(testContexts) != 1 {
+		t.Errorf("Expected no connection test with a canceled context, but got %d tests", len(testContexts))
+	}
+}
+
+func credentialsSecret(name types.NamespacedName, url string, resourceVersion string) *apicorev1.Secret {
+	return &apicorev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: name.Namespace, Name: name.Name, ResourceVersion: resourceVersion},
+		Data: map[string][]byte{
+			"ovirt_url":      []byte(url),
+			"ovirt_username": []byte("user"),
+			"ovirt_password": []byte("topsecret"),
+			"ovirt_insecure": []byte("true"),
+		},
+	}
+}
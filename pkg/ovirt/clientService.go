@@ -3,16 +3,20 @@ package ovirt
 import (
 	"context"
 	"fmt"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
 	k8sCorev1 "k8s.io/api/core/v1"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	"k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
 )
 
 type ClientService interface {
@@ -20,24 +24,61 @@ type ClientService interface {
 	Shutdown(timeout time.Duration)
 
 	NewCachedClient(name string) CachedOVirtClient
+	NewCachedClientForSecret(name string, secret types.NamespacedName) CachedOVirtClient
 	AddListener(CredentialUpdatable) ClientService
 	AddListeners(updatables ...CredentialUpdatable) ClientService
+	AddListenerForSecret(secret types.NamespacedName, updatable CredentialUpdatable) ClientService
+	WithEventRecorder(record.EventRecorder) ClientService
+	TrustedCASource
+}
+
+// TrustedCASource provides the CA certificates trusted by the cluster.
+type TrustedCASource interface {
+	// TrustedCABundle returns the PEM encoded CA certificates trusted by the cluster.
+	TrustedCABundle() string
 }
 
 type clientService struct {
 	logger *KLogr
 
-	secretInformer       cache.SharedIndexInformer
-	credentialUpdateChan chan interface{}
-
-	wg *sync.WaitGroup
-
-	credUpdateListener []CredentialUpdatable
+	defaultSecret        types.NamespacedName
+	informers            []cache.SharedIndexInformer
+	credentialUpdateChan chan secretEvent
+	trustedCAUpdateChan  chan string
+
+	wg            *sync.WaitGroup
+	eventRecorder record.EventRecorder
+
+	// updateLock serializes the delivery of credentials, so the listeners receive the updates in order.
+	// The listeners are called without holding the listenerLock, as setting credentials logs in to the engine.
+	updateLock *sync.Mutex
+	// listenerLock guards the listeners, the last known credentials of the secrets and the trusted CAs
+	listenerLock       *sync.Mutex
+	credUpdateListener map[types.NamespacedName][]CredentialUpdatable
+	credentials        map[types.NamespacedName]*Credentials
+	trustedCABundle    string
 }
 
+// SecretsToWatch are the credentials secrets the client service watches.
 type SecretsToWatch struct {
+	// Namespace and SecretName identify the default credentials secret, listeners which are added
+	// without a secret are bound to it.
 	Namespace  string
 	SecretName string
+	// LabelSelector selects additional credentials secrets in the Namespaces.
+	// No additional secrets are watched if it is empty.
+	LabelSelector string
+	// Namespaces the LabelSelector is applied in, defaults to the Namespace.
+	Namespaces []string
+	// TrustedCAConfigMap is the ConfigMap in the Namespace containing the CA certificates trusted
+	// by the cluster, they are trusted in addition to the CAs of the secrets. Optional.
+	TrustedCAConfigMap string
+}
+
+// secretEvent is a change of a watched secret.
+type secretEvent struct {
+	secret  *k8sCorev1.Secret
+	deleted bool
 }
 
 func NewClientService(
@@ -45,48 +86,159 @@ func NewClientService(
 	watchedCreds SecretsToWatch,
 ) *clientService {
 	kubeClientSet := kubernetes.NewForConfigOrDie(rest.AddUserAgent(cfg, "ovirt-client-service"))
-	informersForNamespace := informers.NewSharedInformerFactoryWithOptions(
-		kubeClientSet,
-		10*time.Minute,
-		informers.WithNamespace(watchedCreds.Namespace),
-		informers.WithTweakListOptions(func(lo *v1.ListOptions) {
-			lo.FieldSelector = fmt.Sprintf("metadata.name=%s", watchedCreds.SecretName)
-		}),
-	)
-
-	service := &clientService{
+
+	service := newClientService(types.NamespacedName{Namespace: watchedCreds.Namespace, Name: watchedCreds.SecretName})
+
+	informerFactories := []informers.SharedInformerFactory{
+		informers.NewSharedInformerFactoryWithOptions(
+			kubeClientSet,
+			10*time.Minute,
+			informers.WithNamespace(watchedCreds.Namespace),
+			informers.WithTweakListOptions(func(lo *v1.ListOptions) {
+				lo.FieldSelector = fmt.Sprintf("metadata.name=%s", watchedCreds.SecretName)
+			}),
+		),
+	}
+	if watchedCreds.LabelSelector != "" {
+		namespaces := watchedCreds.Namespaces
+		if len(namespaces) == 0 {
+			namespaces = []string{watchedCreds.Namespace}
+		}
+		for _, namespace := range namespaces {
+			informerFactories = append(informerFactories, informers.NewSharedInformerFactoryWithOptions(
+				kubeClientSet,
+				10*time.Minute,
+				informers.WithNamespace(namespace),
+				informers.WithTweakListOptions(func(lo *v1.ListOptions) {
+					lo.LabelSelector = watchedCreds.LabelSelector
+				}),
+			))
+		}
+	}
+
+	if watchedCreds.TrustedCAConfigMap != "" {
+		configMapInformer := informers.NewSharedInformerFactoryWithOptions(
+			kubeClientSet,
+			10*time.Minute,
+			informers.WithNamespace(watchedCreds.Namespace),
+			informers.WithTweakListOptions(func(lo *v1.ListOptions) {
+				lo.FieldSelector = fmt.Sprintf("metadata.name=%s", watchedCreds.TrustedCAConfigMap)
+			}),
+		).Core().V1().ConfigMaps().Informer()
+		configMapInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+			AddFunc: func(obj interface{}) {
+				service.enqueueTrustedCA(obj)
+			},
+			UpdateFunc: func(oldObj, newObj interface{}) {
+				service.enqueueTrustedCA(newObj)
+			},
+			DeleteFunc: func(obj interface{}) {
+				service.trustedCAUpdateChan <- ""
+			},
+		})
+		service.informers = append(service.informers, configMapInformer)
+	}
+
+	for _, factory := range informerFactories {
+		informer := factory.Core().V1().Secrets().Informer()
+		informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+			AddFunc: func(obj interface{}) {
+				service.enqueue(obj, false)
+			},
+			UpdateFunc: func(oldObj, newObj interface{}) {
+				service.enqueue(newObj, false)
+			},
+			DeleteFunc: func(obj interface{}) {
+				if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+					obj = tombstone.Obj
+				}
+				service.enqueue(obj, true)
+			},
+		})
+		service.informers = append(service.informers, informer)
+	}
+
+	return service
+}
+
+func newClientService(defaultSecret types.NamespacedName) *clientService {
+	return &clientService{
 		logger: NewKLogr("ovirt-client-service").WithVInfo(0),
 
-		secretInformer:       informersForNamespace.Core().V1().Secrets().Informer(),
-		credentialUpdateChan: make(chan interface{}),
+		defaultSecret:        defaultSecret,
+		credentialUpdateChan: make(chan secretEvent),
+		trustedCAUpdateChan:  make(chan string),
+
+		wg: &sync.WaitGroup{},
 
-		// allocate 4 updatables:
+		updateLock:   &sync.Mutex{},
+		listenerLock: &sync.Mutex{},
+		// allocate 4 updatables for the default secret:
 		// node and providerId controller, actuator and healthz
-		credUpdateListener: make([]CredentialUpdatable, 0, 4),
-		wg:                 &sync.WaitGroup{},
+		credUpdateListener: map[types.NamespacedName][]CredentialUpdatable{
+			defaultSecret: make([]CredentialUpdatable, 0, 4),
+		},
+		credentials: map[types.NamespacedName]*Credentials{},
 	}
+}
 
-	service.secretInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
-		AddFunc: func(obj interface{}) {
-			service.credentialUpdateChan <- obj
-		},
-		UpdateFunc: func(oldObj, newObj interface{}) {
-			service.credentialUpdateChan <- newObj
-		},
-	})
+func (service *clientService) enqueue(obj interface{}, deleted bool) {
+	secret, ok := obj.(*k8sCorev1.Secret)
+	if !ok {
+		service.logger.Errorf("failed to parse k8s secret")
+		return
+	}
+	service.credentialUpdateChan <- secretEvent{secret: secret, deleted: deleted}
+}
 
+// WithEventRecorder sets the recorder of the events on the watched secrets.
+func (service *clientService) WithEventRecorder(recorder record.EventRecorder) ClientService {
+	service.eventRecorder = recorder
 	return service
 }
 
+// enqueueTrustedCA sends the combined PEM bundles of the trusted CA ConfigMap to the update processing.
+func (service *clientService) enqueueTrustedCA(obj interface{}) {
+	configMap, ok := obj.(*k8sCorev1.ConfigMap)
+	if !ok {
+		service.logger.Errorf("failed to parse k8s config map")
+		return
+	}
+	keys := make([]string, 0, len(configMap.Data))
+	for key := range configMap.Data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	bundles := make([]string, 0, len(keys))
+	for _, key := range keys {
+		if bundle := strings.TrimSpace(configMap.Data[key]); bundle != "" {
+			bundles = append(bundles, bundle)
+		}
+	}
+	service.trustedCAUpdateChan <- strings.Join(bundles, "\n")
+}
+
+// TrustedCABundle returns the CA certificates of the trusted CA ConfigMap.
+func (service *clientService) TrustedCABundle() string {
+	service.listenerLock.Lock()
+	defer service.listenerLock.Unlock()
+
+	return service.trustedCABundle
+}
+
 func (service *clientService) NewCachedClient(name string) CachedOVirtClient {
+	return service.NewCachedClientForSecret(name, service.defaultSecret)
+}
+
+// NewCachedClientForSecret creates a cached client which is updated with the credentials of the secret.
+func (service *clientService) NewCachedClientForSecret(name string, secret types.NamespacedName) CachedOVirtClient {
 	newClient := NewCachedOVirtClient(name)
-	service.AddListener(newClient)
+	service.AddListenerForSecret(secret, newClient)
 	return newClient
 }
 
 func (service *clientService) AddListener(updatable CredentialUpdatable) ClientService {
-	service.credUpdateListener = append(service.credUpdateListener, updatable)
-	return service
+	return service.AddListenerForSecret(service.defaultSecret, updatable)
 }
 
 func (service *clientService) AddListeners(updatables ...CredentialUpdatable) ClientService {
@@ -96,25 +248,54 @@ func (service *clientService) AddListeners(updatables ...CredentialUpdatable) Cl
 	return service
 }
 
+// AddListenerForSecret adds a listener which is only updated on changes of the secret.
+// The listener immediately receives the credentials if the secret is already known.
+func (service *clientService) AddListenerForSecret(secret types.NamespacedName, updatable CredentialUpdatable) ClientService {
+	service.updateLock.Lock()
+	defer service.updateLock.Unlock()
+
+	service.listenerLock.Lock()
+	service.credUpdateListener[secret] = append(service.credUpdateListener[secret], updatable)
+	creds, ok := service.credentials[secret]
+	service.listenerLock.Unlock()
+
+	if ok {
+		updatable.SetCredentials(creds)
+	}
+	return service
+}
+
+// listeners returns a copy of the listeners of the secret, so they can be called without holding the
+// listenerLock. The listenerLock has to be held by the caller.
+func (service *clientService) listeners(secret types.NamespacedName) []CredentialUpdatable {
+	return append([]CredentialUpdatable(nil), service.credUpdateListener[secret]...)
+}
+
 func (service *clientService) Run(ctx context.Context) {
 	defer utilruntime.HandleCrash()
 
 	service.logger.Infof("Starting credential update service")
 
+	// process the updates while the informers sync, their handlers block until the update is received
 	service.wg.Add(1)
-	go func() {
-		defer service.wg.Done()
+	go service.processCredentialUpdate(ctx, service.wg)
 
-		service.secretInformer.Run(ctx.Done())
-	}()
+	hasSynced := make([]cache.InformerSynced, 0, len(service.informers))
+	for _, informer := range service.informers {
+		informer := informer
+		service.wg.Add(1)
+		go func() {
+			defer service.wg.Done()
+
+			informer.Run(ctx.Done())
+		}()
+		hasSynced = append(hasSynced, informer.HasSynced)
+	}
 
-	if !cache.WaitForCacheSync(ctx.Done(), service.secretInformer.HasSynced) {
+	if !cache.WaitForCacheSync(ctx.Done(), hasSynced...) {
 		service.logger.Errorf("timed out waiting for informer caches to sync")
 	}
 	service.logger.Infof("Credential update service synced and ready")
-
-	service.wg.Add(1)
-	go service.processCredentialUpdate(ctx, service.wg)
 }
 
 func (service *clientService) processCredentialUpdate(ctx context.Context, wg *sync.WaitGroup) {
@@ -122,35 +303,114 @@ func (service *clientService) processCredentialUpdate(ctx context.Context, wg *s
 
 	for {
 		select {
-		case credObj := <-service.credentialUpdateChan:
-			secret, ok := credObj.(*k8sCorev1.Secret)
-			if !ok {
-				service.logger.Errorf("failed to parse k8s secret")
-				break
-			}
+		case event := <-service.credentialUpdateChan:
+			service.handleSecretEvent(event)
+		case bundle := <-service.trustedCAUpdateChan:
+			service.handleTrustedCAUpdate(bundle)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
 
-			creds, err := FromK8sSecret(secret)
-			if err != nil {
-				service.logger.Errorf("failed to parse k8s secret to oVirt credentials: %v", err)
-				break
-			}
+// handleSecretEvent updates the listeners bound to the changed secret. The listeners of a deleted
+// secret are invalidated, so they don't keep using the removed credentials. Listeners of a secret with
+// unusable credentials keep their last known good credentials.
+func (service *clientService) handleSecretEvent(event secretEvent) {
+	key := types.NamespacedName{Namespace: event.secret.Namespace, Name: event.secret.Name}
+
+	service.updateLock.Lock()
+	defer service.updateLock.Unlock()
+
+	if event.deleted {
+		service.logger.Infof("Credentials secret %s was deleted, invalidating its clients", key)
+		service.recordEvent(event.secret, k8sCorev1.EventTypeWarning, string(ClientStateCredentialsMissing),
+			"Credentials secret was deleted, oVirt clients using it are invalidated")
+
+		service.listenerLock.Lock()
+		delete(service.credentials, key)
+		listeners := service.listeners(key)
+		service.listenerLock.Unlock()
+		for _, listener := range listeners {
+			listener.InvalidateCredentials()
+		}
+		return
+	}
 
-			err = writeCA(creds)
-			if err != nil {
-				service.logger.Errorf("failed to write CA to temporary file: %v", err)
-				break
-			}
+	creds, err := FromK8sSecret(event.secret)
+	if err != nil {
+		service.logger.Errorf("failed to read oVirt credentials from k8s secret %s: %v", key, err)
+		service.recordEvent(event.secret, k8sCorev1.EventTypeWarning, string(ClientStateCredentialsInvalid),
+			"Invalid oVirt credentials, keeping the last known good credentials: %v", err)
+		service.listenerLock.Lock()
+		listeners := service.listeners(key)
+		service.listenerLock.Unlock()
+		for _, listener := range listeners {
+			listener.RejectCredentials(err)
+		}
+		return
+	}
 
-			for _, listener := range service.credUpdateListener {
-				listener.SetCredentials(creds)
+	service.listenerLock.Lock()
+	creds.TrustedCABundle = service.trustedCABundle
+	service.credentials[key] = creds
+	listeners := service.listeners(key)
+	service.listenerLock.Unlock()
+
+	refused := false
+	for _, listener := range listeners {
+		listener.SetCredentials(creds)
+		if stateful, ok := listener.(interface{ State() (ClientState, error) }); ok {
+			if state, _ := stateful.State(); state == ClientStateCredentialsInvalid {
+				refused = true
 			}
+		}
+	}
+	if refused {
+		service.recordEvent(event.secret, k8sCorev1.EventTypeWarning, string(ClientStateCredentialsInvalid),
+			"oVirt engine refused the credentials, keeping the last known good credentials")
+	} else {
+		service.recordEvent(event.secret, k8sCorev1.EventTypeNormal, "CredentialsUpdated", "oVirt credentials updated")
+	}
+}
 
-		case <-ctx.Done():
-			return
+// handleTrustedCAUpdate updates the listeners of all secrets with the trusted CAs. Clients are only
+// rebuilt if the CAs have changed.
+func (service *clientService) handleTrustedCAUpdate(bundle string) {
+	service.updateLock.Lock()
+	defer service.updateLock.Unlock()
+
+	service.listenerLock.Lock()
+	if bundle == service.trustedCABundle {
+		service.listenerLock.Unlock()
+		return
+	}
+	service.logger.Infof("Trusted CAs changed, updating the oVirt clients")
+	service.trustedCABundle = bundle
+	updates := make(map[*Credentials][]CredentialUpdatable, len(service.credentials))
+	for key, creds := range service.credentials {
+		updated := *creds
+		updated.TrustedCABundle = bundle
+		service.credentials[key] = &updated
+		updates[&updated] = service.listeners(key)
+	}
+	service.listenerLock.Unlock()
+
+	for creds, listeners := range updates {
+		for _, listener := range listeners {
+			listener.SetCredentials(creds)
 		}
 	}
 }
 
+// recordEvent records an event on the secret if the service has an event recorder.
+func (service *clientService) recordEvent(secret *k8sCorev1.Secret, eventType, reason, messageFmt string, args ...interface{}) {
+	if service.eventRecorder == nil {
+		return
+	}
+	service.eventRecorder.Eventf(secret, eventType, reason, messageFmt, args...)
+}
+
 func (service *clientService) Shutdown(timeout time.Duration) {
 	service.logger.Infof("Shutting down oVirt client service...")
 	c := make(chan struct{})
@@ -168,4 +428,8 @@ func (service *clientService) Shutdown(timeout time.Duration) {
 
 type CredentialUpdatable interface {
 	SetCredentials(*Credentials)
+	// RejectCredentials records that the secret was updated with credentials which can't be used.
+	RejectCredentials(error)
+	// InvalidateCredentials drops the credentials after their secret was deleted.
+	InvalidateCredentials()
 }
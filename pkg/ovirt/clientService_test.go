@@ -0,0 +1,122 @@
+//go:build unit
+
+package ovirt
+
+import (
+	"testing"
+	"time"
+
+	apicorev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// recordingListener records the credentials it was updated with.
+type recordingListener struct {
+	credentials *Credentials
+	updates     int
+	rejected    error
+	invalidated bool
+}
+
+func (l *recordingListener) SetCredentials(creds *Credentials) {
+	l.credentials = creds
+	l.updates++
+	l.invalidated = false
+}
+
+func (l *recordingListener) RejectCredentials(err error) {
+	l.rejected = err
+}
+
+func (l *recordingListener) InvalidateCredentials() {
+	l.credentials = nil
+	l.invalidated = true
+}
+
+func TestClientServiceHandleSecretEvent(t *testing.T) {
+	defaultSecret := types.NamespacedName{Namespace: "openshift-machine-api", Name: "ovirt-credentials"}
+	siteB := types.NamespacedName{Namespace: "site-b", Name: "ovirt-credentials"}
+	service := newClientService(defaultSecret)
+
+	defaultListener := &recordingListener{}
+	siteBListener := &recordingListener{}
+	service.AddListener(defaultListener)
+	service.AddListenerForSecret(siteB, siteBListener)
+
+	service.handleSecretEvent(secretEvent{secret: credentialsSecret(siteB, "https://site-b/ovirt-engine/api", "1")})
+	if siteBListener.credentials == nil || siteBListener.credentials.URL != "https://site-b/ovirt-engine/api" {
+		t.Errorf("Expected listener of %s to be updated, but got %v", siteB, siteBListener.credentials)
+	}
+	if defaultListener.updates != 0 {
+		t.Errorf("Expected listener of %s not to be updated by changes of %s", defaultSecret, siteB)
+	}
+
+	invalid := credentialsSecret(siteB, "https://site-b/ovirt-engine/api", "2")
+	invalid.Data["ovirt_insecure"] = []byte("maybe")
+	service.handleSecretEvent(secretEvent{secret: invalid})
+	if siteBListener.updates != 1 || siteBListener.credentials == nil {
+		t.Errorf("Expected listener to keep the last known good credentials, but got %d updates", siteBListener.updates)
+	}
+	if siteBListener.rejected == nil {
+		t.Errorf("Expected listener to be notified about the unparsable credentials")
+	}
+
+	service.handleTrustedCAUpdate("trusted CA")
+	if siteBListener.credentials.TrustedCABundle != "trusted CA" {
+		t.Errorf("Expected listener to be updated with the trusted CAs, but got %q", siteBListener.credentials.TrustedCABundle)
+	}
+	service.handleTrustedCAUpdate("trusted CA")
+	if siteBListener.updates != 2 {
+		t.Errorf("Expected listener not to be updated for unchanged trusted CAs, but got %d updates", siteBListener.updates)
+	}
+
+	lateListener := &recordingListener{}
+	service.AddListenerForSecret(siteB, lateListener)
+	if lateListener.credentials == nil {
+		t.Errorf("Expected listener added after the update to receive the known credentials")
+	}
+
+	service.handleSecretEvent(secretEvent{secret: &apicorev1.Secret{ObjectMeta: invalid.ObjectMeta}, deleted: true})
+	if !siteBListener.invalidated || !lateListener.invalidated {
+		t.Errorf("Expected listeners of deleted secret %s to be invalidated", siteB)
+	}
+	if defaultListener.invalidated {
+		t.Errorf("Expected listener of %s not to be invalidated by deletion of %s", defaultSecret, siteB)
+	}
+}
+
+// reentrantListener reads the trusted CAs from the service while it is updated.
+type reentrantListener struct {
+	recordingListener
+	service         *clientService
+	trustedCABundle string
+}
+
+func (l *reentrantListener) SetCredentials(creds *Credentials) {
+	l.recordingListener.SetCredentials(creds)
+	l.trustedCABundle = l.service.TrustedCABundle()
+}
+
+func TestClientServiceUpdatesListenersWithoutListenerLock(t *testing.T) {
+	defaultSecret := types.NamespacedName{Namespace: "openshift-machine-api", Name: "ovirt-credentials"}
+	service := newClientService(defaultSecret)
+	listener := &reentrantListener{service: service}
+	service.AddListener(listener)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		service.handleSecretEvent(secretEvent{secret: credentialsSecret(defaultSecret, "https://engine/ovirt-engine/api", "1")})
+		service.handleTrustedCAUpdate("trusted CA")
+		service.AddListener(&reentrantListener{service: service})
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Expected listeners to be updated without holding the listener lock, but the update blocked")
+	}
+	if listener.updates != 2 || listener.trustedCABundle != "trusted CA" {
+		t.Errorf("Expected listener to be updated twice with the trusted CAs, but got %d updates with %q",
+			listener.updates, listener.trustedCABundle)
+	}
+}
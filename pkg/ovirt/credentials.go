@@ -6,19 +6,35 @@ SPDX-License-Identifier: Apache-2.0
 package ovirt
 
 import (
+	"crypto/tls"
 	"fmt"
+	"os"
+	"sort"
 	"strconv"
+	"strings"
 
 	apicorev1 "k8s.io/api/core/v1"
 )
 
+// Credentials are the oVirt credentials read from a secret. The engine login always uses the username
+// and password, the oVirt SDK doesn't support logging in with an SSO access token or Kerberos. A client
+// certificate is presented in addition for engines requiring mutual TLS.
 type Credentials struct {
 	URL      string
 	Username string
 	Password string
 	CAFile   string
 	Insecure bool
+	// CABundle contains the PEM encoded CA certificates of the secret. The bundles of all secret
+	// fields starting with ovirt_ca_bundle are combined, the CAFile is only read if there are none.
 	CABundle string
+	// TrustedCABundle contains the PEM encoded CA certificates trusted by the cluster, it is
+	// set by the client service from the trusted CA ConfigMap.
+	TrustedCABundle string
+	// ClientCert and ClientKey are the PEM encoded client certificate and key presented to the engine
+	// for mutual TLS. Both are optional, but have to be set together.
+	ClientCert string
+	ClientKey  string
 }
 
 const (
@@ -28,9 +44,21 @@ const (
 	secretFieldCafile   = "ovirt_cafile"
 	secretFieldInsecure = "ovirt_insecure"
 	secretFieldCaBundle = "ovirt_ca_bundle"
+	secretFieldCert     = "ovirt_client_cert"
+	secretFieldKey      = "ovirt_client_key"
 )
 
+// unsupportedAuthFields are secret fields of authentication methods the oVirt SDK doesn't support.
+// Secrets containing them are rejected, instead of ignoring the fields and failing the login.
+var unsupportedAuthFields = []string{"ovirt_token", "ovirt_sso_token", "ovirt_kerberos_keytab"}
+
 func FromK8sSecret(secret *apicorev1.Secret) (*Credentials, error) {
+	for _, field := range unsupportedAuthFields {
+		if _, ok := secret.Data[field]; ok {
+			return nil, fmt.Errorf("%s in credentials is not supported, the oVirt engine login requires %s and %s",
+				field, secretFieldUsername, secretFieldPassword)
+		}
+	}
 	o := Credentials{}
 	o.URL = string(secret.Data[secretFieldUrl])
 	o.Username = string(secret.Data[secretFieldUsername])
@@ -41,6 +69,41 @@ func FromK8sSecret(secret *apicorev1.Secret) (*Credentials, error) {
 		return nil, fmt.Errorf("failed to identify %s in credentials %w", secretFieldInsecure, err)
 	}
 	o.Insecure = insecure
-	o.CABundle = string(secret.Data[secretFieldCaBundle])
+	o.CABundle = caBundleFromSecret(secret)
+	if o.CABundle == "" && o.CAFile != "" {
+		caFile, err := os.ReadFile(o.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s in credentials %w", secretFieldCafile, err)
+		}
+		o.CABundle = string(caFile)
+	}
+	o.ClientCert = string(secret.Data[secretFieldCert])
+	o.ClientKey = string(secret.Data[secretFieldKey])
+	if o.ClientCert != "" || o.ClientKey != "" {
+		if _, err := tls.X509KeyPair([]byte(o.ClientCert), []byte(o.ClientKey)); err != nil {
+			return nil, fmt.Errorf("failed to load client certificate from %s and %s in credentials %w",
+				secretFieldCert, secretFieldKey, err)
+		}
+	}
 	return &o, nil
 }
+
+// caBundleFromSecret combines the PEM bundles of the ovirt_ca_bundle field and the fields
+// prefixed with ovirt_ca_bundle_ in the order of their names.
+func caBundleFromSecret(secret *apicorev1.Secret) string {
+	fields := make([]string, 0, 1)
+	for field := range secret.Data {
+		if field == secretFieldCaBundle || strings.HasPrefix(field, secretFieldCaBundle+"_") {
+			fields = append(fields, field)
+		}
+	}
+	sort.Strings(fields)
+
+	bundles := make([]string, 0, len(fields))
+	for _, field := range fields {
+		if bundle := strings.TrimSpace(string(secret.Data[field])); bundle != "" {
+			bundles = append(bundles, bundle)
+		}
+	}
+	return strings.Join(bundles, "\n")
+}
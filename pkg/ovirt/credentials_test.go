@@ -3,9 +3,19 @@
 package ovirt
 
 import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
+	ovirtclient "github.com/ovirt/go-ovirt-client/v2"
 	apicorev1 "k8s.io/api/core/v1"
 )
 
@@ -57,6 +67,18 @@ func TestFromK8sSecret(t *testing.T) {
 			},
 			expectedError: true,
 		},
+		{
+			name:        "fails on unsupported SSO token",
+			description: "failure on an SSO access token in ovirt credentials of k8s secret, which the SDK can't log in with",
+			inputSecret: &apicorev1.Secret{
+				Data: map[string][]byte{
+					"ovirt_url":      []byte("https://ovirt-engine.test.com/api"),
+					"ovirt_token":    []byte("token"),
+					"ovirt_insecure": []byte("false"),
+				},
+			},
+			expectedError: true,
+		},
 	}
 
 	for _, tc := range testcases {
@@ -75,3 +97,119 @@ func TestFromK8sSecret(t *testing.T) {
 		})
 	}
 }
+
+func TestCABundleFromSecret(t *testing.T) {
+	secret := &apicorev1.Secret{
+		Data: map[string][]byte{
+			"ovirt_ca_bundle":        []byte("engine CA\n"),
+			"ovirt_ca_bundle_site_b": []byte("site B CA"),
+			"ovirt_ca_bundle_empty":  []byte(""),
+			"ovirt_cafile":           []byte("/not/existing"),
+		},
+	}
+	if bundle := caBundleFromSecret(secret); bundle != "engine CA\nsite B CA" {
+		t.Errorf("expected all bundles to be combined, but got %q", bundle)
+	}
+}
+
+func TestFromK8sSecretClientCertificate(t *testing.T) {
+	cert, key := generateClientCertificate(t)
+
+	testcases := []struct {
+		name          string
+		cert          []byte
+		key           []byte
+		expectedError bool
+	}{
+		{
+			name: "certificate and key are read",
+			cert: cert,
+			key:  key,
+		},
+		{
+			name:          "certificate without key fails",
+			cert:          cert,
+			expectedError: true,
+		},
+		{
+			name:          "key without certificate fails",
+			key:           key,
+			expectedError: true,
+		},
+		{
+			name:          "certificate not matching the key fails",
+			cert:          cert,
+			key:           []byte("not a key"),
+			expectedError: true,
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			creds, err := FromK8sSecret(&apicorev1.Secret{
+				Data: map[string][]byte{
+					"ovirt_url":         []byte("https://ovirt-engine.test.com/api"),
+					"ovirt_username":    []byte("user"),
+					"ovirt_insecure":    []byte("false"),
+					"ovirt_client_cert": tc.cert,
+					"ovirt_client_key":  tc.key,
+				},
+			})
+			if tc.expectedError {
+				if err == nil {
+					t.Fatal("expected error, but got <nil>")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected no error, but got '%v'", err)
+			}
+			if creds.ClientCert != string(cert) || creds.ClientKey != string(key) {
+				t.Errorf("expected client certificate and key to be read from the secret")
+			}
+
+			tlsConfig, err := clientCertTLSProvider{
+				TLSProvider: ovirtclient.TLS().Insecure(),
+				certificate: mustX509KeyPair(t, cert, key),
+			}.CreateTLSConfig()
+			if err != nil {
+				t.Fatalf("expected no error creating TLS config, but got '%v'", err)
+			}
+			if len(tlsConfig.Certificates) != 1 {
+				t.Errorf("expected client certificate in TLS config, but got %d certificates", len(tlsConfig.Certificates))
+			}
+		})
+	}
+}
+
+func generateClientCertificate(t *testing.T) ([]byte, []byte) {
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "capo"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &privateKey.PublicKey, privateKey)
+	if err != nil {
+		t.Fatalf("failed to create certificate: %v", err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(privateKey)
+	if err != nil {
+		t.Fatalf("failed to marshal key: %v", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})
+}
+
+func mustX509KeyPair(t *testing.T, cert, key []byte) tls.Certificate {
+	certificate, err := tls.X509KeyPair(cert, key)
+	if err != nil {
+		t.Fatalf("failed to load key pair: %v", err)
+	}
+	return certificate
+}
@@ -0,0 +1,30 @@
+package ovirt
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+// clientStateGauge is 1 for the current state of each cached client and 0 for all other states.
+var clientStateGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "ovirt_client_state",
+	Help: "State of the cached oVirt clients, 1 for the current state of a client.",
+}, []string{"client", "state"})
+
+// clientRebuilds counts the clients built by each cached client, the first build included.
+var clientRebuilds = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "ovirt_client_rebuilds_total",
+	Help: "Number of times the cached oVirt clients were built, by result.",
+}, []string{"client", "result"})
+
+// apiCallDuration observes the duration of the calls to the engine API, throttled calls included. All calls
+// are observed by the throttle, the calls of the clients as well as the legacy SDK calls made with CallSDK.
+var apiCallDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "ovirt_api_call_duration_seconds",
+	Help:    "Duration of the oVirt engine API calls, by operation and result.",
+	Buckets: prometheus.ExponentialBuckets(0.05, 2, 12),
+}, []string{"operation", "result"})
+
+func init() {
+	metrics.Registry.MustRegister(clientStateGauge, clientRebuilds, apiCallDuration)
+}
@@ -0,0 +1,692 @@
+package ovirt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	ovirtsdk "github.com/ovirt/go-ovirt"
+	ovirtclient "github.com/ovirt/go-ovirt-client/v2"
+	"golang.org/x/time/rate"
+)
+
+const (
+	// maxThrottleWait is the longest time a call waits for the rate limiter before it is rejected
+	// with an EngineThrottledError.
+	maxThrottleWait = 10 * time.Second
+	// breakerFailureThreshold is the number of consecutive failures to reach the engine which open
+	// the circuit breaker.
+	breakerFailureThreshold = 5
+	// breakerOpenDuration is the time the circuit breaker rejects all calls before a single call
+	// is let through to test if the engine is reachable again.
+	breakerOpenDuration = 30 * time.Second
+)
+
+// ThrottleConfig configures the client-side rate limiting of the calls to the engine API.
+type ThrottleConfig struct {
+	// QPS is the sustained number of calls per second, rate limiting is disabled if it is not positive.
+	QPS float64
+	// Burst is the number of calls which may be made at once.
+	Burst int
+}
+
+// EngineThrottledError is returned instead of calling the engine if the rate limit is exceeded or the
+// circuit breaker is open after repeated failures to reach the engine. The call can be retried later.
+type EngineThrottledError struct {
+	// RetryAfter is the time after which the call is expected to be let through.
+	RetryAfter time.Duration
+	reason     string
+}
+
+func (e *EngineThrottledError) Error() string {
+	return fmt.Sprintf("oVirt engine API call throttled, %s, retry after %s", e.reason, e.RetryAfter)
+}
+
+// IsEngineThrottled returns the EngineThrottledError if the error was caused by one.
+func IsEngineThrottled(err error) (*EngineThrottledError, bool) {
+	var throttledErr *EngineThrottledError
+	if errors.As(err, &throttledErr) {
+		return throttledErr, true
+	}
+	return nil, false
+}
+
+// engineThrottle is the rate limiter and circuit breaker of an engine. It outlives the clients it wraps,
+// so rebuilding a client doesn't reset the limits.
+type engineThrottle struct {
+	limiter *rate.Limiter
+
+	lock                *sync.Mutex
+	consecutiveFailures int
+	openUntil           time.Time
+	probing             bool
+}
+
+func newEngineThrottle(config ThrottleConfig) *engineThrottle {
+	limit := rate.Inf
+	if config.QPS > 0 {
+		limit = rate.Limit(config.QPS)
+	}
+	burst := config.Burst
+	if burst < 1 {
+		burst = 1
+	}
+	return &engineThrottle{
+		limiter: rate.NewLimiter(limit, burst),
+		lock:    &sync.Mutex{},
+	}
+}
+
+// wrap returns a client which calls the engine through the throttle. The client supports the legacy
+// SDK if the wrapped client does.
+func (throttle *engineThrottle) wrap(client ovirtclient.Client) ovirtclient.Client {
+	throttled := &throttledClient{Client: client, throttle: throttle}
+	if legacyClient, ok := client.(ovirtclient.ClientWithLegacySupport); ok {
+		return &throttledLegacyClient{throttledClient: throttled, legacyClient: legacyClient}
+	}
+	return throttled
+}
+
+// acquire waits until the call may be made. An EngineThrottledError is returned if the circuit breaker
+// is open or the rate limiter doesn't let the call through within maxThrottleWait. Waiting is aborted
+// when the context of the caller is done. Calls which can't probe the engine are rejected while the
+// circuit breaker is half-open.
+func (throttle *engineThrottle) acquire(ctx context.Context, canProbe bool) error {
+	if err := throttle.allow(canProbe); err != nil {
+		return err
+	}
+	waitCtx, cancel := context.WithTimeout(ctx, maxThrottleWait)
+	defer cancel()
+	if err := throttle.limiter.Wait(waitCtx); err != nil {
+		if canProbe {
+			throttle.release()
+		}
+		if ctx.Err() != nil {
+			return fmt.Errorf("waiting for the oVirt engine rate limit: %w", ctx.Err())
+		}
+		return &EngineThrottledError{RetryAfter: throttle.retryAfter(), reason: "rate limit exceeded"}
+	}
+	return nil
+}
+
+// retryAfter returns the time until the rate limiter lets the next call through.
+func (throttle *engineThrottle) retryAfter() time.Duration {
+	reservation := throttle.limiter.Reserve()
+	defer reservation.Cancel()
+	return reservation.Delay()
+}
+
+// allow checks the circuit breaker. Once the breaker was open for breakerOpenDuration, a single call which
+// can probe the engine is let through, its result decides whether the breaker is closed or stays open.
+func (throttle *engineThrottle) allow(canProbe bool) error {
+	throttle.lock.Lock()
+	defer throttle.lock.Unlock()
+
+	if throttle.consecutiveFailures < breakerFailureThreshold {
+		return nil
+	}
+	if wait := time.Until(throttle.openUntil); wait > 0 {
+		return &EngineThrottledError{RetryAfter: wait, reason: "circuit breaker is open"}
+	}
+	if throttle.probing || !canProbe {
+		return &EngineThrottledError{RetryAfter: breakerOpenDuration, reason: "circuit breaker is half-open"}
+	}
+	throttle.probing = true
+	return nil
+}
+
+// release frees the call let through a half-open circuit breaker without recording a result.
+func (throttle *engineThrottle) release() {
+	throttle.lock.Lock()
+	defer throttle.lock.Unlock()
+
+	throttle.probing = false
+}
+
+// record updates the circuit breaker with the result of a call. Only failures to reach the engine count,
+// errors returned by the engine for the call itself show that the engine is working.
+func (throttle *engineThrottle) record(err error) {
+	throttle.lock.Lock()
+	defer throttle.lock.Unlock()
+
+	throttle.probing = false
+	if !isEngineUnavailableError(err) {
+		throttle.consecutiveFailures = 0
+		return
+	}
+	throttle.consecutiveFailures++
+	if throttle.consecutiveFailures >= breakerFailureThreshold {
+		throttle.openUntil = time.Now().Add(breakerOpenDuration)
+	}
+}
+
+// call makes the call through the throttle and records its duration and result. The context of the
+// retry strategies bounds the time the call waits for the rate limiter.
+func (throttle *engineThrottle) call(operation string, retries []ovirtclient.RetryStrategy, f func() error) error {
+	ctx, cancel := retryContext(retries)
+	defer cancel()
+	return throttle.do(ctx, operation, false, f)
+}
+
+// callContext makes the call through the throttle like call, the context bounds the time the call waits
+// for the rate limiter.
+func (throttle *engineThrottle) callContext(ctx context.Context, operation string, f func() error) error {
+	return throttle.do(ctx, operation, false, f)
+}
+
+// wait makes a call which waits for the engine to reach a state through the throttle. Such calls may
+// take minutes, so they don't probe the engine while the circuit breaker is half-open, and their
+// timeouts aren't counted as failures to reach the engine.
+func (throttle *engineThrottle) wait(operation string, retries []ovirtclient.RetryStrategy, f func() error) error {
+	ctx, cancel := retryContext(retries)
+	defer cancel()
+	return throttle.do(ctx, operation, true, f)
+}
+
+func (throttle *engineThrottle) do(ctx context.Context, operation string, waiting bool, f func() error) error {
+	start := time.Now()
+	err := throttle.acquire(ctx, !waiting)
+	if err == nil {
+		err = f()
+		if !waiting {
+			throttle.record(err)
+		}
+	}
+	apiCallDuration.WithLabelValues(operation, apiCallResult(err)).Observe(time.Since(start).Seconds())
+	return err
+}
+
+// retryContext returns a context which is canceled once the context of a ContextStrategy in the retries
+// is done. The go-ovirt-client doesn't expose the context, it is only observable through the done
+// channel returned by Wait of the strategy. The returned context has to be canceled by the caller.
+func retryContext(retries []ovirtclient.RetryStrategy) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	for _, retry := range retries {
+		if !retry.CanTimeout() || retry.CanWait() {
+			continue
+		}
+		if done, ok := retry.Get().Wait(nil).(<-chan struct{}); ok && done != nil {
+			go func() {
+				select {
+				case <-done:
+					cancel()
+				case <-ctx.Done():
+				}
+			}()
+		}
+	}
+	return ctx, cancel
+}
+
+// apiCallResult returns the result label of an API call, the error code of failed calls.
+func apiCallResult(err error) string {
+	if err == nil {
+		return "success"
+	}
+	if _, ok := IsEngineThrottled(err); ok {
+		return "throttled"
+	}
+	var engineErr ovirtclient.EngineError
+	if errors.As(err, &engineErr) {
+		return string(engineErr.Code())
+	}
+	return "error"
+}
+
+// isEngineUnavailableError returns true if the engine couldn't be reached.
+func isEngineUnavailableError(err error) bool {
+	var engineErr ovirtclient.EngineError
+	if !errors.As(err, &engineErr) {
+		return false
+	}
+	return engineErr.HasCode(ovirtclient.EConnection) || engineErr.HasCode(ovirtclient.ETimeout)
+}
+
+// throttledClient rate limits the calls of the actuator and controllers to the engine and records their
+// metrics. Calls made through the objects returned by the client, e.g. VM.Remove, call the wrapped client
+// and aren't throttled, therefore the actuator and controllers only call the engine with the methods of
+// the client, e.g. RemoveVM.
+type throttledClient struct {
+	ovirtclient.Client
+	throttle *engineThrottle
+}
+
+// throttledLegacyClient is a throttledClient of a client supporting the legacy SDK. The calls made with
+// the SDK connection can't be throttled by the connection itself, they are made with CallSDK. Requests
+// sent with the HTTP client aren't throttled.
+type throttledLegacyClient struct {
+	*throttledClient
+	legacyClient ovirtclient.ClientWithLegacySupport
+}
+
+// CallSDK makes a call with the legacy SDK connection of the client. The call of a throttled client goes
+// through the throttle like the calls of the client itself: it fails with an EngineThrottledError if the
+// circuit breaker is open or the rate limiter doesn't let it through, and waiting for the rate limiter is
+// aborted when the context is done.
+func CallSDK(
+	ctx context.Context,
+	client ovirtclient.ClientWithLegacySupport,
+	operation string,
+	f func(*ovirtsdk.Connection) error) error {
+	if throttled, ok := client.(*throttledLegacyClient); ok {
+		return throttled.throttle.callContext(ctx, operation, func() error {
+			return f(throttled.legacyClient.GetSDKClient())
+		})
+	}
+	return f(client.GetSDKClient())
+}
+
+// GetSDKClient returns the SDK connection of the wrapped client, the calls made with it directly aren't
+// throttled. Use CallSDK instead.
+func (client *throttledLegacyClient) GetSDKClient() *ovirtsdk.Connection {
+	return client.legacyClient.GetSDKClient()
+}
+
+func (client *throttledLegacyClient) GetHTTPClient() http.Client {
+	return client.legacyClient.GetHTTPClient()
+}
+
+func (client *throttledClient) AddTagToVMByName(
+	id ovirtclient.VMID, tagName string, retries ...ovirtclient.RetryStrategy) error {
+	return client.throttle.call("AddTagToVMByName", retries, func() error {
+		return client.Client.AddTagToVMByName(id, tagName, retries...)
+	})
+}
+
+func (client *throttledClient) AddVMToAffinityGroup(
+	clusterID ovirtclient.ClusterID,
+	vmID ovirtclient.VMID,
+	agID ovirtclient.AffinityGroupID,
+	retries ...ovirtclient.RetryStrategy) error {
+	return client.throttle.call("AddVMToAffinityGroup", retries, func() error {
+		return client.Client.AddVMToAffinityGroup(clusterID, vmID, agID, retries...)
+	})
+}
+
+func (client *throttledClient) AutoOptimizeVMCPUPinningSettings(
+	id ovirtclient.VMID, optimize bool, retries ...ovirtclient.RetryStrategy) error {
+	return client.throttle.call("AutoOptimizeVMCPUPinningSettings", retries, func() error {
+		return client.Client.AutoOptimizeVMCPUPinningSettings(id, optimize, retries...)
+	})
+}
+
+func (client *throttledClient) CreateDisk(
+	storageDomainID ovirtclient.StorageDomainID,
+	format ovirtclient.ImageFormat,
+	size uint64,
+	params ovirtclient.CreateDiskOptionalParameters,
+	retries ...ovirtclient.RetryStrategy) (disk ovirtclient.Disk, err error) {
+	err = client.throttle.call("CreateDisk", retries, func() error {
+		disk, err = client.Client.CreateDisk(storageDomainID, format, size, params, retries...)
+		return err
+	})
+	return disk, err
+}
+
+func (client *throttledClient) CreateDiskAttachment(
+	vmID ovirtclient.VMID,
+	diskID ovirtclient.DiskID,
+	diskInterface ovirtclient.DiskInterface,
+	params ovirtclient.CreateDiskAttachmentOptionalParams,
+	retries ...ovirtclient.RetryStrategy) (attachment ovirtclient.DiskAttachment, err error) {
+	err = client.throttle.call("CreateDiskAttachment", retries, func() error {
+		attachment, err = client.Client.CreateDiskAttachment(vmID, diskID, diskInterface, params, retries...)
+		return err
+	})
+	return attachment, err
+}
+
+func (client *throttledClient) CreateNIC(
+	vmID ovirtclient.VMID,
+	vnicProfileID ovirtclient.VNICProfileID,
+	name string,
+	optional ovirtclient.OptionalNICParameters,
+	retries ...ovirtclient.RetryStrategy) (nic ovirtclient.NIC, err error) {
+	err = client.throttle.call("CreateNIC", retries, func() error {
+		nic, err = client.Client.CreateNIC(vmID, vnicProfileID, name, optional, retries...)
+		return err
+	})
+	return nic, err
+}
+
+func (client *throttledClient) CreateVM(
+	clusterID ovirtclient.ClusterID,
+	templateID ovirtclient.TemplateID,
+	name string,
+	optional ovirtclient.OptionalVMParameters,
+	retries ...ovirtclient.RetryStrategy) (vm ovirtclient.VM, err error) {
+	err = client.throttle.call("CreateVM", retries, func() error {
+		vm, err = client.Client.CreateVM(clusterID, templateID, name, optional, retries...)
+		return err
+	})
+	return vm, err
+}
+
+func (client *throttledClient) GetAffinityGroupByName(
+	clusterID ovirtclient.ClusterID,
+	name string,
+	retries ...ovirtclient.RetryStrategy) (affinityGroup ovirtclient.AffinityGroup, err error) {
+	err = client.throttle.call("GetAffinityGroupByName", retries, func() error {
+		affinityGroup, err = client.Client.GetAffinityGroupByName(clusterID, name, retries...)
+		return err
+	})
+	return affinityGroup, err
+}
+
+func (client *throttledClient) GetCluster(
+	id ovirtclient.ClusterID, retries ...ovirtclient.RetryStrategy) (cluster ovirtclient.Cluster, err error) {
+	err = client.throttle.call("GetCluster", retries, func() error {
+		cluster, err = client.Client.GetCluster(id, retries...)
+		return err
+	})
+	return cluster, err
+}
+
+func (client *throttledClient) GetDisk(
+	id ovirtclient.DiskID, retries ...ovirtclient.RetryStrategy) (disk ovirtclient.Disk, err error) {
+	err = client.throttle.call("GetDisk", retries, func() error {
+		disk, err = client.Client.GetDisk(id, retries...)
+		return err
+	})
+	return disk, err
+}
+
+func (client *throttledClient) GetInstanceType(
+	id ovirtclient.InstanceTypeID,
+	retries ...ovirtclient.RetryStrategy) (instanceType ovirtclient.InstanceType, err error) {
+	err = client.throttle.call("GetInstanceType", retries, func() error {
+		instanceType, err = client.Client.GetInstanceType(id, retries...)
+		return err
+	})
+	return instanceType, err
+}
+
+func (client *throttledClient) GetNetwork(
+	id ovirtclient.NetworkID, retries ...ovirtclient.RetryStrategy) (network ovirtclient.Network, err error) {
+	err = client.throttle.call("GetNetwork", retries, func() error {
+		network, err = client.Client.GetNetwork(id, retries...)
+		return err
+	})
+	return network, err
+}
+
+func (client *throttledClient) GetStorageDomain(
+	id ovirtclient.StorageDomainID,
+	retries ...ovirtclient.RetryStrategy) (storageDomain ovirtclient.StorageDomain, err error) {
+	err = client.throttle.call("GetStorageDomain", retries, func() error {
+		storageDomain, err = client.Client.GetStorageDomain(id, retries...)
+		return err
+	})
+	return storageDomain, err
+}
+
+func (client *throttledClient) GetTemplate(
+	id ovirtclient.TemplateID, retries ...ovirtclient.RetryStrategy) (template ovirtclient.Template, err error) {
+	err = client.throttle.call("GetTemplate", retries, func() error {
+		template, err = client.Client.GetTemplate(id, retries...)
+		return err
+	})
+	return template, err
+}
+
+func (client *throttledClient) GetTemplateByName(
+	name string, retries ...ovirtclient.RetryStrategy) (template ovirtclient.Template, err error) {
+	err = client.throttle.call("GetTemplateByName", retries, func() error {
+		template, err = client.Client.GetTemplateByName(name, retries...)
+		return err
+	})
+	return template, err
+}
+
+func (client *throttledClient) GetVM(
+	id ovirtclient.VMID, retries ...ovirtclient.RetryStrategy) (vm ovirtclient.VM, err error) {
+	err = client.throttle.call("GetVM", retries, func() error {
+		vm, err = client.Client.GetVM(id, retries...)
+		return err
+	})
+	return vm, err
+}
+
+func (client *throttledClient) GetVMByName(
+	name string, retries ...ovirtclient.RetryStrategy) (vm ovirtclient.VM, err error) {
+	err = client.throttle.call("GetVMByName", retries, func() error {
+		vm, err = client.Client.GetVMByName(name, retries...)
+		return err
+	})
+	return vm, err
+}
+
+func (client *throttledClient) GetVMIPAddresses(
+	id ovirtclient.VMID,
+	params ovirtclient.VMIPSearchParams,
+	retries ...ovirtclient.RetryStrategy) (addresses map[string][]net.IP, err error) {
+	err = client.throttle.call("GetVMIPAddresses", retries, func() error {
+		addresses, err = client.Client.GetVMIPAddresses(id, params, retries...)
+		return err
+	})
+	return addresses, err
+}
+
+func (client *throttledClient) GetVNICProfile(
+	id ovirtclient.VNICProfileID,
+	retries ...ovirtclient.RetryStrategy) (profile ovirtclient.VNICProfile, err error) {
+	err = client.throttle.call("GetVNICProfile", retries, func() error {
+		profile, err = client.Client.GetVNICProfile(id, retries...)
+		return err
+	})
+	return profile, err
+}
+
+func (client *throttledClient) ListClusters(
+	retries ...ovirtclient.RetryStrategy) (clusters []ovirtclient.Cluster, err error) {
+	err = client.throttle.call("ListClusters", retries, func() error {
+		clusters, err = client.Client.ListClusters(retries...)
+		return err
+	})
+	return clusters, err
+}
+
+func (client *throttledClient) ListDatacenterClusters(
+	id ovirtclient.DatacenterID, retries ...ovirtclient.RetryStrategy) (clusters []ovirtclient.Cluster, err error) {
+	err = client.throttle.call("ListDatacenterClusters", retries, func() error {
+		clusters, err = client.Client.ListDatacenterClusters(id, retries...)
+		return err
+	})
+	return clusters, err
+}
+
+func (client *throttledClient) ListDatacenters(
+	retries ...ovirtclient.RetryStrategy) (datacenters []ovirtclient.Datacenter, err error) {
+	err = client.throttle.call("ListDatacenters", retries, func() error {
+		datacenters, err = client.Client.ListDatacenters(retries...)
+		return err
+	})
+	return datacenters, err
+}
+
+func (client *throttledClient) ListDiskAttachments(
+	vmID ovirtclient.VMID,
+	retries ...ovirtclient.RetryStrategy) (attachments []ovirtclient.DiskAttachment, err error) {
+	err = client.throttle.call("ListDiskAttachments", retries, func() error {
+		attachments, err = client.Client.ListDiskAttachments(vmID, retries...)
+		return err
+	})
+	return attachments, err
+}
+
+func (client *throttledClient) ListDisksByAlias(
+	alias string, retries ...ovirtclient.RetryStrategy) (disks []ovirtclient.Disk, err error) {
+	err = client.throttle.call("ListDisksByAlias", retries, func() error {
+		disks, err = client.Client.ListDisksByAlias(alias, retries...)
+		return err
+	})
+	return disks, err
+}
+
+func (client *throttledClient) ListHosts(
+	retries ...ovirtclient.RetryStrategy) (hosts []ovirtclient.Host, err error) {
+	err = client.throttle.call("ListHosts", retries, func() error {
+		hosts, err = client.Client.ListHosts(retries...)
+		return err
+	})
+	return hosts, err
+}
+
+func (client *throttledClient) ListInstanceTypes(
+	retries ...ovirtclient.RetryStrategy) (instanceTypes []ovirtclient.InstanceType, err error) {
+	err = client.throttle.call("ListInstanceTypes", retries, func() error {
+		instanceTypes, err = client.Client.ListInstanceTypes(retries...)
+		return err
+	})
+	return instanceTypes, err
+}
+
+func (client *throttledClient) ListNetworks(
+	retries ...ovirtclient.RetryStrategy) (networks []ovirtclient.Network, err error) {
+	err = client.throttle.call("ListNetworks", retries, func() error {
+		networks, err = client.Client.ListNetworks(retries...)
+		return err
+	})
+	return networks, err
+}
+
+func (client *throttledClient) ListNICs(
+	vmID ovirtclient.VMID, retries ...ovirtclient.RetryStrategy) (nics []ovirtclient.NIC, err error) {
+	err = client.throttle.call("ListNICs", retries, func() error {
+		nics, err = client.Client.ListNICs(vmID, retries...)
+		return err
+	})
+	return nics, err
+}
+
+func (client *throttledClient) ListStorageDomains(
+	retries ...ovirtclient.RetryStrategy) (storageDomains ovirtclient.StorageDomainList, err error) {
+	err = client.throttle.call("ListStorageDomains", retries, func() error {
+		storageDomains, err = client.Client.ListStorageDomains(retries...)
+		return err
+	})
+	return storageDomains, err
+}
+
+func (client *throttledClient) ListTemplateDiskAttachments(
+	templateID ovirtclient.TemplateID,
+	retries ...ovirtclient.RetryStrategy) (attachments []ovirtclient.TemplateDiskAttachment, err error) {
+	err = client.throttle.call("ListTemplateDiskAttachments", retries, func() error {
+		attachments, err = client.Client.ListTemplateDiskAttachments(templateID, retries...)
+		return err
+	})
+	return attachments, err
+}
+
+func (client *throttledClient) ListVMGraphicsConsoles(
+	vmID ovirtclient.VMID,
+	retries ...ovirtclient.RetryStrategy) (consoles []ovirtclient.VMGraphicsConsole, err error) {
+	err = client.throttle.call("ListVMGraphicsConsoles", retries, func() error {
+		consoles, err = client.Client.ListVMGraphicsConsoles(vmID, retries...)
+		return err
+	})
+	return consoles, err
+}
+
+func (client *throttledClient) ListVMTags(
+	id ovirtclient.VMID, retries ...ovirtclient.RetryStrategy) (tags []ovirtclient.Tag, err error) {
+	err = client.throttle.call("ListVMTags", retries, func() error {
+		tags, err = client.Client.ListVMTags(id, retries...)
+		return err
+	})
+	return tags, err
+}
+
+func (client *throttledClient) ListVNICProfiles(
+	retries ...ovirtclient.RetryStrategy) (profiles []ovirtclient.VNICProfile, err error) {
+	err = client.throttle.call("ListVNICProfiles", retries, func() error {
+		profiles, err = client.Client.ListVNICProfiles(retries...)
+		return err
+	})
+	return profiles, err
+}
+
+func (client *throttledClient) RemoveDiskAttachment(
+	vmID ovirtclient.VMID,
+	diskAttachmentID ovirtclient.DiskAttachmentID,
+	retries ...ovirtclient.RetryStrategy) error {
+	return client.throttle.call("RemoveDiskAttachment", retries, func() error {
+		return client.Client.RemoveDiskAttachment(vmID, diskAttachmentID, retries...)
+	})
+}
+
+func (client *throttledClient) RemoveNIC(
+	vmID ovirtclient.VMID, id ovirtclient.NICID, retries ...ovirtclient.RetryStrategy) error {
+	return client.throttle.call("RemoveNIC", retries, func() error {
+		return client.Client.RemoveNIC(vmID, id, retries...)
+	})
+}
+
+func (client *throttledClient) RemoveVM(id ovirtclient.VMID, retries ...ovirtclient.RetryStrategy) error {
+	return client.throttle.call("RemoveVM", retries, func() error {
+		return client.Client.RemoveVM(id, retries...)
+	})
+}
+
+func (client *throttledClient) RemoveVMGraphicsConsole(
+	vmID ovirtclient.VMID,
+	id ovirtclient.VMGraphicsConsoleID,
+	retries ...ovirtclient.RetryStrategy) error {
+	return client.throttle.call("RemoveVMGraphicsConsole", retries, func() error {
+		return client.Client.RemoveVMGraphicsConsole(vmID, id, retries...)
+	})
+}
+
+func (client *throttledClient) ShutdownVM(
+	id ovirtclient.VMID, force bool, retries ...ovirtclient.RetryStrategy) error {
+	return client.throttle.call("ShutdownVM", retries, func() error {
+		return client.Client.ShutdownVM(id, force, retries...)
+	})
+}
+
+func (client *throttledClient) StartVM(id ovirtclient.VMID, retries ...ovirtclient.RetryStrategy) error {
+	return client.throttle.call("StartVM", retries, func() error {
+		return client.Client.StartVM(id, retries...)
+	})
+}
+
+func (client *throttledClient) StopVM(id ovirtclient.VMID, force bool, retries ...ovirtclient.RetryStrategy) error {
+	return client.throttle.call("StopVM", retries, func() error {
+		return client.Client.StopVM(id, force, retries...)
+	})
+}
+
+func (client *throttledClient) UpdateDisk(
+	id ovirtclient.DiskID,
+	params ovirtclient.UpdateDiskParameters,
+	retries ...ovirtclient.RetryStrategy) (disk ovirtclient.Disk, err error) {
+	err = client.throttle.call("UpdateDisk", retries, func() error {
+		disk, err = client.Client.UpdateDisk(id, params, retries...)
+		return err
+	})
+	return disk, err
+}
+
+func (client *throttledClient) WaitForDiskOK(
+	id ovirtclient.DiskID, retries ...ovirtclient.RetryStrategy) (disk ovirtclient.Disk, err error) {
+	err = client.throttle.wait("WaitForDiskOK", retries, func() error {
+		disk, err = client.Client.WaitForDiskOK(id, retries...)
+		return err
+	})
+	return disk, err
+}
+
+func (client *throttledClient) WaitForVMStatus(
+	id ovirtclient.VMID,
+	status ovirtclient.VMStatus,
+	retries ...ovirtclient.RetryStrategy) (vm ovirtclient.VM, err error) {
+	err = client.throttle.wait("WaitForVMStatus", retries, func() error {
+		vm, err = client.Client.WaitForVMStatus(id, status, retries...)
+		return err
+	})
+	return vm, err
+}
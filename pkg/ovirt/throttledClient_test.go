@@ -0,0 +1,295 @@
+//go:build unit
+
+package ovirt
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	ovirtsdk "github.com/ovirt/go-ovirt"
+	ovirtclient "github.com/ovirt/go-ovirt-client/v2"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// clusterClient counts the GetCluster calls and fails them with err.
+type clusterClient struct {
+	ovirtclient.Client
+	calls int
+	err   error
+}
+
+func (c *clusterClient) GetCluster(id ovirtclient.ClusterID, _ ...ovirtclient.RetryStrategy) (ovirtclient.Cluster, error) {
+	c.calls++
+	return nil, c.err
+}
+
+func (c *clusterClient) WaitForVMStatus(
+	id ovirtclient.VMID, status ovirtclient.VMStatus, _ ...ovirtclient.RetryStrategy,
+) (ovirtclient.VM, error) {
+	c.calls++
+	return nil, c.err
+}
+
+func (c *clusterClient) AddVMToAffinityGroup(
+	clusterID ovirtclient.ClusterID, vmID ovirtclient.VMID, agID ovirtclient.AffinityGroupID, _ ...ovirtclient.RetryStrategy,
+) error {
+	c.calls++
+	return c.err
+}
+
+func (c *clusterClient) ListDatacenterClusters(
+	id ovirtclient.DatacenterID, _ ...ovirtclient.RetryStrategy,
+) ([]ovirtclient.Cluster, error) {
+	c.calls++
+	return nil, c.err
+}
+
+// legacyClient is a client supporting the legacy SDK.
+type legacyClient struct {
+	ovirtclient.Client
+}
+
+func (c *legacyClient) GetSDKClient() *ovirtsdk.Connection {
+	return nil
+}
+
+func (c *legacyClient) GetHTTPClient() http.Client {
+	return http.Client{}
+}
+
+func TestThrottledClientRateLimit(t *testing.T) {
+	inner := &clusterClient{}
+	client := newEngineThrottle(ThrottleConfig{QPS: 0.01, Burst: 1}).wrap(inner)
+
+	if _, err := client.GetCluster("cluster"); err != nil {
+		t.Fatalf("Unexpected error occurred calling the engine within the burst: %v", err)
+	}
+	_, err := client.GetCluster("cluster")
+	throttledErr, ok := IsEngineThrottled(err)
+	if !ok {
+		t.Fatalf("Expected EngineThrottledError exceeding the rate limit, but got %v", err)
+	}
+	if throttledErr.RetryAfter <= maxThrottleWait {
+		t.Errorf("Expected the call to be retried after more than %s, but got %s", maxThrottleWait, throttledErr.RetryAfter)
+	}
+	if inner.calls != 1 {
+		t.Errorf("Expected the throttled call not to reach the engine, but got %d calls", inner.calls)
+	}
+}
+
+func TestThrottledClientCircuitBreaker(t *testing.T) {
+	inner := &clusterClient{err: engineError{code: ovirtclient.EConnection}}
+	throttle := newEngineThrottle(ThrottleConfig{})
+	client := throttle.wrap(inner)
+
+	for i := 0; i < breakerFailureThreshold; i++ {
+		if _, err := client.GetCluster("cluster"); isEngineThrottledErr(err) {
+			t.Fatalf("Unexpected throttling before the circuit breaker opened: %v", err)
+		}
+	}
+	if _, err := client.GetCluster("cluster"); !isEngineThrottledErr(err) {
+		t.Errorf("Expected EngineThrottledError with open circuit breaker, but got %v", err)
+	}
+	if inner.calls != breakerFailureThreshold {
+		t.Errorf("Expected no calls to reach the engine with open circuit breaker, but got %d calls", inner.calls)
+	}
+
+	// once the breaker was open long enough, a single call tests the engine
+	throttle.openUntil = time.Now()
+	inner.err = engineError{code: ovirtclient.ENotFound}
+	if _, err := client.GetCluster("cluster"); isEngineThrottledErr(err) {
+		t.Fatalf("Expected a call to be let through the half-open circuit breaker, but got %v", err)
+	}
+	if _, err := client.GetCluster("cluster"); isEngineThrottledErr(err) {
+		t.Errorf("Expected the circuit breaker to close after the engine answered, but got %v", err)
+	}
+}
+
+func TestThrottledClientCanceledContext(t *testing.T) {
+	inner := &clusterClient{}
+	client := newEngineThrottle(ThrottleConfig{QPS: 0.2, Burst: 1}).wrap(inner)
+
+	if _, err := client.GetCluster("cluster"); err != nil {
+		t.Fatalf("Unexpected error occurred calling the engine within the burst: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	start := time.Now()
+	_, err := client.GetCluster("cluster", ovirtclient.ContextStrategy(ctx))
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected the wait for the rate limiter to be canceled, but got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed >= time.Second {
+		t.Errorf("Expected the canceled call to return immediately, but it took %s", elapsed)
+	}
+	if inner.calls != 1 {
+		t.Errorf("Expected the canceled call not to reach the engine, but got %d calls", inner.calls)
+	}
+}
+
+func TestThrottledClientWaitCallsDontProbe(t *testing.T) {
+	inner := &clusterClient{err: engineError{code: ovirtclient.ETimeout}}
+	throttle := newEngineThrottle(ThrottleConfig{})
+	client := throttle.wrap(inner)
+
+	// timeouts waiting for a VM status don't count as failures to reach the engine
+	for i := 0; i < breakerFailureThreshold; i++ {
+		if _, err := client.WaitForVMStatus("vm", ovirtclient.VMStatusUp); isEngineThrottledErr(err) {
+			t.Fatalf("Unexpected throttling of wait calls: %v", err)
+		}
+	}
+	if _, err := client.GetCluster("cluster"); isEngineThrottledErr(err) {
+		t.Fatalf("Expected the circuit breaker to stay closed after wait timeouts, but got %v", err)
+	}
+
+	// a half-open circuit breaker is only probed by calls which return quickly
+	throttle.consecutiveFailures = breakerFailureThreshold
+	throttle.openUntil = time.Now()
+	if _, err := client.WaitForVMStatus("vm", ovirtclient.VMStatusUp); !isEngineThrottledErr(err) {
+		t.Errorf("Expected EngineThrottledError for a wait call with half-open circuit breaker, but got %v", err)
+	}
+	if throttle.probing {
+		t.Errorf("Expected the wait call not to probe the half-open circuit breaker")
+	}
+}
+
+func TestCallSDK(t *testing.T) {
+	testCases := []struct {
+		name      string
+		throttle  func(throttle *engineThrottle)
+		throttled bool
+	}{
+		{
+			name:      "calls the SDK",
+			throttle:  func(throttle *engineThrottle) {},
+			throttled: false,
+		},
+		{
+			name: "rejected with open circuit breaker",
+			throttle: func(throttle *engineThrottle) {
+				throttle.consecutiveFailures = breakerFailureThreshold
+				throttle.openUntil = time.Now().Add(breakerOpenDuration)
+			},
+			throttled: true,
+		},
+		{
+			name: "rejected exceeding the rate limit",
+			throttle: func(throttle *engineThrottle) {
+				throttle.limiter.Allow()
+			},
+			throttled: true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			throttle := newEngineThrottle(ThrottleConfig{QPS: 0.01, Burst: 1})
+			tc.throttle(throttle)
+			client := throttle.wrap(&legacyClient{}).(ovirtclient.ClientWithLegacySupport)
+
+			called := false
+			err := CallSDK(context.Background(), client, "GetVM", func(*ovirtsdk.Connection) error {
+				called = true
+				return nil
+			})
+			if isEngineThrottledErr(err) != tc.throttled {
+				t.Errorf("Expected throttled %t, but got error %v", tc.throttled, err)
+			}
+			if called == tc.throttled {
+				t.Errorf("Expected the SDK call to be made %t, but it was made %t", !tc.throttled, called)
+			}
+		})
+	}
+}
+
+func TestThrottledClientObservesAPICalls(t *testing.T) {
+	client := newEngineThrottle(ThrottleConfig{}).wrap(&legacyClient{Client: &clusterClient{}})
+	testCases := []struct {
+		operation string
+		call      func() error
+	}{
+		{
+			operation: "AddVMToAffinityGroup",
+			call: func() error {
+				return client.AddVMToAffinityGroup("cluster", "vm", "group")
+			},
+		},
+		{
+			operation: "ListDatacenterClusters",
+			call: func() error {
+				_, err := client.ListDatacenterClusters("datacenter")
+				return err
+			},
+		},
+		{
+			operation: "CopyDisk",
+			call: func() error {
+				return CallSDK(context.Background(), client.(ovirtclient.ClientWithLegacySupport), "CopyDisk",
+					func(*ovirtsdk.Connection) error { return nil })
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.operation, func(t *testing.T) {
+			before := apiCallCount(t, tc.operation, "success")
+			if err := tc.call(); err != nil {
+				t.Fatalf("Unexpected error occurred calling %s: %v", tc.operation, err)
+			}
+			if observed := apiCallCount(t, tc.operation, "success") - before; observed != 1 {
+				t.Errorf("Expected 1 observed %s call, but got %d", tc.operation, observed)
+			}
+		})
+	}
+}
+
+// apiCallCount returns the number of API calls of the operation observed with the result.
+func apiCallCount(t *testing.T, operation string, result string) uint64 {
+	t.Helper()
+	metric := &dto.Metric{}
+	histogram, ok := apiCallDuration.WithLabelValues(operation, result).(prometheus.Histogram)
+	if !ok {
+		t.Fatalf("Expected the API call duration to be a histogram")
+	}
+	if err := histogram.Write(metric); err != nil {
+		t.Fatalf("Unexpected error occurred reading the API call duration: %v", err)
+	}
+	return metric.GetHistogram().GetSampleCount()
+}
+
+func TestThrottledClientLegacySupport(t *testing.T) {
+	throttle := newEngineThrottle(ThrottleConfig{})
+	if _, ok := throttle.wrap(&legacyClient{}).(ovirtclient.ClientWithLegacySupport); !ok {
+		t.Errorf("Expected the throttled client of a legacy client to support the legacy SDK")
+	}
+	if _, ok := throttle.wrap(&clusterClient{}).(ovirtclient.ClientWithLegacySupport); ok {
+		t.Errorf("Expected the throttled client of a client without legacy support not to support the legacy SDK")
+	}
+}
+
+func isEngineThrottledErr(err error) bool {
+	_, ok := IsEngineThrottled(err)
+	return ok
+}
+
+func TestAPICallResult(t *testing.T) {
+	testCases := []struct {
+		name     string
+		err      error
+		expected string
+	}{
+		{name: "success", err: nil, expected: "success"},
+		{name: "throttled", err: &EngineThrottledError{}, expected: "throttled"},
+		{name: "engine error", err: engineError{code: ovirtclient.ENotFound}, expected: string(ovirtclient.ENotFound)},
+		{name: "other error", err: http.ErrHandlerTimeout, expected: "error"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if result := apiCallResult(tc.err); result != tc.expected {
+				t.Errorf("Expected result %q, but got %q", tc.expected, result)
+			}
+		})
+	}
+}
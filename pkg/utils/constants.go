@@ -6,4 +6,7 @@ const (
 	OvirtCloudCredsSecretName = "ovirt-credentials"
 	NAMESPACE                 = "openshift-machine-api"
 	UserAgent                 = "cluster-api-provider-ovirt"
+	// MachineAnnotationKey is set on nodes by the machine-api nodelink controller and contains
+	// the namespace/name of the machine backing the node.
+	MachineAnnotationKey = "machine.openshift.io/machine"
 )
@@ -0,0 +1,28 @@
+package utils
+
+import (
+	"fmt"
+	"strings"
+
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+)
+
+// OwnershipMarker returns the marker which is stored in the comment of the VMs of the cluster on creation.
+// An empty marker is returned for an empty cluster ID.
+func OwnershipMarker(clusterID string) string {
+	if clusterID == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s=%s", machinev1.MachineClusterIDLabel, clusterID)
+}
+
+// HasOwnershipMarker returns true if one of the lines of the VM comment is the ownership marker of the cluster.
+func HasOwnershipMarker(comment string, clusterID string) bool {
+	marker := OwnershipMarker(clusterID)
+	for _, line := range strings.Split(comment, "\n") {
+		if strings.TrimSpace(line) == marker {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,12 @@
+package utils
+
+import "strings"
+
+// VMIDFromProviderID returns the oVirt VM ID contained in a provider ID of the form ovirt://<vm-id>.
+// An empty string is returned if the provider ID doesn't belong to oVirt.
+func VMIDFromProviderID(providerID string) string {
+	if !strings.HasPrefix(providerID, ProviderIDPrefix) {
+		return ""
+	}
+	return strings.TrimPrefix(providerID, ProviderIDPrefix)
+}
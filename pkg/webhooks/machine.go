@@ -0,0 +1,148 @@
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	"github.com/openshift/cluster-api-provider-ovirt/pkg/actuators/machine"
+	ovirtconfigv1 "github.com/openshift/cluster-api-provider-ovirt/pkg/apis/ovirtprovider/v1beta1"
+	admissionv1 "k8s.io/api/admission/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// The paths the admission webhooks are served at.
+const (
+	MachineValidatingWebhookPath    = "/validate-machine-openshift-io-v1beta1-machine"
+	MachineSetValidatingWebhookPath = "/validate-machine-openshift-io-v1beta1-machineset"
+	MachineDefaultingWebhookPath    = "/mutate-machine-openshift-io-v1beta1-machine"
+	MachineSetDefaultingWebhookPath = "/mutate-machine-openshift-io-v1beta1-machineset"
+)
+
+var (
+	// machineProviderSpecPath is the path of the provider spec in a Machine.
+	machineProviderSpecPath = machine.MachineProviderSpecPath
+	// machineSetProviderSpecPath is the path of the provider spec in a MachineSet.
+	machineSetProviderSpecPath = field.NewPath("spec", "template", "spec", "providerSpec", "value")
+)
+
+// Register registers the admission webhooks for the oVirt provider spec of Machines and MachineSets
+// at the webhook server.
+func Register(server *webhook.Server) {
+	server.Register(MachineValidatingWebhookPath, &webhook.Admission{Handler: &providerSpecValidator{
+		decode: decodeMachine,
+		path:   machineProviderSpecPath,
+	}})
+	server.Register(MachineSetValidatingWebhookPath, &webhook.Admission{Handler: &providerSpecValidator{
+		decode: decodeMachineSet,
+		path:   machineSetProviderSpecPath,
+	}})
+	server.Register(MachineDefaultingWebhookPath, &webhook.Admission{Handler: &providerSpecDefaulter{decode: decodeMachine}})
+	server.Register(MachineSetDefaultingWebhookPath, &webhook.Admission{Handler: &providerSpecDefaulter{decode: decodeMachineSet}})
+}
+
+// decodeFunc decodes the object of the admission request and returns the object together with a
+// pointer to its provider spec.
+type decodeFunc func(decoder *admission.Decoder, req admission.Request) (runtime.Object, *machinev1.ProviderSpec, error)
+
+// decodeMachine decodes a Machine.
+func decodeMachine(decoder *admission.Decoder, req admission.Request) (runtime.Object, *machinev1.ProviderSpec, error) {
+	m := &machinev1.Machine{}
+	if err := decoder.Decode(req, m); err != nil {
+		return nil, nil, err
+	}
+	return m, &m.Spec.ProviderSpec, nil
+}
+
+// decodeMachineSet decodes a MachineSet, the provider spec is the one of its machine template.
+func decodeMachineSet(decoder *admission.Decoder, req admission.Request) (runtime.Object, *machinev1.ProviderSpec, error) {
+	ms := &machinev1.MachineSet{}
+	if err := decoder.Decode(req, ms); err != nil {
+		return nil, nil, err
+	}
+	return ms, &ms.Spec.Template.Spec.ProviderSpec, nil
+}
+
+// providerSpecValidator rejects objects with an invalid oVirt provider spec. Only the fields which
+// don't depend on the oVirt engine are validated, the actuator checks the rest on creation.
+type providerSpecValidator struct {
+	decoder *admission.Decoder
+	decode  decodeFunc
+	path    *field.Path
+}
+
+// InjectDecoder injects the decoder of the webhook server.
+func (v *providerSpecValidator) InjectDecoder(decoder *admission.Decoder) error {
+	v.decoder = decoder
+	return nil
+}
+
+// Handle validates the provider spec of the object of the admission request. All problems are
+// reported at once as the causes of an Invalid status.
+func (v *providerSpecValidator) Handle(_ context.Context, req admission.Request) admission.Response {
+	_, providerSpec, err := v.decode(v.decoder, req)
+	if err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+	var allErrs field.ErrorList
+	if providerSpec.Value == nil {
+		allErrs = field.ErrorList{field.Required(v.path, "the oVirt provider spec must be set")}
+	} else if spec, err := ovirtconfigv1.ProviderSpecFromRawExtension(providerSpec.Value); err != nil {
+		allErrs = field.ErrorList{field.Invalid(v.path, string(providerSpec.Value.Raw), err.Error())}
+	} else {
+		allErrs = machine.ValidateProviderSpec(spec, v.path)
+	}
+	if len(allErrs) == 0 {
+		return admission.Allowed("")
+	}
+
+	invalid := apierrors.NewInvalid(schema.GroupKind{Group: req.Kind.Group, Kind: req.Kind.Kind}, req.Name, allErrs)
+	return admission.Response{AdmissionResponse: admissionv1.AdmissionResponse{
+		Allowed: false,
+		Result:  &invalid.ErrStatus,
+	}}
+}
+
+// providerSpecDefaulter sets the defaults of the oVirt provider spec explicitly.
+type providerSpecDefaulter struct {
+	decoder *admission.Decoder
+	decode  decodeFunc
+}
+
+// InjectDecoder injects the decoder of the webhook server.
+func (d *providerSpecDefaulter) InjectDecoder(decoder *admission.Decoder) error {
+	d.decoder = decoder
+	return nil
+}
+
+// Handle patches the defaults into the provider spec of the object of the admission request.
+// Provider specs which can't be parsed are left to the validating webhook.
+func (d *providerSpecDefaulter) Handle(_ context.Context, req admission.Request) admission.Response {
+	obj, providerSpec, err := d.decode(d.decoder, req)
+	if err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+	if providerSpec.Value == nil {
+		return admission.Allowed("")
+	}
+	spec, err := ovirtconfigv1.ProviderSpecFromRawExtension(providerSpec.Value)
+	if err != nil {
+		return admission.Allowed("")
+	}
+
+	machine.DefaultProviderSpec(spec)
+	if providerSpec.Value, err = ovirtconfigv1.RawExtensionFromProviderSpec(spec); err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+	marshaled, err := json.Marshal(obj)
+	if err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+	return admission.PatchResponseFromRaw(req.Object.Raw, marshaled)
+}
@@ -0,0 +1,172 @@
+//go:build unit
+
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	ovirtconfigv1 "github.com/openshift/cluster-api-provider-ovirt/pkg/apis/ovirtprovider/v1beta1"
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+func TestProviderSpecValidator(t *testing.T) {
+	testcases := []struct {
+		name          string
+		modify        func(spec *ovirtconfigv1.OvirtMachineProviderSpec)
+		expectAllowed bool
+	}{
+		{
+			name:          "valid provider spec is allowed",
+			modify:        func(spec *ovirtconfigv1.OvirtMachineProviderSpec) {},
+			expectAllowed: true,
+		},
+		{
+			name: "provider spec without user data secret is denied",
+			modify: func(spec *ovirtconfigv1.OvirtMachineProviderSpec) {
+				spec.UserDataSecret = nil
+			},
+			expectAllowed: false,
+		},
+		{
+			name: "provider spec with invalid hugepages is denied",
+			modify: func(spec *ovirtconfigv1.OvirtMachineProviderSpec) {
+				spec.Hugepages = 4096
+			},
+			expectAllowed: false,
+		},
+		{
+			name: "provider spec with guaranteed memory bigger than memory is denied",
+			modify: func(spec *ovirtconfigv1.OvirtMachineProviderSpec) {
+				spec.GuaranteedMemoryMB = spec.MemoryMB + 1
+			},
+			expectAllowed: false,
+		},
+		{
+			name: "provider spec with unknown VM type is denied",
+			modify: func(spec *ovirtconfigv1.OvirtMachineProviderSpec) {
+				spec.VMType = "unknown"
+			},
+			expectAllowed: false,
+		},
+	}
+
+	for _, testcase := range testcases {
+		for _, kind := range []string{"Machine", "MachineSet"} {
+			t.Run(kind+": "+testcase.name, func(t *testing.T) {
+				spec := validProviderSpec()
+				testcase.modify(spec)
+				validator := &providerSpecValidator{decoder: newDecoder(t), decode: decodeFuncs[kind], path: providerSpecPaths[kind]}
+
+				response := validator.Handle(context.Background(), newRequest(t, kind, spec))
+				if response.Allowed != testcase.expectAllowed {
+					t.Errorf("Expected allowed %t, but got %t: %v", testcase.expectAllowed, response.Allowed, response.Result)
+				}
+				if !testcase.expectAllowed && (response.Result.Details == nil || len(response.Result.Details.Causes) == 0) {
+					t.Errorf("Expected the problems as causes of the denial, but got %v", response.Result)
+				}
+			})
+		}
+	}
+}
+
+func TestProviderSpecDefaulter(t *testing.T) {
+	for kind, decode := range decodeFuncs {
+		t.Run(kind, func(t *testing.T) {
+			spec := validProviderSpec()
+			spec.VMType = ""
+			defaulter := &providerSpecDefaulter{decoder: newDecoder(t), decode: decode}
+
+			response := defaulter.Handle(context.Background(), newRequest(t, kind, spec))
+			if !response.Allowed {
+				t.Fatalf("Expected request to be allowed, but got %v", response.Result)
+			}
+			paths := map[string]bool{}
+			for _, patch := range response.Patches {
+				paths[patch.Path] = true
+			}
+			prefix := "/spec/providerSpec/value/"
+			if kind == "MachineSet" {
+				prefix = "/spec/template/spec/providerSpec/value/"
+			}
+			for _, field := range []string{"type", "clone"} {
+				if !paths[prefix+field] {
+					t.Errorf("Expected patch of %s%s, but got %v", prefix, field, response.Patches)
+				}
+			}
+			// defaulting the disk format would override the disks of the template
+			for _, field := range []string{"format", "sparse"} {
+				if paths[prefix+field] {
+					t.Errorf("Unexpected patch of %s%s: %v", prefix, field, response.Patches)
+				}
+			}
+		})
+	}
+}
+
+var decodeFuncs = map[string]decodeFunc{
+	"Machine":    decodeMachine,
+	"MachineSet": decodeMachineSet,
+}
+
+var providerSpecPaths = map[string]*field.Path{
+	"Machine":    machineProviderSpecPath,
+	"MachineSet": machineSetProviderSpecPath,
+}
+
+func validProviderSpec() *ovirtconfigv1.OvirtMachineProviderSpec {
+	return &ovirtconfigv1.OvirtMachineProviderSpec{
+		Name:           "ovirt-vm-12345",
+		ClusterId:      "46991e3f-8752-4ab6-9f2d-c37a98358d52",
+		TemplateName:   "rhcos",
+		VMType:         "server",
+		MemoryMB:       16348,
+		OSDisk:         &ovirtconfigv1.Disk{SizeGB: 31},
+		CPU:            &ovirtconfigv1.CPU{Cores: 4, Threads: 1, Sockets: 1},
+		UserDataSecret: &corev1.LocalObjectReference{Name: "worker-user-data"},
+	}
+}
+
+func newDecoder(t *testing.T) *admission.Decoder {
+	scheme := runtime.NewScheme()
+	if err := machinev1.AddToScheme(scheme); err != nil {
+		t.Fatalf("Unexpected error occurred setting up scheme: %v", err)
+	}
+	decoder, err := admission.NewDecoder(scheme)
+	if err != nil {
+		t.Fatalf("Unexpected error occurred setting up decoder: %v", err)
+	}
+	return decoder
+}
+
+func newRequest(t *testing.T, kind string, spec *ovirtconfigv1.OvirtMachineProviderSpec) admission.Request {
+	rawSpec, err := ovirtconfigv1.RawExtensionFromProviderSpec(spec)
+	if err != nil {
+		t.Fatalf("Unexpected error occurred marshalling provider spec: %v", err)
+	}
+	providerSpec := machinev1.ProviderSpec{Value: rawSpec}
+
+	var obj runtime.Object
+	switch kind {
+	case "Machine":
+		obj = &machinev1.Machine{Spec: machinev1.MachineSpec{ProviderSpec: providerSpec}}
+	case "MachineSet":
+		obj = &machinev1.MachineSet{Spec: machinev1.MachineSetSpec{
+			Template: machinev1.MachineTemplateSpec{Spec: machinev1.MachineSpec{ProviderSpec: providerSpec}},
+		}}
+	}
+	raw, err := json.Marshal(obj)
+	if err != nil {
+		t.Fatalf("Unexpected error occurred marshalling %s: %v", kind, err)
+	}
+	return admission.Request{AdmissionRequest: admissionv1.AdmissionRequest{
+		Operation: admissionv1.Create,
+		Object:    runtime.RawExtension{Raw: raw},
+	}}
+}